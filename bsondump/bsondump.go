@@ -13,6 +13,14 @@ import (
 	"strings"
 )
 
+// bsonDumpValidationOptions are used for --objcheck. Field names starting with
+// '$' or containing '.' are allowed, since files like oplog.bson contain them.
+var bsonDumpValidationOptions = bsonutil.ValidationOptions{
+	MaxSize:                db.MaxBSONSize,
+	MaxDepth:               bsonutil.DefaultValidationOptions.MaxDepth,
+	AllowSpecialFieldNames: true,
+}
+
 type BSONDump struct {
 	ToolOptions     *options.ToolOptions
 	BSONDumpOptions *BSONDumpOptions
@@ -65,6 +73,12 @@ func (bd *BSONDump) Dump() (int, error) {
 
 	var result bson.Raw
 	for decodedStream.Next(&result) {
+		if bd.BSONDumpOptions.ObjCheck {
+			if err := bsonutil.ValidateBSON(result.Data, bsonDumpValidationOptions); err != nil {
+				log.Logf(log.Always, "invalid document %v: %v", numFound+1, err)
+				return numFound, fmt.Errorf("Failed to validate bson during objcheck: %v", err)
+			}
+		}
 		if err := dumpDoc(&result, bd.Out); err != nil {
 			log.Logf(log.Always, "unable to dump document %v: %v", numFound+1, err)
 
@@ -110,8 +124,7 @@ func (bd *BSONDump) Debug() (int, error) {
 		result.Data = reusableBuf[0:docSize]
 
 		if bd.BSONDumpOptions.ObjCheck {
-			validated := bson.M{}
-			err := bson.Unmarshal(result.Data, &validated)
+			err := bsonutil.ValidateBSON(result.Data, bsonDumpValidationOptions)
 			if err != nil {
 				// ObjCheck is turned on and we hit an error, so short-circuit now.
 				return numFound, fmt.Errorf("Failed to validate bson during objcheck: %v", err)
@@ -0,0 +1,284 @@
+package bsonutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationOptions controls the checks made by ValidateBSON
+type ValidationOptions struct {
+	// MaxSize is the largest allowed document size in bytes
+	MaxSize int
+	// MaxDepth is the deepest allowed nesting of embedded documents and arrays,
+	// counting the top-level document as depth 1
+	MaxDepth int
+	// AllowSpecialFieldNames skips the check that field names don't start with
+	// '$' or contain '.', for documents that aren't going to be stored, such as
+	// update operators in oplog entries
+	AllowSpecialFieldNames bool
+}
+
+// DefaultValidationOptions are the limits the server applies to stored documents
+var DefaultValidationOptions = ValidationOptions{
+	MaxSize:  16 * 1024 * 1024,
+	MaxDepth: 100,
+}
+
+// ValidationError describes the first problem found in a BSON document
+type ValidationError struct {
+	// Offset is the position in the document of the invalid data
+	Offset int
+	// Path is the dotted path of the field containing the invalid
+	// data, or empty for problems with the document itself
+	Path   string
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	if err.Path == "" {
+		return fmt.Sprintf("invalid BSON at byte %v: %v", err.Offset, err.Reason)
+	}
+	return fmt.Sprintf("invalid BSON at byte %v in field '%v': %v", err.Offset, err.Path, err.Reason)
+}
+
+// field names starting with '$' that are allowed, for DBRefs
+var dbRefFieldNames = map[string]bool{"$ref": true, "$id": true, "$db": true}
+
+// ValidateBSON strictly checks a raw BSON document. Besides checking that it
+// is well formed, it checks for invalid UTF-8 in strings and field names,
+// duplicate field names, invalid type bytes, and documents that are too big or
+// too deeply nested, and, unless allowed, for field names that start with '$'
+// or contain '.'. It returns a *ValidationError describing the first problem.
+func ValidateBSON(data []byte, options ValidationOptions) error {
+	if options.MaxSize > 0 && len(data) > options.MaxSize {
+		return &ValidationError{0, "", fmt.Sprintf("document is %v bytes, larger than the limit of %v bytes",
+			len(data), options.MaxSize)}
+	}
+	v := &validator{data: data, options: options}
+	end, err := v.document(0, "", 1, false)
+	if err != nil {
+		return err
+	}
+	if end != len(data) {
+		return &ValidationError{end, "", fmt.Sprintf("%v bytes of trailing data after the document", len(data)-end)}
+	}
+	return nil
+}
+
+type validator struct {
+	data    []byte
+	options ValidationOptions
+}
+
+func (v *validator) fail(offset int, path, format string, a ...interface{}) error {
+	return &ValidationError{offset, path, fmt.Sprintf(format, a...)}
+}
+
+// int32At reads a little-endian int32, checking that it is within the data
+func (v *validator) int32At(offset int, path string) (int, error) {
+	if offset+4 > len(v.data) {
+		return 0, v.fail(offset, path, "unexpected end of data reading length")
+	}
+	return int(int32(binary.LittleEndian.Uint32(v.data[offset:]))), nil
+}
+
+// document checks the embedded document or array starting at offset,
+// and returns the offset of the byte after it
+func (v *validator) document(offset int, path string, depth int, isArray bool) (int, error) {
+	if v.options.MaxDepth > 0 && depth > v.options.MaxDepth {
+		return 0, v.fail(offset, path, "nested more than %v levels deep", v.options.MaxDepth)
+	}
+	length, err := v.int32At(offset, path)
+	if err != nil {
+		return 0, err
+	}
+	if length < 5 || offset+length > len(v.data) {
+		return 0, v.fail(offset, path, "invalid document length %v", length)
+	}
+	end := offset + length
+	if v.data[end-1] != 0 {
+		return 0, v.fail(end-1, path, "document is not null-terminated")
+	}
+
+	names := map[string]bool{}
+	pos := offset + 4
+	for pos < end-1 {
+		typeOffset := pos
+		kind := v.data[pos]
+		pos++
+
+		nameEnd := bytes.IndexByte(v.data[pos:end], 0)
+		if nameEnd < 0 {
+			return 0, v.fail(pos, path, "field name is not null-terminated")
+		}
+		name := string(v.data[pos : pos+nameEnd])
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		if err = v.fieldName(pos, fieldPath, name, names, isArray); err != nil {
+			return 0, err
+		}
+		pos += nameEnd + 1
+
+		pos, err = v.value(kind, typeOffset, pos, end-1, fieldPath, depth)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if pos != end-1 {
+		return 0, v.fail(pos, path, "field overruns the end of its document")
+	}
+	return end, nil
+}
+
+func (v *validator) fieldName(offset int, fieldPath, name string, names map[string]bool, isArray bool) error {
+	if !utf8.ValidString(name) {
+		return v.fail(offset, fieldPath, "field name is not valid UTF-8")
+	}
+	if names[name] {
+		return v.fail(offset, fieldPath, "duplicate field name '%v'", name)
+	}
+	names[name] = true
+	if isArray {
+		if _, err := strconv.Atoi(name); err != nil {
+			return v.fail(offset, fieldPath, "array index '%v' is not a number", name)
+		}
+		return nil
+	}
+	if v.options.AllowSpecialFieldNames {
+		return nil
+	}
+	if strings.HasPrefix(name, "$") && !dbRefFieldNames[name] {
+		return v.fail(offset, fieldPath, "field name '%v' starts with '$'", name)
+	}
+	if strings.Contains(name, ".") {
+		return v.fail(offset, fieldPath, "field name '%v' contains '.'", name)
+	}
+	return nil
+}
+
+// value checks a value of the given kind starting at offset, which must
+// end by limit, and returns the offset of the byte after it
+func (v *validator) value(kind byte, typeOffset, offset, limit int, path string, depth int) (int, error) {
+	fixed := func(size int) (int, error) {
+		if offset+size > limit {
+			return 0, v.fail(offset, path, "value overruns the end of its document")
+		}
+		return offset + size, nil
+	}
+
+	switch kind {
+	case 0x01, 0x09, 0x11, 0x12: // double, datetime, timestamp, int64
+		return fixed(8)
+	case 0x02, 0x0D, 0x0E: // string, javascript, symbol
+		return v.str(offset, limit, path)
+	case 0x03, 0x04: // document, array
+		end, err := v.document(offset, path, depth+1, kind == 0x04)
+		if err != nil {
+			return 0, err
+		}
+		if end > limit {
+			return 0, v.fail(offset, path, "value overruns the end of its document")
+		}
+		return end, nil
+	case 0x05: // binary
+		length, err := v.int32At(offset, path)
+		if err != nil {
+			return 0, err
+		}
+		if length < 0 {
+			return 0, v.fail(offset, path, "invalid binary length %v", length)
+		}
+		return fixed(4 + 1 + length)
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, maxkey, minkey
+		return offset, nil
+	case 0x07: // objectid
+		return fixed(12)
+	case 0x08: // boolean
+		end, err := fixed(1)
+		if err != nil {
+			return 0, err
+		}
+		if v.data[offset] > 1 {
+			return 0, v.fail(offset, path, "invalid boolean value %v", v.data[offset])
+		}
+		return end, nil
+	case 0x0B: // regex
+		end, err := v.cstring(offset, limit, path)
+		if err != nil {
+			return 0, err
+		}
+		return v.cstring(end, limit, path)
+	case 0x0C: // dbpointer
+		end, err := v.str(offset, limit, path)
+		if err != nil {
+			return 0, err
+		}
+		offset = end
+		return fixed(12)
+	case 0x0F: // javascript with scope
+		length, err := v.int32At(offset, path)
+		if err != nil {
+			return 0, err
+		}
+		if length < 14 || offset+length > limit {
+			return 0, v.fail(offset, path, "invalid code with scope length %v", length)
+		}
+		end, err := v.str(offset+4, offset+length, path)
+		if err != nil {
+			return 0, err
+		}
+		end, err = v.document(end, path, depth+1, false)
+		if err != nil {
+			return 0, err
+		}
+		if end != offset+length {
+			return 0, v.fail(offset, path, "code with scope length %v does not match its contents", length)
+		}
+		return end, nil
+	case 0x10: // int32
+		return fixed(4)
+	case 0x13: // decimal128
+		return fixed(16)
+	}
+	return 0, v.fail(typeOffset, path, "invalid type byte 0x%02x", kind)
+}
+
+// str checks a length-prefixed, null-terminated UTF-8 string
+func (v *validator) str(offset, limit int, path string) (int, error) {
+	length, err := v.int32At(offset, path)
+	if err != nil {
+		return 0, err
+	}
+	if length < 1 || offset+4+length > limit {
+		return 0, v.fail(offset, path, "invalid string length %v", length)
+	}
+	end := offset + 4 + length
+	if v.data[end-1] != 0 {
+		return 0, v.fail(end-1, path, "string is not null-terminated")
+	}
+	if !utf8.Valid(v.data[offset+4 : end-1]) {
+		return 0, v.fail(offset+4, path, "string is not valid UTF-8")
+	}
+	return end, nil
+}
+
+// cstring checks a null-terminated UTF-8 string
+func (v *validator) cstring(offset, limit int, path string) (int, error) {
+	if offset > limit {
+		return 0, v.fail(offset, path, "value overruns the end of its document")
+	}
+	length := bytes.IndexByte(v.data[offset:limit], 0)
+	if length < 0 {
+		return 0, v.fail(offset, path, "string is not null-terminated")
+	}
+	if !utf8.Valid(v.data[offset : offset+length]) {
+		return 0, v.fail(offset, path, "string is not valid UTF-8")
+	}
+	return offset + length + 1, nil
+}
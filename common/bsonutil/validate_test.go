@@ -0,0 +1,135 @@
+package bsonutil
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestValidateBSON(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	marshal := func(doc interface{}) []byte {
+		data, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		return data
+	}
+	validationError := func(err error) *ValidationError {
+		So(err, ShouldNotBeNil)
+		validationErr, ok := err.(*ValidationError)
+		So(ok, ShouldBeTrue)
+		return validationErr
+	}
+
+	Convey("Validating BSON documents", t, func() {
+
+		Convey("documents with every type should be valid", func() {
+			data := marshal(bson.D{
+				{"_id", bson.NewObjectId()},
+				{"double", 1.5},
+				{"string", "héllo"},
+				{"doc", bson.D{{"a", 1}, {"$ref", "coll"}, {"$id", 2}}},
+				{"array", []interface{}{1, "two", bson.D{{"three", 3}}}},
+				{"binary", bson.Binary{Kind: 0x80, Data: []byte{1, 2, 3}}},
+				{"undefined", bson.Undefined},
+				{"bool", true},
+				{"date", time.Now()},
+				{"null", nil},
+				{"regex", bson.RegEx{Pattern: "^a", Options: "i"}},
+				{"dbpointer", bson.DBPointer{Namespace: "db.c", Id: bson.NewObjectId()}},
+				{"code", bson.JavaScript{Code: "function() {}"}},
+				{"codeWithScope", bson.JavaScript{Code: "x", Scope: bson.M{"x": 1}}},
+				{"symbol", bson.Symbol("sym")},
+				{"int32", int32(1)},
+				{"timestamp", bson.MongoTimestamp(1)},
+				{"int64", int64(1)},
+				{"minKey", bson.MinKey},
+				{"maxKey", bson.MaxKey},
+			})
+			So(ValidateBSON(data, DefaultValidationOptions), ShouldBeNil)
+		})
+
+		Convey("invalid UTF-8 should be found with its offset and path", func() {
+			err := validationError(ValidateBSON(marshal(bson.D{{"a", "x\xff"}}), DefaultValidationOptions))
+			So(err.Offset, ShouldEqual, 11)
+			So(err.Path, ShouldEqual, "a")
+			So(err.Reason, ShouldContainSubstring, "UTF-8")
+
+			err = validationError(ValidateBSON(marshal(bson.D{{"a", bson.D{{"b\xfe", 1}}}}), DefaultValidationOptions))
+			So(err.Path, ShouldEqual, "a.b\xfe")
+			So(err.Reason, ShouldContainSubstring, "UTF-8")
+		})
+
+		Convey("duplicate field names should be invalid", func() {
+			err := validationError(ValidateBSON(marshal(bson.D{{"x", bson.D{{"a", 1}, {"a", 2}}}}),
+				DefaultValidationOptions))
+			So(err.Path, ShouldEqual, "x.a")
+			So(err.Reason, ShouldContainSubstring, "duplicate")
+		})
+
+		Convey("field names with '$' or '.' should only be invalid when not allowed", func() {
+			for _, doc := range []bson.D{{{"$set", 1}}, {{"a", bson.D{{"b.c", 1}}}}} {
+				data := marshal(doc)
+				So(ValidateBSON(data, DefaultValidationOptions), ShouldNotBeNil)
+				options := DefaultValidationOptions
+				options.AllowSpecialFieldNames = true
+				So(ValidateBSON(data, options), ShouldBeNil)
+			}
+		})
+
+		Convey("deeply nested documents should be invalid", func() {
+			doc := bson.D{{"leaf", 1}}
+			for i := 0; i < 5; i++ {
+				doc = bson.D{{"a", doc}}
+			}
+			options := DefaultValidationOptions
+			options.MaxDepth = 6
+			So(ValidateBSON(marshal(doc), options), ShouldBeNil)
+			options.MaxDepth = 5
+			err := validationError(ValidateBSON(marshal(doc), options))
+			So(err.Path, ShouldEqual, "a.a.a.a.a")
+		})
+
+		Convey("documents over the size limit should be invalid", func() {
+			options := DefaultValidationOptions
+			options.MaxSize = 16
+			err := validationError(ValidateBSON(marshal(bson.D{{"a", "this is too long"}}), options))
+			So(err.Offset, ShouldEqual, 0)
+			So(err.Reason, ShouldContainSubstring, "larger than")
+		})
+
+		Convey("invalid type bytes should be found", func() {
+			data := marshal(bson.D{{"a", 1}, {"b", 2}})
+			// the type byte of "b" follows the 4 byte length and the 7 bytes of "a"
+			data[11] = 0x42
+			err := validationError(ValidateBSON(data, DefaultValidationOptions))
+			So(err.Offset, ShouldEqual, 11)
+			So(err.Path, ShouldEqual, "b")
+			So(err.Reason, ShouldContainSubstring, "0x42")
+		})
+
+		Convey("malformed documents should be invalid", func() {
+			data := marshal(bson.D{{"a", "b"}})
+
+			Convey("with a wrong length", func() {
+				truncated := append([]byte{}, data[:len(data)-1]...)
+				So(ValidateBSON(truncated, DefaultValidationOptions), ShouldNotBeNil)
+				So(ValidateBSON(append(data, 0), DefaultValidationOptions), ShouldNotBeNil)
+			})
+
+			Convey("with a string length overrunning the document", func() {
+				data[7] = 100
+				err := validationError(ValidateBSON(data, DefaultValidationOptions))
+				So(err.Path, ShouldEqual, "a")
+			})
+
+			Convey("with an invalid boolean", func() {
+				data := marshal(bson.D{{"a", true}})
+				data[7] = 2
+				So(ValidateBSON(data, DefaultValidationOptions), ShouldNotBeNil)
+			})
+		})
+	})
+}
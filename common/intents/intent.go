@@ -83,6 +83,9 @@ type Manager struct {
 	prioritizer     IntentPrioritizer
 	priotitizerLock *sync.Mutex
 
+	// rules for the UserPriority prioritizer
+	priorityRules []PriorityRule
+
 	// special cases that should be saved but not be part of the queue.
 	// used to deal with oplog and user/roles restoration, which are
 	// handled outside of the basic logic of the tool
@@ -201,6 +204,19 @@ func (manager *Manager) Finish(intent *Intent) {
 	manager.prioritizer.Finish(intent)
 }
 
+// TrackProgress gives the prioritizer a counter of the work done so far on
+// the intent for the given namespace, in the same units as its size, for
+// prioritizers that schedule using the progress of running intents.
+// The counter is only read until the intent is finished, and must be
+// updated with atomic.AddInt64, since it's read while the intent is processed.
+func (manager *Manager) TrackProgress(namespace string, counter *int64) {
+	manager.priotitizerLock.Lock()
+	defer manager.priotitizerLock.Unlock()
+	if tracker, ok := manager.prioritizer.(progressTracker); ok {
+		tracker.TrackProgress(namespace, counter)
+	}
+}
+
 // Oplog returns the intent representing the oplog, which isn't
 // stored with the other intents, because it is dumped and restored in
 // a very different way from other collections.
@@ -228,9 +244,14 @@ func (manager *Manager) AuthVersion() *Intent {
 	return manager.versionIntent
 }
 
-// Finalize processes the intents for prioritization. Currently only two
-// kinds of prioritizers are supported. No more "Put" operations may be done
-// after finalize is called.
+// SetPriorityRules sets the rules used to order intents
+// when the manager is finalized with the UserPriority prioritizer
+func (manager *Manager) SetPriorityRules(rules []PriorityRule) {
+	manager.priorityRules = rules
+}
+
+// Finalize processes the intents for prioritization. No more "Put"
+// operations may be done after finalize is called.
 func (manager *Manager) Finalize(pType PriorityType) {
 	switch pType {
 	case Legacy:
@@ -242,6 +263,12 @@ func (manager *Manager) Finalize(pType PriorityType) {
 	case MultiDatabaseLTF:
 		log.Log(log.DebugHigh, "finalizing intent manager with multi-database longest task first prioritizer")
 		manager.prioritizer = NewMultiDatabaseLTFPrioritizer(manager.intentsByDiscoveryOrder)
+	case UserPriority:
+		log.Log(log.DebugHigh, "finalizing intent manager with user priority prioritizer")
+		manager.prioritizer = NewUserPriorityPrioritizer(manager.intentsByDiscoveryOrder, manager.priorityRules)
+	case AdaptiveThroughput:
+		log.Log(log.DebugHigh, "finalizing intent manager with adaptive throughput prioritizer")
+		manager.prioritizer = NewAdaptivePrioritizer(manager.intentsByDiscoveryOrder)
 	default:
 		panic("cannot initialize IntentPrioritizer with unknown type")
 	}
@@ -2,7 +2,13 @@ package intents
 
 import (
 	"container/heap"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io/ioutil"
 	"sort"
+	"sync/atomic"
+	"time"
 )
 
 type PriorityType int
@@ -11,6 +17,8 @@ const (
 	Legacy PriorityType = iota
 	LongestTaskFirst
 	MultiDatabaseLTF
+	UserPriority
+	AdaptiveThroughput
 )
 
 // IntentPrioritizer encapsulates the logic of scheduling intents
@@ -24,6 +32,12 @@ type IntentPrioritizer interface {
 	Finish(*Intent)
 }
 
+// progressTracker is implemented by prioritizers that schedule intents
+// using the progress of the intents currently being processed
+type progressTracker interface {
+	TrackProgress(namespace string, counter *int64)
+}
+
 //===== Legacy =====
 
 // legacyPrioritizer processes the intents in the order they were read off the
@@ -92,6 +106,124 @@ func (s BySize) Len() int           { return len(s) }
 func (s BySize) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s BySize) Less(i, j int) bool { return s[i].Size > s[j].Size }
 
+//===== User Priority =====
+
+// PriorityRule gives every namespace matching a pattern a priority level.
+// A priority file holds a list of them, e.g.
+//
+//	{"priorities": [
+//		{"ns": "app.config", "priority": 10},
+//		{"ns": "app.lookup*", "priority": 5},
+//		{"ns": "logs.*", "priority": -1}
+//	]}
+//
+// Namespaces take the priority of the first rule they match,
+// and namespaces matching no rules have a priority of 0.
+type PriorityRule struct {
+	Namespace string `json:"ns"`
+	Priority  int    `json:"priority"`
+}
+
+type priorityFile struct {
+	Priorities []PriorityRule `json:"priorities"`
+}
+
+// PriorityRulesFromJSON parses and validates the contents of a priority file
+func PriorityRulesFromJSON(jsonBytes []byte) ([]PriorityRule, error) {
+	file := priorityFile{}
+	err := json.Unmarshal(jsonBytes, &file)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range file.Priorities {
+		if rule.Namespace == "" {
+			return nil, fmt.Errorf("priority rule %v has no namespace", i)
+		}
+		if err = util.ValidateNamespacePattern(rule.Namespace); err != nil {
+			return nil, fmt.Errorf("priority rule %v: %v", i, err)
+		}
+	}
+	return file.Priorities, nil
+}
+
+// ReadPriorityRules reads the priority rules in the given file
+func ReadPriorityRules(filename string) ([]PriorityRule, error) {
+	jsonBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filename, err)
+	}
+	rules, err := PriorityRulesFromJSON(jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", filename, err)
+	}
+	return rules, nil
+}
+
+// IntentPriority returns the priority the rules give an intent
+func IntentPriority(intent *Intent, rules []PriorityRule) int {
+	for _, rule := range rules {
+		// patterns are validated when the rules are read
+		if matches, _ := util.MatchNamespace(rule.Namespace, intent.Key()); matches {
+			return rule.Priority
+		}
+	}
+	return 0
+}
+
+// userPriorityPrioritizer returns intents in order of the priority given to
+// them by user-supplied rules, highest first, and then from largest to smallest
+// like the longest task first prioritizer. This lets small but critical
+// collections be processed before everything else.
+type userPriorityPrioritizer struct {
+	queue []*Intent
+}
+
+// NewUserPriorityPrioritizer returns a prioritizer ordering intents by the given rules
+func NewUserPriorityPrioritizer(intents []*Intent, rules []PriorityRule) *userPriorityPrioritizer {
+	byPriority := &byPriorityThenSize{intents: intents, priorities: make([]int, len(intents))}
+	for i, intent := range intents {
+		byPriority.priorities[i] = IntentPriority(intent, rules)
+	}
+	sort.Stable(byPriority)
+	return &userPriorityPrioritizer{
+		queue: intents,
+	}
+}
+
+func (up *userPriorityPrioritizer) Get() *Intent {
+	var intent *Intent
+
+	if len(up.queue) == 0 {
+		return nil
+	}
+
+	intent, up.queue = up.queue[0], up.queue[1:]
+	return intent
+}
+
+func (up *userPriorityPrioritizer) Finish(*Intent) {
+	// no-op
+	return
+}
+
+// For sorting intents from highest to lowest priority, and then from largest to smallest size
+type byPriorityThenSize struct {
+	intents    []*Intent
+	priorities []int
+}
+
+func (s *byPriorityThenSize) Len() int { return len(s.intents) }
+func (s *byPriorityThenSize) Swap(i, j int) {
+	s.intents[i], s.intents[j] = s.intents[j], s.intents[i]
+	s.priorities[i], s.priorities[j] = s.priorities[j], s.priorities[i]
+}
+func (s *byPriorityThenSize) Less(i, j int) bool {
+	if s.priorities[i] != s.priorities[j] {
+		return s.priorities[i] > s.priorities[j]
+	}
+	return s.intents[i].Size > s.intents[j].Size
+}
+
 //===== Multi Database Longest Task First =====
 
 // multiDatabaseLTF is designed to properly schedule intents with two constraints:
@@ -225,3 +357,189 @@ func (dbh *DBHeap) Pop() interface{} {
 	*dbh = old[0 : n-1]
 	return toPop
 }
+
+//===== Adaptive Throughput =====
+
+// adaptivePrioritizer schedules intents using the throughput observed for each
+// database, in the same units as Intent.Size (bytes for restores, documents
+// for dumps). Throughput is measured from intents reported as finished and
+// from the counters of intents still in progress.
+//
+// Each time an intent is requested, the prioritizer estimates how long each
+// database would take to finish its remaining work with one more job working
+// on it, and picks the largest remaining intent of the database that would take
+// the longest. Slow databases are therefore started early and given more jobs,
+// instead of being left to run alone at the end of the process. Until there is
+// a measured throughput, every database is assumed to have the same rate, so
+// databases are picked by their remaining size divided by their active jobs
+// plus one.
+type adaptivePrioritizer struct {
+	databases map[string]*dbThroughput
+	// intents being processed, by namespace
+	active map[string]*activeIntent
+	// now returns the current time; it is replaced in tests
+	now func() time.Time
+}
+
+// dbThroughput tracks the remaining intents and the throughput of a database
+type dbThroughput struct {
+	name string
+	// remaining intents, largest first
+	queue  []*Intent
+	active int
+	// the amount of work done by finished intents and the time it took
+	processed int64
+	elapsed   time.Duration
+}
+
+// activeIntent is an intent being processed
+type activeIntent struct {
+	intent  *Intent
+	started time.Time
+	// counter of the work done so far, if tracked
+	counter *int64
+}
+
+// NewAdaptivePrioritizer returns a prioritizer that schedules the given
+// intents using the throughput observed for each database
+func NewAdaptivePrioritizer(intents []*Intent) *adaptivePrioritizer {
+	prioritizer := &adaptivePrioritizer{
+		databases: map[string]*dbThroughput{},
+		active:    map[string]*activeIntent{},
+		now:       time.Now,
+	}
+	for _, intent := range intents {
+		db, exists := prioritizer.databases[intent.DB]
+		if !exists {
+			db = &dbThroughput{name: intent.DB}
+			prioritizer.databases[intent.DB] = db
+		}
+		db.queue = append(db.queue, intent)
+	}
+	for _, db := range prioritizer.databases {
+		sort.Stable(BySize(db.queue))
+	}
+	return prioritizer
+}
+
+// Get returns the largest intent of the database estimated to take
+// the longest to finish. Get is not thread safe, and depends on the
+// implementation of the intent manager to lock around it.
+func (ap *adaptivePrioritizer) Get() *Intent {
+	now := ap.now()
+	defaultRate := ap.overallRate(now)
+
+	var next *dbThroughput
+	var nextEstimate float64
+	for _, db := range ap.databases {
+		if len(db.queue) == 0 {
+			continue
+		}
+		estimate := ap.estimateRemaining(db, now, defaultRate)
+		if next == nil || estimate > nextEstimate ||
+			(estimate == nextEstimate && db.queue[0].Size > next.queue[0].Size) {
+			next, nextEstimate = db, estimate
+		}
+	}
+	if next == nil {
+		return nil
+	}
+
+	intent := next.queue[0]
+	next.queue = next.queue[1:]
+	next.active++
+	ap.active[intent.Key()] = &activeIntent{intent: intent, started: now}
+	return intent
+}
+
+// Finish records the throughput of the finished intent. Finish is not thread
+// safe, and depends on the implementation of the intent manager to lock around it.
+func (ap *adaptivePrioritizer) Finish(intent *Intent) {
+	active, ok := ap.active[intent.Key()]
+	if !ok {
+		return
+	}
+	delete(ap.active, intent.Key())
+	db := ap.databases[intent.DB]
+	db.active--
+	db.processed += active.progress(intent.Size)
+	db.elapsed += ap.now().Sub(active.started)
+}
+
+// TrackProgress registers a counter of the work done so far on the intent
+// for the given namespace, so its throughput can be used before it finishes.
+// Namespaces that aren't being processed are ignored.
+func (ap *adaptivePrioritizer) TrackProgress(namespace string, counter *int64) {
+	if active, ok := ap.active[namespace]; ok {
+		active.counter = counter
+	}
+}
+
+// progress returns the work done on an active intent, or, if
+// it isn't tracked, the given amount assumed to have been done
+func (active *activeIntent) progress(untracked int64) int64 {
+	if active.counter == nil {
+		return untracked
+	}
+	return atomic.LoadInt64(active.counter)
+}
+
+// rate returns the throughput of a database per job, in units per second,
+// including the progress of its tracked active intents, or 0 if unknown
+func (ap *adaptivePrioritizer) rate(db *dbThroughput, now time.Time) float64 {
+	processed, elapsed := db.processed, db.elapsed
+	for _, active := range ap.active {
+		if active.intent.DB == db.name && active.counter != nil {
+			processed += atomic.LoadInt64(active.counter)
+			elapsed += now.Sub(active.started)
+		}
+	}
+	if processed <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(processed) / elapsed.Seconds()
+}
+
+// overallRate returns the throughput per job across all databases,
+// or 1 if nothing has been measured, so that estimates fall back to sizes
+func (ap *adaptivePrioritizer) overallRate(now time.Time) float64 {
+	var processed int64
+	var elapsed time.Duration
+	for _, db := range ap.databases {
+		processed += db.processed
+		elapsed += db.elapsed
+	}
+	for _, active := range ap.active {
+		if active.counter != nil {
+			processed += atomic.LoadInt64(active.counter)
+			elapsed += now.Sub(active.started)
+		}
+	}
+	if processed <= 0 || elapsed <= 0 {
+		return 1
+	}
+	return float64(processed) / elapsed.Seconds()
+}
+
+// estimateRemaining returns the estimated number of seconds a database
+// would take to finish its remaining work with one more active job
+func (ap *adaptivePrioritizer) estimateRemaining(db *dbThroughput, now time.Time, defaultRate float64) float64 {
+	remaining := int64(0)
+	for _, intent := range db.queue {
+		remaining += intent.Size
+	}
+	rate := ap.rate(db, now)
+	if rate == 0 {
+		rate = defaultRate
+	}
+	for _, active := range ap.active {
+		if active.intent.DB != db.name {
+			continue
+		}
+		done := active.progress(int64(rate * now.Sub(active.started).Seconds()))
+		if left := active.intent.Size - done; left > 0 {
+			remaining += left
+		}
+	}
+	return float64(remaining) / rate / float64(db.active+1)
+}
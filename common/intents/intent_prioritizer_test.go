@@ -4,7 +4,9 @@ import (
 	"container/heap"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLegacyPrioritizer(t *testing.T) {
@@ -174,3 +176,165 @@ func TestSimulatedMultiDBJob(t *testing.T) {
 		})
 	})
 }
+
+func TestUserPriorityPrioritizer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With priority rules read from a priority file", t, func() {
+		rules, err := PriorityRulesFromJSON([]byte(`{"priorities": [
+			{"ns": "app.config", "priority": 10},
+			{"ns": "app.lookup*", "priority": 5},
+			{"ns": "logs.*", "priority": -1}
+		]}`))
+		So(err, ShouldBeNil)
+		So(len(rules), ShouldEqual, 3)
+
+		Convey("intents should take the priority of the first matching rule", func() {
+			So(IntentPriority(&Intent{DB: "app", C: "config"}, rules), ShouldEqual, 10)
+			So(IntentPriority(&Intent{DB: "app", C: "lookupCountries"}, rules), ShouldEqual, 5)
+			So(IntentPriority(&Intent{DB: "logs", C: "access"}, rules), ShouldEqual, -1)
+			So(IntentPriority(&Intent{DB: "app", C: "orders"}, rules), ShouldEqual, 0)
+		})
+
+		Convey("intents should be ordered by priority and then by size", func() {
+			prioritizer := NewUserPriorityPrioritizer([]*Intent{
+				&Intent{DB: "logs", C: "access", Size: 5000},
+				&Intent{DB: "app", C: "orders", Size: 100},
+				&Intent{DB: "app", C: "lookupStates", Size: 10},
+				&Intent{DB: "app", C: "users", Size: 200},
+				&Intent{DB: "app", C: "config", Size: 1},
+				&Intent{DB: "app", C: "lookupCountries", Size: 20},
+			}, rules)
+			order := []string{}
+			for intent := prioritizer.Get(); intent != nil; intent = prioritizer.Get() {
+				order = append(order, intent.Key())
+			}
+			So(order, ShouldResemble, []string{
+				"app.config",
+				"app.lookupCountries",
+				"app.lookupStates",
+				"app.users",
+				"app.orders",
+				"logs.access",
+			})
+		})
+	})
+
+	Convey("Invalid priority files should be an error", t, func() {
+		_, err := PriorityRulesFromJSON([]byte(`{"priorities": [{"priority": 1}]}`))
+		So(err, ShouldNotBeNil)
+		_, err = PriorityRulesFromJSON([]byte(`{"priorities": [{"ns": "app.[", "priority": 1}]}`))
+		So(err, ShouldNotBeNil)
+		_, err = PriorityRulesFromJSON([]byte(`{"priorities": `))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAdaptivePrioritizer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With an adaptive prioritizer and a controllable clock", t, func() {
+		now := time.Unix(0, 0)
+		newPrioritizer := func(intents []*Intent) *adaptivePrioritizer {
+			prioritizer := NewAdaptivePrioritizer(intents)
+			prioritizer.now = func() time.Time { return now }
+			return prioritizer
+		}
+
+		Convey("without observed throughput, intents should be scheduled like multiDatabaseLTF", func() {
+			prioritizer := newPrioritizer([]*Intent{
+				&Intent{DB: "a", C: "small", Size: 10},
+				&Intent{DB: "a", C: "large", Size: 1000},
+				&Intent{DB: "b", C: "medium", Size: 600},
+			})
+			So(prioritizer.Get().Key(), ShouldEqual, "a.large")
+			// a's 1010 left would be shared by two jobs, so b's 600 left comes first
+			So(prioritizer.Get().Key(), ShouldEqual, "b.medium")
+			So(prioritizer.Get().Key(), ShouldEqual, "a.small")
+			So(prioritizer.Get(), ShouldBeNil)
+		})
+
+		Convey("a slow database should be given work before a fast one of the same size", func() {
+			prioritizer := newPrioritizer([]*Intent{
+				&Intent{DB: "fast", C: "c1", Size: 100},
+				&Intent{DB: "fast", C: "c2", Size: 100},
+				&Intent{DB: "fast", C: "c3", Size: 100},
+				&Intent{DB: "slow", C: "c1", Size: 100},
+				&Intent{DB: "slow", C: "c2", Size: 100},
+				&Intent{DB: "slow", C: "c3", Size: 100},
+			})
+			first := prioritizer.Get()
+			second := prioritizer.Get()
+			So(first.DB, ShouldNotEqual, second.DB)
+			fast, slow := first, second
+			if first.DB == "slow" {
+				fast, slow = second, first
+			}
+
+			// the fast database does 100 per second, the slow one 10 per second
+			now = now.Add(time.Second)
+			prioritizer.Finish(fast)
+			now = now.Add(9 * time.Second)
+			prioritizer.Finish(slow)
+
+			next := []string{prioritizer.Get().DB, prioritizer.Get().DB, prioritizer.Get().DB}
+			So(next, ShouldResemble, []string{"slow", "slow", "fast"})
+		})
+
+		Convey("the progress of running intents should be used before they finish", func() {
+			prioritizer := newPrioritizer([]*Intent{
+				&Intent{DB: "a", C: "c1", Size: 1000},
+				&Intent{DB: "a", C: "c2", Size: 100},
+				&Intent{DB: "b", C: "c1", Size: 1000},
+				&Intent{DB: "b", C: "c2", Size: 100},
+			})
+			var progressA, progressB int64
+			first := prioritizer.Get()
+			second := prioritizer.Get()
+			So(first.C, ShouldEqual, "c1")
+			So(second.C, ShouldEqual, "c1")
+			prioritizer.TrackProgress("a.c1", &progressA)
+			prioritizer.TrackProgress("b.c1", &progressB)
+			prioritizer.TrackProgress("c.unknown", &progressB)
+
+			// a is nearly done, while b has barely started
+			now = now.Add(10 * time.Second)
+			progressA, progressB = 900, 100
+			So(prioritizer.Get().Key(), ShouldEqual, "b.c2")
+		})
+
+		Convey("progress counters should be safe to update while intents are scheduled", func() {
+			manager := NewCategorizingIntentManager()
+			for _, db := range []string{"a", "b"} {
+				for _, c := range []string{"c1", "c2", "c3"} {
+					manager.Put(&Intent{DB: db, C: c, BSONPath: db + "/" + c + ".bson", Size: 1000})
+				}
+			}
+			manager.Finalize(AdaptiveThroughput)
+			var progress int64
+			running := manager.Pop()
+			manager.TrackProgress(running.Key(), &progress)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 1000; i++ {
+					atomic.AddInt64(&progress, 1)
+				}
+			}()
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				manager.Finish(intent)
+			}
+			<-done
+			manager.Finish(running)
+			So(atomic.LoadInt64(&progress), ShouldEqual, 1000)
+		})
+
+		Convey("finishing an intent that wasn't scheduled should be ignored", func() {
+			prioritizer := newPrioritizer([]*Intent{&Intent{DB: "a", C: "c", Size: 1}})
+			prioritizer.Finish(&Intent{DB: "b", C: "c"})
+			So(prioritizer.Get().Key(), ShouldEqual, "a.c")
+		})
+	})
+}
@@ -36,6 +36,7 @@ func (manager *Manager) Attach(pb *ProgressBar) {
 		panic("cannot attach a nameless bar to a progress bar manager")
 	}
 	pb.validate()
+	pb.begin()
 
 	manager.barsLock.Lock()
 	defer manager.barsLock.Unlock()
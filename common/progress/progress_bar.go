@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,8 +35,26 @@ type ProgressBar struct {
 	Writer io.Writer
 	// WaitTime is the time to wait between writing the bar
 	WaitTime time.Duration
+	// IsBytes formats the counter and the total as sizes in bytes
+	IsBytes bool
+	// Counters are other counts written after the bar, such as the number
+	// of documents processed while the bar counts bytes
+	Counters []Counter
+	// ShowRates writes the average rates of the counter and of the Counters
+	// since the bar was started, and the estimated time left to reach Max
+	ShowRates bool
+
+	stopChan    chan struct{}
+	startTime   time.Time
+	startCounts []int64
+}
 
-	stopChan chan struct{}
+// Counter is a named count written along with a ProgressBar
+type Counter struct {
+	// Name is the unit of the count, e.g. "docs"
+	Name string
+	// CounterPtr is a pointer to the count, which is read periodically
+	CounterPtr *int64
 }
 
 // Start starts the ProgressBar goroutine. Once Start is called, a bar will
@@ -43,6 +63,7 @@ type ProgressBar struct {
 // must be set up before calling this. Panics if Start has already been called.
 func (pb *ProgressBar) Start() {
 	pb.validate()
+	pb.begin()
 	pb.stopChan = make(chan struct{})
 
 	go pb.start()
@@ -60,6 +81,23 @@ func (pb *ProgressBar) validate() {
 	if pb.stopChan != nil {
 		panic("Cannot start a ProgressBar more than once")
 	}
+	for _, counter := range pb.Counters {
+		if counter.CounterPtr == nil {
+			panic("Cannot use a ProgressBar Counter with an unset CounterPtr")
+		}
+	}
+}
+
+// begin records the time and the counts the bar's rates are computed from,
+// so that counts that don't start at zero, such as those of a resumed task,
+// don't inflate them
+func (pb *ProgressBar) begin() {
+	pb.startTime = time.Now()
+	pb.startCounts = make([]int64, len(pb.Counters)+1)
+	pb.startCounts[0] = atomic.LoadInt64(pb.CounterPtr)
+	for i, counter := range pb.Counters {
+		pb.startCounts[i+1] = atomic.LoadInt64(counter.CounterPtr)
+	}
 }
 
 // Stop kills the ProgressBar goroutine, stopping it from writing.
@@ -71,17 +109,78 @@ func (pb *ProgressBar) Stop() {
 	close(pb.stopChan)
 }
 
-// computes all necessary values renders to the bar's Writer
+// computes all necessary values renders to the bar's Writer. A bar with
+// no Max is written as a plain count, since its progress is unknown.
 func (pb *ProgressBar) renderToWriter() {
-	currentCount := *pb.CounterPtr
-	percent := float64(currentCount) / float64(pb.Max)
-	fmt.Fprintf(pb.Writer, "%v %v\t%d/%d (%2.1f%%)",
-		drawBar(pb.BarLength, percent),
-		pb.Name,
-		currentCount,
-		pb.Max,
-		percent*100,
-	)
+	currentCount := atomic.LoadInt64(pb.CounterPtr)
+	var line bytes.Buffer
+	if pb.Max > 0 {
+		percent := float64(currentCount) / float64(pb.Max)
+		fmt.Fprintf(&line, "%v %v\t%v/%v (%2.1f%%)",
+			drawBar(pb.BarLength, percent),
+			pb.Name,
+			pb.formatCount(currentCount),
+			pb.formatCount(pb.Max),
+			percent*100,
+		)
+	} else {
+		fmt.Fprintf(&line, "%v\t%v", pb.Name, pb.formatCount(currentCount))
+	}
+
+	counts := make([]int64, len(pb.Counters))
+	for i, counter := range pb.Counters {
+		counts[i] = atomic.LoadInt64(counter.CounterPtr)
+		fmt.Fprintf(&line, ", %d %v", counts[i], counter.Name)
+	}
+
+	if pb.ShowRates && len(pb.startCounts) == len(pb.Counters)+1 {
+		elapsed := time.Since(pb.startTime).Seconds()
+		if elapsed > 0 {
+			rate := float64(currentCount-pb.startCounts[0]) / elapsed
+			rates := []string{pb.formatRate(rate)}
+			for i, counter := range pb.Counters {
+				rates = append(rates, fmt.Sprintf("%.0f %v/sec",
+					float64(counts[i]-pb.startCounts[i+1])/elapsed, counter.Name))
+			}
+			if pb.Max > 0 && rate > 0 && currentCount < pb.Max {
+				eta := time.Duration(float64(pb.Max-currentCount) / rate * float64(time.Second))
+				rates = append(rates, fmt.Sprintf("ETA %v", (eta+time.Second/2)/time.Second*time.Second))
+			}
+			fmt.Fprintf(&line, " (%v)", strings.Join(rates, ", "))
+		}
+	}
+	pb.Writer.Write(line.Bytes())
+}
+
+// formatCount formats a count of the bar, as a size if the bar counts bytes
+func (pb *ProgressBar) formatCount(count int64) string {
+	if pb.IsBytes {
+		return formatBytes(float64(count))
+	}
+	return fmt.Sprintf("%d", count)
+}
+
+// formatRate formats the rate per second of the bar's counter
+func (pb *ProgressBar) formatRate(rate float64) string {
+	if pb.IsBytes {
+		return fmt.Sprintf("%v/sec", formatBytes(rate))
+	}
+	return fmt.Sprintf("%.0f/sec", rate)
+}
+
+// formatBytes formats a number of bytes in the largest unit it's at least
+// one of, e.g. "512B" or "3.4MB"
+func formatBytes(size float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f%v", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f%v", size, units[unit])
 }
 
 // the main concurrent loop
@@ -135,3 +135,56 @@ func TestBarDrawing(t *testing.T) {
 		})
 	})
 }
+
+func TestBarRendering(t *testing.T) {
+	var bytesCounter, docsCounter int64
+	writeBuffer := &bytes.Buffer{}
+
+	Convey("With a ProgressBar counting bytes and documents", t, func() {
+		writeBuffer.Reset()
+		bytesCounter, docsCounter = 1024, 0
+		pbar := &ProgressBar{
+			Name:       "TEST",
+			Max:        4 * 1024 * 1024,
+			CounterPtr: &bytesCounter,
+			Writer:     writeBuffer,
+			BarLength:  10,
+			IsBytes:    true,
+			Counters:   []Counter{{Name: "docs", CounterPtr: &docsCounter}},
+			ShowRates:  true,
+		}
+		pbar.begin()
+
+		Convey("the counts should be written as sizes, with the rates since it began and an ETA", func() {
+			pbar.startTime = time.Now().Add(-2 * time.Second)
+			bytesCounter, docsCounter = 1024+2100*1024, 100
+			pbar.renderToWriter()
+			results := writeBuffer.String()
+			So(results, ShouldContainSubstring, "2.1MB/4.0MB (51.3%)")
+			So(results, ShouldContainSubstring, ", 100 docs")
+			So(results, ShouldContainSubstring, "1.0MB/sec")
+			So(results, ShouldContainSubstring, "50 docs/sec")
+			So(results, ShouldContainSubstring, "ETA 2s")
+		})
+		Convey("a bar without a Max should only be written as a count", func() {
+			pbar.Max = 0
+			pbar.renderToWriter()
+			results := writeBuffer.String()
+			So(results, ShouldStartWith, "TEST\t1.0KB, 0 docs")
+			So(results, ShouldNotContainSubstring, BarLeft)
+			So(results, ShouldNotContainSubstring, "ETA")
+		})
+		Convey("a Counter without a CounterPtr should panic", func() {
+			pbar.Counters = []Counter{{Name: "docs"}}
+			So(func() { pbar.Start() }, ShouldPanic)
+		})
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	Convey("Sizes should be formatted in the largest unit they're at least one of", t, func() {
+		So(formatBytes(512), ShouldEqual, "512B")
+		So(formatBytes(1536), ShouldEqual, "1.5KB")
+		So(formatBytes(3*1024*1024*1024), ShouldEqual, "3.0GB")
+	})
+}
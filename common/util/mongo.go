@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"path"
 	"strings"
 )
 
@@ -81,6 +82,26 @@ func SplitAndValidateNamespace(namespace string) (string, string, error) {
 	return database, collection, nil
 }
 
+// MatchNamespace reports whether the namespace matches the given pattern.
+// Patterns use shell-style wildcards, so "test.*" matches every collection
+// in the "test" database and "*.orders" matches "orders" in any database.
+// An error is returned if the pattern is malformed.
+func MatchNamespace(pattern, namespace string) (bool, error) {
+	return path.Match(pattern, namespace)
+}
+
+// ValidateNamespacePattern returns an error if the pattern could
+// not be used with MatchNamespace.
+func ValidateNamespacePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty namespace pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid namespace pattern '%v': %v", pattern, err)
+	}
+	return nil
+}
+
 // ValidateFullNamespace validates a full mongodb namespace (database +
 // collection), returning an error if it is invalid.
 func ValidateFullNamespace(namespace string) error {
@@ -108,3 +108,46 @@ func TestInvalidNames(t *testing.T) {
 	})
 
 }
+
+func TestMatchNamespace(t *testing.T) {
+
+	testutil.VerifyTestType(t, "unit")
+
+	Convey("When matching namespaces against patterns", t, func() {
+
+		Convey("an exact pattern should only match its own namespace", func() {
+			match, err := MatchNamespace("test.orders", "test.orders")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeTrue)
+			match, err = MatchNamespace("test.orders", "test.ordersArchive")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeFalse)
+		})
+
+		Convey("a database wildcard should match all of its collections", func() {
+			match, err := MatchNamespace("test.*", "test.orders")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeTrue)
+			match, err = MatchNamespace("test.*", "test.system.indexes")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeTrue)
+			match, err = MatchNamespace("test.*", "other.orders")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeFalse)
+		})
+
+		Convey("a collection wildcard should match across databases", func() {
+			match, err := MatchNamespace("*.orders", "shop.orders")
+			So(err, ShouldBeNil)
+			So(match, ShouldBeTrue)
+		})
+
+		Convey("malformed patterns should be rejected", func() {
+			So(ValidateNamespacePattern("test.[orders"), ShouldNotBeNil)
+			So(ValidateNamespacePattern(""), ShouldNotBeNil)
+			So(ValidateNamespacePattern("test.*"), ShouldBeNil)
+		})
+
+	})
+
+}
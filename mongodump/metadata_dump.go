@@ -7,6 +7,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 )
@@ -16,8 +17,19 @@ import (
 // Metadata JSON is read in by mongorestore to properly recreate
 // collections with the proper options and indexes.
 type Metadata struct {
-	Options bson.M        `json:"options,omitempty"`
-	Indexes []interface{} `json:"indexes"`
+	Options  bson.M            `json:"options,omitempty"`
+	Indexes  []interface{}     `json:"indexes"`
+	Sharding *ShardingMetadata `json:"sharding,omitempty"`
+}
+
+// ShardingMetadata holds the shard key and chunk ranges of a sharded
+// collection, as read from config.collections and config.chunks. It is
+// only dumped through mongos, and allows mongorestore to shard and
+// pre-split the collection before inserting into it.
+type ShardingMetadata struct {
+	Key    interface{}   `json:"key"`
+	Unique bool          `json:"unique,omitempty"`
+	Chunks []interface{} `json:"chunks"`
 }
 
 // IndexDocumentFromDB is used internally to preserve key ordering
@@ -90,6 +102,15 @@ func (dump *MongoDump) dumpMetadataToWriter(dbName, c string, writer io.Writer)
 		meta.Indexes = append(meta.Indexes, convertedIndex)
 	}
 
+	// When dumping through mongos, we also save how the collection is sharded
+	if dump.isMongos {
+		log.Logf(log.DebugHigh, "\treading sharding information for `%v`", nsID)
+		meta.Sharding, err = getShardingMetadata(session, nsID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Finally, we send the results to the writer as JSON bytes
 	jsonBytes, err := json.Marshal(meta)
 	if err != nil {
@@ -105,3 +126,53 @@ func (dump *MongoDump) dumpMetadataToWriter(dbName, c string, writer io.Writer)
 	}
 	return nil
 }
+
+// getShardingMetadata reads the shard key and chunks of a collection from the
+// config database. It returns nil if the collection is not sharded.
+func getShardingMetadata(session *mgo.Session, nsID string) (*ShardingMetadata, error) {
+	collectionInfo := struct {
+		Key     bson.D `bson:"key"`
+		Unique  bool   `bson:"unique"`
+		Dropped bool   `bson:"dropped"`
+	}{}
+	err := session.DB("config").C("collections").Find(bson.M{"_id": nsID}).One(&collectionInfo)
+	if err == mgo.ErrNotFound || collectionInfo.Dropped {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading sharding information for `%v`: %v", nsID, err)
+	}
+
+	key, err := bsonutil.ConvertBSONValueToJSON(collectionInfo.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error converting shard key of `%v`: %v", nsID, err)
+	}
+	sharding := &ShardingMetadata{
+		Key:    key,
+		Unique: collectionInfo.Unique,
+		Chunks: []interface{}{},
+	}
+
+	chunk := struct {
+		Min   bson.D `bson:"min"`
+		Max   bson.D `bson:"max"`
+		Shard string `bson:"shard"`
+	}{}
+	iter := session.DB("config").C("chunks").Find(bson.M{"ns": nsID}).Sort("min").Iter()
+	for iter.Next(&chunk) {
+		convertedChunk, err := bsonutil.ConvertBSONValueToJSON(bson.D{
+			{"min", chunk.Min},
+			{"max", chunk.Max},
+			{"shard", chunk.Shard},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error converting chunk (%#v): %v", chunk, err)
+		}
+		sharding.Chunks = append(sharding.Chunks, convertedChunk)
+	}
+	if err = iter.Close(); err != nil {
+		return nil, fmt.Errorf("error reading chunks for `%v`: %v", nsID, err)
+	}
+	log.Logf(log.DebugLow, "	found %v chunks for sharded collection `%v`", len(sharding.Chunks), nsID)
+	return sharding, nil
+}
@@ -16,6 +16,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
@@ -70,6 +71,8 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--db is required when --excludeCollectionsWithPrefix is specified")
 	case dump.OutputOptions.Repair && dump.InputOptions.Query != "":
 		return fmt.Errorf("cannot run a query with --repair enabled")
+	case dump.OutputOptions.AdaptiveScheduling && dump.OutputOptions.PriorityFile != "":
+		return fmt.Errorf("cannot use --adaptiveScheduling with --priorityFile")
 	}
 	return nil
 }
@@ -98,6 +101,13 @@ func (dump *MongoDump) Init() error {
 		return fmt.Errorf("--repair flag cannot be used on a mongos")
 	}
 	dump.manager = intents.NewIntentManager()
+	if dump.OutputOptions.PriorityFile != "" {
+		rules, err := intents.ReadPriorityRules(dump.OutputOptions.PriorityFile)
+		if err != nil {
+			return fmt.Errorf("error reading --priorityFile: %v", err)
+		}
+		dump.manager.SetPriorityRules(rules)
+	}
 	dump.progressManager = progress.NewProgressBarManager(ProgressBarWaitTime)
 	return nil
 }
@@ -279,7 +289,11 @@ func (dump *MongoDump) DumpIntents() error {
 	if jobs <= 0 {
 		jobs = 1
 	}
-	if jobs > 1 {
+	if dump.OutputOptions.PriorityFile != "" {
+		dump.manager.Finalize(intents.UserPriority)
+	} else if dump.OutputOptions.AdaptiveScheduling {
+		dump.manager.Finalize(intents.AdaptiveThroughput)
+	} else if jobs > 1 {
 		dump.manager.Finalize(intents.LongestTaskFirst)
 	} else {
 		dump.manager.Finalize(intents.Legacy)
@@ -422,6 +436,7 @@ func (dump *MongoDump) dumpQueryToWriter(
 	}
 	dump.progressManager.Attach(bar)
 	defer dump.progressManager.Detach(bar)
+	dump.manager.TrackProgress(intent.Key(), &dumpCounter)
 
 	// We run the result iteration in its own goroutine,
 	// this allows disk i/o to not block reads from the db,
@@ -475,7 +490,7 @@ func (dump *MongoDump) dumpIterToWriter(
 		if err != nil {
 			return fmt.Errorf("error writing to file: %v", err)
 		}
-		*counterPtr++
+		atomic.AddInt64(counterPtr, 1)
 	}
 	err := w.Flush()
 	if err != nil {
@@ -19,6 +19,8 @@ type OutputOptions struct {
 	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"Dump user and role definitions for the given database"`
 	ExcludedCollections        []string `long:"excludeCollection" description:"Collections to exclude from the dump"`
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" description:"Exclude all collections from the dump that have the given prefix"`
+	PriorityFile               string   `long:"priorityFile" description:"Dump collections in order of the priorities given to namespace patterns in the given JSON file, and then by size"`
+	AdaptiveScheduling         bool     `long:"adaptiveScheduling" description:"Choose the next collection to dump using the throughput observed for each database, instead of only collection sizes"`
 }
 
 func (self *OutputOptions) Name() string {
@@ -0,0 +1,256 @@
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkpointInterval is how often the --checkpointFile is saved
+const checkpointInterval = 10 * time.Second
+
+// Checkpoint is the position in an input file up to which every record has
+// been imported, as saved in the --checkpointFile
+type Checkpoint struct {
+	// File is the input file
+	File string `json:"file"`
+	// Offset is the byte offset of the end of the last record imported
+	Offset int64 `json:"offset"`
+	// Records is the number of records read up to the offset
+	Records uint64 `json:"records"`
+}
+
+// LoadCheckpoint reads the checkpoint saved in the file with the given name
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint file: %v", err)
+	}
+	checkpoint := &Checkpoint{}
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %v: %v", filename, err)
+	}
+	return checkpoint, nil
+}
+
+// positionedDoc is implemented by the ConvertibleDocs of input that can be
+// resumed, which know the number of their record and where it ends
+type positionedDoc interface {
+	position() (record uint64, offset int64)
+}
+
+// resumableReader is implemented by the InputReaders of input that can be
+// resumed from a checkpoint
+type resumableReader interface {
+	InputReader
+
+	// columnSpecs returns the columns of the records, as read from the header
+	columnSpecs() []ColumnSpec
+
+	// resumeAt sets the columns of the records, and continues the record
+	// numbers and byte offsets of an input read from the checkpoint on
+	resumeAt(colSpecs []ColumnSpec, checkpoint Checkpoint)
+}
+
+// checkpointTracker keeps the checkpoint of an import up to date as its
+// records are acknowledged, and periodically saves it to the --checkpointFile.
+// Records are acknowledged once they're written or rejected, and can be
+// acknowledged out of order when documents are decoded or written
+// concurrently, so the checkpoint only advances past records once all the
+// records before them have been acknowledged too. A nil *checkpointTracker
+// tracks nothing.
+type checkpointTracker struct {
+	filename string
+
+	lock       sync.Mutex
+	checkpoint Checkpoint
+	saved      Checkpoint
+	// pending holds the offsets of the acknowledged records after the checkpoint
+	pending map[uint64]int64
+
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// newCheckpointTracker returns a checkpointTracker that saves to the named
+// file, starting from the given checkpoint
+func newCheckpointTracker(filename string, start Checkpoint) *checkpointTracker {
+	return &checkpointTracker{
+		filename:   filename,
+		checkpoint: start,
+		pending:    map[uint64]int64{},
+	}
+}
+
+// acknowledge marks the records of the given sources as imported
+func (tracker *checkpointTracker) acknowledge(sources ...ConvertibleDoc) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	for _, source := range sources {
+		positioned, ok := source.(positionedDoc)
+		if !ok {
+			continue
+		}
+		record, offset := positioned.position()
+		if record > tracker.checkpoint.Records {
+			tracker.pending[record] = offset
+		}
+	}
+	for {
+		offset, ok := tracker.pending[tracker.checkpoint.Records+1]
+		if !ok {
+			return
+		}
+		delete(tracker.pending, tracker.checkpoint.Records+1)
+		tracker.checkpoint.Records++
+		tracker.checkpoint.Offset = offset
+	}
+}
+
+// current returns the current checkpoint
+func (tracker *checkpointTracker) current() Checkpoint {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.checkpoint
+}
+
+// save writes the current checkpoint to the checkpoint file, if it has
+// changed since it was last saved. The file is replaced as a whole, so
+// that it isn't left incomplete if mongoimport is killed.
+func (tracker *checkpointTracker) save() error {
+	checkpoint := tracker.current()
+	if checkpoint == tracker.saved {
+		return nil
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	filename := util.ToUniversalPath(tracker.filename)
+	if err = ioutil.WriteFile(filename+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("error writing checkpoint file: %v", err)
+	}
+	if err = os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("error writing checkpoint file: %v", err)
+	}
+	tracker.saved = checkpoint
+	log.Logf(log.DebugLow, "saved checkpoint at record #%v (byte %v)", checkpoint.Records, checkpoint.Offset)
+	return nil
+}
+
+// Start saves the checkpoint periodically until Stop is called
+func (tracker *checkpointTracker) Start() {
+	if tracker == nil {
+		return
+	}
+	tracker.stopChan = make(chan struct{})
+	tracker.doneChan = make(chan struct{})
+	go func() {
+		defer close(tracker.doneChan)
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := tracker.save(); err != nil {
+					log.Logf(log.Always, "%v", err)
+				}
+			case <-tracker.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops saving the checkpoint periodically, and saves it a last time
+func (tracker *checkpointTracker) Stop() error {
+	if tracker == nil {
+		return nil
+	}
+	if tracker.stopChan != nil {
+		close(tracker.stopChan)
+		<-tracker.doneChan
+	}
+	if err := tracker.save(); err != nil {
+		return err
+	}
+	checkpoint := tracker.current()
+	log.Logf(log.Always, "checkpoint saved to %v: imported through record #%v (byte %v) of %v",
+		tracker.filename, checkpoint.Records, checkpoint.Offset, checkpoint.File)
+	return nil
+}
+
+// openResumedInputReader returns an InputReader for the records of the input
+// after the --resume checkpoint, given an InputReader that has read the
+// header at the start of the input. Plain files are read from the offset of
+// the checkpoint on; compressed input, or input in another encoding, is read
+// up to it first, since the offset is that of the records as parsed.
+func (mongoImport *MongoImport) openResumedInputReader(headerReader InputReader) (InputReader, io.Closer, error) {
+	checkpoint := *mongoImport.resumeFrom
+	header, ok := headerReader.(resumableReader)
+	if !ok {
+		return nil, nil, fmt.Errorf("only CSV and TSV input can be resumed")
+	}
+
+	file, err := os.Open(util.ToUniversalPath(mongoImport.InputOptions.File))
+	if err != nil {
+		return nil, nil, err
+	}
+	start := make([]byte, 10)
+	numRead, _ := file.ReadAt(start, 0)
+
+	var in io.Reader
+	var source io.Closer
+	encoding := mongoImport.InputOptions.Encoding
+	if detectCompression(start[:numRead]) == "" && (encoding == "" || encoding == UTF8) {
+		if _, err = file.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("error seeking to byte %v of the input: %v", checkpoint.Offset, err)
+		}
+		fileStat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		mongoImport.inputSize = fileStat.Size()
+		atomic.StoreInt64(&mongoImport.bytesRead, checkpoint.Offset)
+		counter := &countingReader{file, &mongoImport.bytesRead}
+		in, source = counter, counter
+	} else {
+		file.Close()
+		atomic.StoreInt64(&mongoImport.bytesRead, 0)
+		sourceReader, err := mongoImport.getSourceReader()
+		if err != nil {
+			return nil, nil, err
+		}
+		if in, err = newDecodingReader(sourceReader, mongoImport.InputOptions.Encoding); err != nil {
+			sourceReader.Close()
+			return nil, nil, err
+		}
+		if _, err = io.CopyN(ioutil.Discard, in, checkpoint.Offset); err != nil {
+			sourceReader.Close()
+			return nil, nil, fmt.Errorf("error reading to byte %v of the input: %v", checkpoint.Offset, err)
+		}
+		source = sourceReader
+	}
+
+	inputReader, err := mongoImport.newInputReader(in)
+	if err != nil {
+		source.Close()
+		return nil, nil, err
+	}
+	inputReader.(resumableReader).resumeAt(header.columnSpecs(), checkpoint)
+	log.Logf(log.Always, "resuming after record #%v (byte %v) of %v",
+		checkpoint.Records, checkpoint.Offset, checkpoint.File)
+	return inputReader, source, nil
+}
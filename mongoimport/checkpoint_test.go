@@ -0,0 +1,209 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamPositions returns the documents and the positions of the
+// records of an input reader
+func streamPositions(inputReader InputReader) ([]bson.D, [][2]int64, error) {
+	docChan := make(chan ConvertedDoc, 10)
+	errChan := make(chan error)
+	go inputReader.StreamDocument(true, docChan, errChan)
+	documents := []bson.D{}
+	positions := [][2]int64{}
+	for convertedDoc := range docChan {
+		record, offset := convertedDoc.Source.(positionedDoc).position()
+		documents = append(documents, convertedDoc.Document)
+		positions = append(positions, [2]int64{int64(record), offset})
+	}
+	return documents, positions, <-errChan
+}
+
+func TestRecordPositions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("CSV records should know where they end, including "+
+		"quoted newlines and \\r\\n line endings", t, func() {
+		contents := "a,1\n\"b\nb\",2\r\n# comment\nc,3"
+		format := &CSVFormat{Delimiter: ',', Quote: '"', CommentPrefix: "#"}
+		r := NewCSVInputReader(ParseAutoHeaders([]string{"x", "y"}), bytes.NewReader([]byte(contents)), 1, nil, format, nil)
+		_, positions, err := streamPositions(r)
+		So(err, ShouldBeNil)
+		So(positions, ShouldResemble, [][2]int64{{1, 4}, {2, 13}, {3, 26}})
+	})
+	Convey("TSV records should know where they end, including comment lines", t, func() {
+		contents := "a\t1\n# comment\nb\t2\r\nc\t3\n"
+		r := NewTSVInputReader(ParseAutoHeaders([]string{"x", "y"}), bytes.NewReader([]byte(contents)), 1, nil, "#", nil)
+		_, positions, err := streamPositions(r)
+		So(err, ShouldBeNil)
+		So(positions, ShouldResemble, [][2]int64{{1, 4}, {2, 19}, {3, 23}})
+	})
+}
+
+func TestCheckpointTracker(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	dir, err := ioutil.TempDir("", "mongoimport_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Convey("With a checkpoint tracker", t, func() {
+		filename := filepath.Join(dir, "checkpoint.json")
+		tracker := newCheckpointTracker(filename, Checkpoint{File: "in.csv", Offset: 10, Records: 2})
+		record := func(number uint64, offset int64) ConvertibleDoc {
+			return CSVConvertibleDoc{numProcessed: number, offset: offset}
+		}
+
+		Convey("the checkpoint should only advance past records acknowledged in sequence", func() {
+			tracker.acknowledge(record(4, 40), record(5, 50))
+			So(tracker.current(), ShouldResemble, Checkpoint{File: "in.csv", Offset: 10, Records: 2})
+			tracker.acknowledge(record(3, 30))
+			So(tracker.current(), ShouldResemble, Checkpoint{File: "in.csv", Offset: 50, Records: 5})
+			tracker.acknowledge(record(7, 70), record(2, 20))
+			So(tracker.current(), ShouldResemble, Checkpoint{File: "in.csv", Offset: 50, Records: 5})
+		})
+		Convey("records without positions should be ignored", func() {
+			tracker.acknowledge(JSONConvertibleDoc{numProcessed: 3}, record(3, 30))
+			So(tracker.current().Records, ShouldEqual, 3)
+		})
+		Convey("the saved checkpoint should be loaded again", func() {
+			tracker.acknowledge(record(3, 30))
+			So(tracker.save(), ShouldBeNil)
+			checkpoint, err := LoadCheckpoint(filename)
+			So(err, ShouldBeNil)
+			So(*checkpoint, ShouldResemble, Checkpoint{File: "in.csv", Offset: 30, Records: 3})
+		})
+		Convey("stopping should save the checkpoint", func() {
+			tracker.Start()
+			tracker.acknowledge(record(3, 30))
+			So(tracker.Stop(), ShouldBeNil)
+			checkpoint, err := LoadCheckpoint(filename)
+			So(err, ShouldBeNil)
+			So(checkpoint.Records, ShouldEqual, 3)
+		})
+	})
+	Convey("A nil checkpoint tracker should track nothing", t, func() {
+		var tracker *checkpointTracker
+		tracker.acknowledge(CSVConvertibleDoc{numProcessed: 1})
+		tracker.Start()
+		So(tracker.Stop(), ShouldBeNil)
+	})
+}
+
+func TestResumeImport(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a mongoimport instance resuming a CSV file with a header line", t, func() {
+		mongoImport, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		mongoImport.InputOptions.Type = CSV
+		mongoImport.InputOptions.HeaderLine = true
+		mongoImport.InputOptions.File = "testdata/test_resume.csv"
+		mongoImport.InputOptions.Encoding = UTF8
+		mongoImport.resumeFrom = &Checkpoint{File: mongoImport.InputOptions.File, Offset: 11, Records: 1}
+		expected := []bson.D{
+			{{"name", "b\nb"}, {"n", 2}},
+			{{"name", "c"}, {"n", 3}},
+		}
+
+		Convey("the records after the checkpoint should be read with the fields of the header", func() {
+			inputReader, source, err := mongoImport.openInputReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			documents, positions, err := streamPositions(inputReader)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, expected)
+			So(positions, ShouldResemble, [][2]int64{{2, 20}, {3, 24}})
+		})
+		Convey("compressed input should be read up to the checkpoint", func() {
+			mongoImport.InputOptions.File = "testdata/test_resume.csv.gz"
+			inputReader, source, err := mongoImport.openInputReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			documents, positions, err := streamPositions(inputReader)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, expected)
+			So(positions, ShouldResemble, [][2]int64{{2, 20}, {3, 24}})
+		})
+		Convey("a checkpoint at the end of the input should leave nothing to read", func() {
+			mongoImport.resumeFrom = &Checkpoint{File: mongoImport.InputOptions.File, Offset: 24, Records: 3}
+			inputReader, source, err := mongoImport.openInputReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			documents, _, err := streamPositions(inputReader)
+			So(err, ShouldBeNil)
+			So(documents, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestResumeAfterParseFailure(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	dir, err := ioutil.TempDir("", "mongoimport_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inputFile := filepath.Join(dir, "in.csv")
+	contents := "name.string(),n.int32()\na,1\nb,x\nc,3\n"
+	if err = ioutil.WriteFile(inputFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With a mongoimport instance importing a CSV file with a value that fails to parse", t, func() {
+		mongoImport, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		mongoImport.InputOptions.Type = CSV
+		mongoImport.InputOptions.HeaderLine = true
+		mongoImport.InputOptions.ColumnsHaveTypes = true
+		mongoImport.InputOptions.File = inputFile
+		mongoImport.checkpoints = newCheckpointTracker(filepath.Join(dir, "checkpoint.json"), Checkpoint{File: inputFile})
+
+		// importRecords acknowledges the records that convert, as if they were
+		// inserted, and rejects the others, up to an error that stops the import
+		importRecords := func() error {
+			inputReader, source, err := mongoImport.openInputReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			docChan := make(chan ConvertedDoc)
+			errChan := make(chan error)
+			go inputReader.StreamDocument(true, docChan, errChan)
+			for convertedDoc := range docChan {
+				if convertedDoc.Err != nil {
+					So(mongoImport.rejectRecord(convertedDoc), ShouldBeNil)
+				} else {
+					mongoImport.checkpoints.acknowledge(convertedDoc.Source)
+				}
+			}
+			return <-errChan
+		}
+
+		Convey("the checkpoint should stop before a record that stopped the import", func() {
+			So(importRecords(), ShouldNotBeNil)
+			checkpoint := mongoImport.checkpoints.current()
+			So(checkpoint.Records, ShouldEqual, 1)
+
+			Convey("so that resuming reads it again", func() {
+				mongoImport.resumeFrom = &checkpoint
+				mongoImport.parseGrace, err = NewParseGrace(SkipRow)
+				So(err, ShouldBeNil)
+				So(importRecords(), ShouldBeNil)
+				So(mongoImport.checkpoints.current().Records, ShouldEqual, 3)
+			})
+		})
+		Convey("a record written to the rejects file should count towards the checkpoint", func() {
+			mongoImport.rejects = NewRejectsWriter(&bytes.Buffer{})
+			mongoImport.parseGrace, err = NewParseGrace(SkipRow)
+			So(err, ShouldBeNil)
+			So(importRecords(), ShouldBeNil)
+			So(mongoImport.checkpoints.current().Records, ShouldEqual, 3)
+			So(mongoImport.rejects.Count(), ShouldEqual, 1)
+		})
+	})
+}
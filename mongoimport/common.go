@@ -15,12 +15,28 @@ import (
 	"sync"
 )
 
-// ConvertibleDoc is an interface that adds the basic Convert method.
+// ConvertibleDoc is an interface that adds the basic Convert and Record methods.
 //
 // Convert returns a valid BSON document that has been converted by the
-// underlying implementation. If conversion fails, err will be set.
+// underlying implementation. If conversion fails, err will be set. If the
+// document should be skipped, as with --parseGrace=skipRow, err is a
+// skippedRowError.
+//
+// Record returns the 1-based number of the input record the document is
+// converted from, not counting any header line, and the record in its
+// original form, used to report rejected records.
 type ConvertibleDoc interface {
 	Convert() (bson.D, error)
+	Record() (uint64, string)
+}
+
+// ConvertedDoc is the result of converting a ConvertibleDoc: the BSON document
+// and the ConvertibleDoc it was converted from. If conversion failed, or the
+// document was skipped, Err is set and Document is nil.
+type ConvertedDoc struct {
+	Document bson.D
+	Source   ConvertibleDoc
+	Err      error
 }
 
 // An ImportWorker reads ConvertibleDoc from the unprocessedDataChan channel and
@@ -30,19 +46,21 @@ type ImportWorker struct {
 	unprocessedDataChan chan ConvertibleDoc
 
 	// used to stream the processed document back to the caller
-	processedDocumentChan chan bson.D
+	processedDocumentChan chan ConvertedDoc
 
 	// used to synchronise all worker goroutines
 	tomb *tomb.Tomb
 }
 
-// constructUpsertDocument constructs a BSON document to use for upserts
-func constructUpsertDocument(upsertFields []string, document bson.M) bson.M {
-	upsertDocument := bson.M{}
+// constructUpsertDocument constructs a BSON document to use for upserts,
+// with the upsert fields in the order they are given
+func constructUpsertDocument(upsertFields []string, document bson.D) bson.D {
+	upsertDocument := bson.D{}
 	var hasDocumentKey bool
 	for _, key := range upsertFields {
-		upsertDocument[key] = getUpsertValue(key, document)
-		if upsertDocument[key] != nil {
+		value := getUpsertValue(key, document)
+		upsertDocument = append(upsertDocument, bson.DocElem{key, value})
+		if value != nil {
 			hasDocumentKey = true
 		}
 	}
@@ -56,7 +74,7 @@ func constructUpsertDocument(upsertFields []string, document bson.M) bson.M {
 // an outputChan (output) channel. It sequentially writes unprocessed data read from
 // the input channel to each worker and then sequentially reads the processed data
 // from each worker before passing it on to the output channel
-func doSequentialStreaming(workers []*ImportWorker, readDocChan chan ConvertibleDoc, outputChan chan bson.D) {
+func doSequentialStreaming(workers []*ImportWorker, readDocChan chan ConvertibleDoc, outputChan chan ConvertedDoc) {
 	numWorkers := len(workers)
 
 	// feed in the data to be processed and do round-robin
@@ -111,22 +129,23 @@ func getParsedValue(token string) interface{} {
 // getUpsertValue takes a given BSON document and a given field, and returns the
 // field's associated value in the document. The field is specified using dot
 // notation for nested fields. e.g. "person.age" would return 34 would return
-// 34 in the document: bson.M{"person": bson.M{"age": 34}} whereas,
+// 34 in the document: bson.D{{"person", bson.D{{"age", 34}}}} whereas,
 // "person.name" would return nil
-func getUpsertValue(field string, document bson.M) interface{} {
+func getUpsertValue(field string, document bson.D) interface{} {
 	index := strings.Index(field, ".")
 	if index == -1 {
-		return document[field]
+		value, _ := bsonutil.FindValueByKey(field, &document)
+		return value
 	}
 	left := field[0:index]
-	if document[left] == nil {
-		return nil
-	}
-	subDoc, ok := document[left].(bson.M)
-	if !ok {
-		return nil
+	value, _ := bsonutil.FindValueByKey(left, &document)
+	switch subDoc := value.(type) {
+	case bson.D:
+		return getUpsertValue(field[index+1:], subDoc)
+	case *bson.D:
+		return getUpsertValue(field[index+1:], *subDoc)
 	}
-	return getUpsertValue(field[index+1:], subDoc)
+	return nil
 }
 
 // filterIngestError accepts a boolean indicating if a non-nil error should be,
@@ -196,7 +215,7 @@ func setNestedValue(key string, value interface{}, document *bson.D) {
 // channel in parallel and then sends over the processed data to the outputChan
 // channel - either in sequence or concurrently (depending on the value of
 // ordered) - in which the data was received
-func streamDocuments(ordered bool, numDecoders int, readDocChan chan ConvertibleDoc, outputChan chan bson.D) (retErr error) {
+func streamDocuments(ordered bool, numDecoders int, readDocChan chan ConvertibleDoc, outputChan chan ConvertedDoc) (retErr error) {
 	if numDecoders == 0 {
 		numDecoders = 1
 	}
@@ -208,7 +227,7 @@ func streamDocuments(ordered bool, numDecoders int, readDocChan chan Convertible
 	for i := 0; i < numDecoders; i++ {
 		if ordered {
 			inChan = make(chan ConvertibleDoc, workerBufferSize)
-			outChan = make(chan bson.D, workerBufferSize)
+			outChan = make(chan ConvertedDoc, workerBufferSize)
 		}
 		importWorker := &ImportWorker{
 			unprocessedDataChan:   inChan,
@@ -237,29 +256,79 @@ func streamDocuments(ordered bool, numDecoders int, readDocChan chan Convertible
 	return
 }
 
-// tokensToBSON reads in slice of records - along with ordered fields names -
-// and returns a BSON document for the record.
-func tokensToBSON(fields, tokens []string, numProcessed uint64) (bson.D, error) {
+// tokensToBSON reads in slice of records - along with ordered column
+// specifications - and returns a BSON document for the record. Blank tokens
+// are left as empty strings rather than parsed, so --ignoreBlanks can remove them.
+// Values that fail to parse are handled according to parseGrace, and columns
+// are renamed, dropped and added to according to the field mapping.
+func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, parseGrace *ParseGrace, mapping *FieldMapping) (bson.D, error) {
 	log.Logf(log.DebugHigh, "got line: %v", tokens)
 	var parsedValue interface{}
+	var err error
 	document := bson.D{}
 	for index, token := range tokens {
-		parsedValue = getParsedValue(token)
-		if index < len(fields) {
-			if strings.Index(fields[index], ".") != -1 {
-				setNestedValue(fields[index], parsedValue, &document)
+		if index < len(colSpecs) {
+			colSpec := colSpecs[index]
+			target, ok := mapping.target(colSpec.Name)
+			if !ok {
+				continue
+			}
+			if token == "" {
+				parsedValue = token
+			} else if parsedValue, err = colSpec.Parser.Parse(token); err != nil {
+				err = fmt.Errorf("error parsing row #%v, column #%v (%v): %v",
+					numProcessed, index+1, colSpec.Name, err)
+				action, err := parseGrace.onParseError(err)
+				if err != nil {
+					return nil, err
+				}
+				if action == dropField {
+					continue
+				}
+				parsedValue = token
+			}
+			if mapping != nil {
+				if err = setMappedValue(&document, target, parsedValue); err != nil {
+					return nil, fmt.Errorf("error mapping row #%v: %v", numProcessed, err)
+				}
+			} else if strings.Index(colSpec.Name, ".") != -1 {
+				setNestedValue(colSpec.Name, parsedValue, &document)
 			} else {
-				document = append(document, bson.DocElem{fields[index], parsedValue})
+				document = append(document, bson.DocElem{colSpec.Name, parsedValue})
 			}
 		} else {
+			parsedValue = getParsedValue(token)
 			key := "field" + strconv.Itoa(index)
-			if util.StringSliceContains(fields, key) {
+			if util.StringSliceContains(ColumnNames(colSpecs), key) {
 				return nil, fmt.Errorf("Duplicate field name - on %v - for token #%v ('%v') in document #%v",
 					key, index+1, parsedValue, numProcessed)
 			}
-			document = append(document, bson.DocElem{key, parsedValue})
+			target, ok := mapping.target(key)
+			if !ok {
+				continue
+			}
+			if err = setMappedValue(&document, target, parsedValue); err != nil {
+				return nil, fmt.Errorf("error mapping row #%v: %v", numProcessed, err)
+			}
 		}
 	}
+	document, err = mapping.finish(document, func(name string) (string, bool) {
+		for index, colSpec := range colSpecs {
+			if colSpec.Name == name && index < len(tokens) {
+				return tokens[index], true
+			}
+		}
+		if strings.HasPrefix(name, "field") {
+			index, err := strconv.Atoi(strings.TrimPrefix(name, "field"))
+			if err == nil && index >= len(colSpecs) && index < len(tokens) {
+				return tokens[index], true
+			}
+		}
+		return "", false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error mapping row #%v: %v", numProcessed, err)
+	}
 	return document, nil
 }
 
@@ -302,11 +371,15 @@ func validateFields(fields []string) error {
 	return nil
 }
 
-// validateReaderFields is a helper to validate fields for input readers
-func validateReaderFields(fields []string) error {
+// validateReaderFields is a helper to validate fields for input readers,
+// along with the fields they're imported as with the field mapping
+func validateReaderFields(fields []string, mapping *FieldMapping) error {
 	if err := validateFields(fields); err != nil {
 		return err
 	}
+	if err := mapping.validateColumns(fields); err != nil {
+		return err
+	}
 	if len(fields) == 1 {
 		log.Logf(log.Info, "using field: %v", fields[0])
 	} else {
@@ -318,7 +391,7 @@ func validateReaderFields(fields []string) error {
 // processDocuments reads from the ConvertibleDoc channel and for each record, converts it
 // to a bson.D document before sending it on the processedDocumentChan channel. Once the
 // input channel is closed the processed channel is also closed if the worker streams its
-// reads in order
+// reads in order. Records that fail to convert are also sent on, so they can be rejected.
 func (importWorker *ImportWorker) processDocuments(ordered bool) error {
 	if ordered {
 		defer close(importWorker.processedDocumentChan)
@@ -330,10 +403,14 @@ func (importWorker *ImportWorker) processDocuments(ordered bool) error {
 				return nil
 			}
 			document, err := convertibleDoc.Convert()
-			if err != nil {
+			importWorker.processedDocumentChan <- ConvertedDoc{
+				Document: document,
+				Source:   convertibleDoc,
+				Err:      err,
+			}
+			if _, skipped := err.(skippedRowError); err != nil && !skipped {
 				return err
 			}
-			importWorker.processedDocumentChan <- document
 		case <-importWorker.tomb.Dying():
 			return nil
 		}
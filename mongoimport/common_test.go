@@ -23,29 +23,29 @@ var (
 	numProcessed       = uint64(0)
 	csvConvertibleDocs = []CSVConvertibleDoc{
 		CSVConvertibleDoc{
-			fields:       []string{"field1", "field2", "field3"},
+			colSpecs:     ParseAutoHeaders([]string{"field1", "field2", "field3"}),
 			data:         []string{"a", "b", "c"},
-			numProcessed: &numProcessed,
+			numProcessed: numProcessed,
 		},
 		CSVConvertibleDoc{
-			fields:       []string{"field4", "field5", "field6"},
+			colSpecs:     ParseAutoHeaders([]string{"field4", "field5", "field6"}),
 			data:         []string{"d", "e", "f"},
-			numProcessed: &numProcessed,
+			numProcessed: numProcessed,
 		},
 		CSVConvertibleDoc{
-			fields:       []string{"field7", "field8", "field9"},
+			colSpecs:     ParseAutoHeaders([]string{"field7", "field8", "field9"}),
 			data:         []string{"d", "e", "f"},
-			numProcessed: &numProcessed,
+			numProcessed: numProcessed,
 		},
 		CSVConvertibleDoc{
-			fields:       []string{"field10", "field11", "field12"},
+			colSpecs:     ParseAutoHeaders([]string{"field10", "field11", "field12"}),
 			data:         []string{"d", "e", "f"},
-			numProcessed: &numProcessed,
+			numProcessed: numProcessed,
 		},
 		CSVConvertibleDoc{
-			fields:       []string{"field13", "field14", "field15"},
+			colSpecs:     ParseAutoHeaders([]string{"field13", "field14", "field15"}),
 			data:         []string{"d", "e", "f"},
-			numProcessed: &numProcessed,
+			numProcessed: numProcessed,
 		},
 	}
 	expectedDocuments = []bson.D{
@@ -129,27 +129,32 @@ func TestGetUpsertValue(t *testing.T) {
 	Convey("Given a field and a BSON document, on calling getUpsertValue", t, func() {
 		Convey("the value of the key should be correct for unnested "+
 			"documents", func() {
-			bsonDocument := bson.M{"a": 3}
+			bsonDocument := bson.D{{"a", 3}}
 			So(getUpsertValue("a", bsonDocument), ShouldEqual, 3)
 		})
 		Convey("the value of the key should be correct for nested "+
 			"document fields", func() {
-			bsonDocument := bson.M{"a": bson.M{"b": 4}}
+			bsonDocument := bson.D{{"a", bson.D{{"b", 4}}}}
+			So(getUpsertValue("a.b", bsonDocument), ShouldEqual, 4)
+		})
+		Convey("the value of the key should be correct for nested "+
+			"document fields set by setNestedValue", func() {
+			bsonDocument := bson.D{{"a", &bson.D{{"b", 4}}}}
 			So(getUpsertValue("a.b", bsonDocument), ShouldEqual, 4)
 		})
 		Convey("the value of the key should be nil for unnested document "+
 			"fields that do not exist", func() {
-			bsonDocument := bson.M{"a": 4}
+			bsonDocument := bson.D{{"a", 4}}
 			So(getUpsertValue("c", bsonDocument), ShouldBeNil)
 		})
 		Convey("the value of the key should be nil for nested document "+
 			"fields that do not exist", func() {
-			bsonDocument := bson.M{"a": bson.M{"b": 4}}
+			bsonDocument := bson.D{{"a", bson.D{{"b", 4}}}}
 			So(getUpsertValue("a.c", bsonDocument), ShouldBeNil)
 		})
 		Convey("the value of the key should be nil for nil document"+
 			"values", func() {
-			So(getUpsertValue("a", bson.M{"a": nil}), ShouldBeNil)
+			So(getUpsertValue("a", bson.D{{"a", nil}}), ShouldBeNil)
 		})
 	})
 }
@@ -161,7 +166,7 @@ func TestConstructUpsertDocument(t *testing.T) {
 		"constructUpsertDocument", t, func() {
 		Convey("the key/value combination in the upsert document should be "+
 			"correct for unnested documents with single fields", func() {
-			bsonDocument := bson.M{"a": 3}
+			bsonDocument := bson.D{{"a", 3}}
 			upsertFields := []string{"a"}
 			upsertDocument := constructUpsertDocument(upsertFields,
 				bsonDocument)
@@ -169,25 +174,33 @@ func TestConstructUpsertDocument(t *testing.T) {
 		})
 		Convey("the key/value combination in the upsert document should be "+
 			"correct for unnested documents with several fields", func() {
-			bsonDocument := bson.M{"a": 3, "b": "string value"}
+			bsonDocument := bson.D{{"a", 3}, {"b", "string value"}}
 			upsertFields := []string{"a"}
-			expectedDocument := bson.M{"a": 3}
+			expectedDocument := bson.D{{"a", 3}}
 			upsertDocument := constructUpsertDocument(upsertFields,
 				bsonDocument)
 			So(upsertDocument, ShouldResemble, expectedDocument)
 		})
 		Convey("the key/value combination in the upsert document should be "+
 			"correct for nested documents with several fields", func() {
-			bsonDocument := bson.M{"a": bson.M{testCollection: 4}, "b": "string value"}
+			bsonDocument := bson.D{{"a", bson.D{{testCollection, 4}}}, {"b", "string value"}}
 			upsertFields := []string{"a.c"}
-			expectedDocument := bson.M{"a.c": 4}
+			expectedDocument := bson.D{{"a.c", 4}}
+			upsertDocument := constructUpsertDocument(upsertFields,
+				bsonDocument)
+			So(upsertDocument, ShouldResemble, expectedDocument)
+		})
+		Convey("the upsert document should keep the order of the upsert fields", func() {
+			bsonDocument := bson.D{{"a", 3}, {"b", 4}, {"c", 5}}
+			upsertFields := []string{"c", "a"}
+			expectedDocument := bson.D{{"c", 5}, {"a", 3}}
 			upsertDocument := constructUpsertDocument(upsertFields,
 				bsonDocument)
 			So(upsertDocument, ShouldResemble, expectedDocument)
 		})
 		Convey("the upsert document should be nil if the key does not exist "+
 			"in the BSON document", func() {
-			bsonDocument := bson.M{"a": 3, "b": "string value"}
+			bsonDocument := bson.D{{"a", 3}, {"b", "string value"}}
 			upsertFields := []string{testCollection}
 			upsertDocument := constructUpsertDocument(upsertFields,
 				bsonDocument)
@@ -296,7 +309,7 @@ func TestTokensToBSON(t *testing.T) {
 				bson.DocElem{"b", 2},
 				bson.DocElem{"c", "hello"},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, numProcessed)
+			bsonD, err := tokensToBSON(ParseAutoHeaders(fields), tokens, numProcessed, nil, nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
@@ -312,7 +325,7 @@ func TestTokensToBSON(t *testing.T) {
 				bson.DocElem{"field3", "mongodb"},
 				bson.DocElem{"field4", "user"},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, numProcessed)
+			bsonD, err := tokensToBSON(ParseAutoHeaders(fields), tokens, numProcessed, nil, nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
@@ -320,7 +333,7 @@ func TestTokensToBSON(t *testing.T) {
 			fields := []string{"a", "b", "field3"}
 			tokens := []string{"1", "2", "hello", "mongodb", "user"}
 			numProcessed := uint64(0)
-			_, err := tokensToBSON(fields, tokens, numProcessed)
+			_, err := tokensToBSON(ParseAutoHeaders(fields), tokens, numProcessed, nil, nil)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("fields with nested values should be set appropriately", func() {
@@ -334,7 +347,7 @@ func TestTokensToBSON(t *testing.T) {
 					bson.DocElem{"a", "hello"},
 				}},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, numProcessed)
+			bsonD, err := tokensToBSON(ParseAutoHeaders(fields), tokens, numProcessed, nil, nil)
 			So(err, ShouldBeNil)
 			So(expectedDocument[0].Name, ShouldResemble, bsonD[0].Name)
 			So(expectedDocument[0].Value, ShouldResemble, bsonD[0].Value)
@@ -343,6 +356,44 @@ func TestTokensToBSON(t *testing.T) {
 			So(expectedDocument[2].Name, ShouldResemble, bsonD[2].Name)
 			So(expectedDocument[2].Value, ShouldResemble, *bsonD[2].Value.(*bson.D))
 		})
+		Convey("typed columns should be parsed with their types", func() {
+			colSpecs, err := ParseTypedHeaders([]string{"zip.string()", "age.int32()", "price.double()"})
+			So(err, ShouldBeNil)
+			tokens := []string{"01234", "42", "5"}
+			numProcessed := uint64(0)
+			expectedDocument := bson.D{
+				bson.DocElem{"zip", "01234"},
+				bson.DocElem{"age", int32(42)},
+				bson.DocElem{"price", float64(5)},
+			}
+			bsonD, err := tokensToBSON(colSpecs, tokens, numProcessed, nil, nil)
+			So(err, ShouldBeNil)
+			So(bsonD, ShouldResemble, expectedDocument)
+		})
+		Convey("blank values of typed columns should be left as empty strings", func() {
+			colSpecs, err := ParseTypedHeaders([]string{"a.int32()", "b.boolean()"})
+			So(err, ShouldBeNil)
+			tokens := []string{"", "true"}
+			numProcessed := uint64(0)
+			expectedDocument := bson.D{
+				bson.DocElem{"a", ""},
+				bson.DocElem{"b", true},
+			}
+			bsonD, err := tokensToBSON(colSpecs, tokens, numProcessed, nil, nil)
+			So(err, ShouldBeNil)
+			So(bsonD, ShouldResemble, expectedDocument)
+		})
+		Convey("an error naming the row and column should be returned if a value "+
+			"does not match the type of its column", func() {
+			colSpecs, err := ParseTypedHeaders([]string{"a.string()", "age.int32()"})
+			So(err, ShouldBeNil)
+			tokens := []string{"x", "forty-two"}
+			numProcessed := uint64(7)
+			_, err = tokensToBSON(colSpecs, tokens, numProcessed, nil, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "row #7")
+			So(err.Error(), ShouldContainSubstring, "column #2 (age)")
+		})
 	})
 }
 
@@ -353,14 +404,14 @@ func TestProcessDocuments(t *testing.T) {
 		numProcessed := uint64(0)
 		csvConvertibleDocs := []CSVConvertibleDoc{
 			CSVConvertibleDoc{
-				fields:       []string{"field1", "field2", "field3"},
+				colSpecs:     ParseAutoHeaders([]string{"field1", "field2", "field3"}),
 				data:         []string{"a", "b", "c"},
-				numProcessed: &numProcessed,
+				numProcessed: numProcessed,
 			},
 			CSVConvertibleDoc{
-				fields:       []string{"field4", "field5", "field6"},
+				colSpecs:     ParseAutoHeaders([]string{"field4", "field5", "field6"}),
 				data:         []string{"d", "e", "f"},
-				numProcessed: &numProcessed,
+				numProcessed: numProcessed,
 			},
 		}
 		expectedDocuments := []bson.D{
@@ -378,7 +429,7 @@ func TestProcessDocuments(t *testing.T) {
 		Convey("processDocuments should execute the expected conversion for documents, "+
 			"pass then on the output channel, and close the input channel if ordered is true", func() {
 			inputChannel := make(chan ConvertibleDoc, 100)
-			outputChannel := make(chan bson.D, 100)
+			outputChannel := make(chan ConvertedDoc, 100)
 			importWorker := &ImportWorker{
 				unprocessedDataChan:   inputChannel,
 				processedDocumentChan: outputChannel,
@@ -389,10 +440,10 @@ func TestProcessDocuments(t *testing.T) {
 			close(inputChannel)
 			So(importWorker.processDocuments(true), ShouldBeNil)
 			doc1, open := <-outputChannel
-			So(doc1, ShouldResemble, expectedDocuments[0])
+			So(doc1.Document, ShouldResemble, expectedDocuments[0])
 			So(open, ShouldEqual, true)
 			doc2, open := <-outputChannel
-			So(doc2, ShouldResemble, expectedDocuments[1])
+			So(doc2.Document, ShouldResemble, expectedDocuments[1])
 			So(open, ShouldEqual, true)
 			_, open = <-outputChannel
 			So(open, ShouldEqual, false)
@@ -400,7 +451,7 @@ func TestProcessDocuments(t *testing.T) {
 		Convey("processDocuments should execute the expected conversion for documents, "+
 			"pass then on the output channel, and leave the input channel open if ordered is false", func() {
 			inputChannel := make(chan ConvertibleDoc, 100)
-			outputChannel := make(chan bson.D, 100)
+			outputChannel := make(chan ConvertedDoc, 100)
 			importWorker := &ImportWorker{
 				unprocessedDataChan:   inputChannel,
 				processedDocumentChan: outputChannel,
@@ -411,10 +462,10 @@ func TestProcessDocuments(t *testing.T) {
 			close(inputChannel)
 			So(importWorker.processDocuments(false), ShouldBeNil)
 			doc1, open := <-outputChannel
-			So(doc1, ShouldResemble, expectedDocuments[0])
+			So(doc1.Document, ShouldResemble, expectedDocuments[0])
 			So(open, ShouldEqual, true)
 			doc2, open := <-outputChannel
-			So(doc2, ShouldResemble, expectedDocuments[1])
+			So(doc2.Document, ShouldResemble, expectedDocuments[1])
 			So(open, ShouldEqual, true)
 			// close will throw a runtime error if outputChannel is already closed
 			close(outputChannel)
@@ -427,14 +478,14 @@ func TestDoSequentialStreaming(t *testing.T) {
 
 	Convey("Given some import workers, a ConvertibleDocs input channel and an bson.D output channel", t, func() {
 		inputChannel := make(chan ConvertibleDoc, 5)
-		outputChannel := make(chan bson.D, 5)
+		outputChannel := make(chan ConvertedDoc, 5)
 		workerInputChannel := []chan ConvertibleDoc{
 			make(chan ConvertibleDoc),
 			make(chan ConvertibleDoc),
 		}
-		workerOutputChannel := []chan bson.D{
-			make(chan bson.D),
-			make(chan bson.D),
+		workerOutputChannel := []chan ConvertedDoc{
+			make(chan ConvertedDoc),
+			make(chan ConvertedDoc),
 		}
 		importWorkers := []*ImportWorker{
 			&ImportWorker{
@@ -460,7 +511,7 @@ func TestDoSequentialStreaming(t *testing.T) {
 			close(inputChannel)
 			doSequentialStreaming(importWorkers, inputChannel, outputChannel)
 			for _, document := range expectedDocuments {
-				So(<-outputChannel, ShouldResemble, document)
+				So((<-outputChannel).Document, ShouldResemble, document)
 			}
 		})
 	})
@@ -474,7 +525,7 @@ func TestStreamDocuments(t *testing.T) {
 			3. an output channel where processed documents are streamed out`, t, func() {
 
 		inputChannel := make(chan ConvertibleDoc, 5)
-		outputChannel := make(chan bson.D, 5)
+		outputChannel := make(chan ConvertedDoc, 5)
 
 		Convey("the entire pipeline should complete without error under normal circumstances", func() {
 			// stream in some documents
@@ -486,16 +537,16 @@ func TestStreamDocuments(t *testing.T) {
 
 			// ensure documents are streamed out and processed in the correct manner
 			for _, expectedDocument := range expectedDocuments {
-				So(<-outputChannel, ShouldResemble, expectedDocument)
+				So((<-outputChannel).Document, ShouldResemble, expectedDocument)
 			}
 		})
 		Convey("the entire pipeline should complete with error if an error is encountered", func() {
 			// stream in some documents - create duplicate headers to simulate an error
 			numProcessed := uint64(0)
 			csvConvertibleDoc := CSVConvertibleDoc{
-				fields:       []string{"field1", "field2"},
+				colSpecs:     ParseAutoHeaders([]string{"field1", "field2"}),
 				data:         []string{"a", "b", "c"},
-				numProcessed: &numProcessed,
+				numProcessed: numProcessed,
 			}
 			inputChannel <- csvConvertibleDoc
 			close(inputChannel)
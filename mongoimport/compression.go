@@ -0,0 +1,76 @@
+package mongoimport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compression constants, as detected from the start of the input
+const (
+	Gzip  = "gzip"
+	Bzip2 = "bzip2"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	// a bzip2 stream starts with "BZh", the block size from 1 to 9, and
+	// the magic number of either its first block or the end of the stream
+	bzip2Magic            = []byte("BZh")
+	bzip2BlockMagic       = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndOfStreamMagic = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// detectCompression returns the compression of the data starting with
+// the given bytes, or an empty string if it isn't compressed
+func detectCompression(start []byte) string {
+	if bytes.HasPrefix(start, gzipMagic) {
+		return Gzip
+	}
+	if len(start) >= 10 && bytes.HasPrefix(start, bzip2Magic) && start[3] >= '1' && start[3] <= '9' {
+		if bytes.Equal(start[4:10], bzip2BlockMagic) || bytes.Equal(start[4:10], bzip2EndOfStreamMagic) {
+			return Bzip2
+		}
+	}
+	return ""
+}
+
+// decompressingReader reads the decompressed data of its source, closing
+// the decompressor along with the source
+type decompressingReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (reader *decompressingReader) Close() error {
+	var err error
+	for _, closer := range reader.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// newDecompressingReader returns a reader for the source that transparently
+// decompresses gzip or bzip2 data, detected by its magic bytes, along with
+// the compression detected. Uncompressed data is read as it is.
+func newDecompressingReader(source io.ReadCloser) (io.ReadCloser, string, error) {
+	buffered := bufio.NewReader(source)
+	// a short or empty input can't be compressed, so errors are left to the first read
+	start, _ := buffered.Peek(10)
+	switch compression := detectCompression(start); compression {
+	case Gzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading gzip input: %v", err)
+		}
+		return &decompressingReader{gzipReader, []io.Closer{gzipReader, source}}, compression, nil
+	case Bzip2:
+		return &decompressingReader{bzip2.NewReader(buffered), []io.Closer{source}}, compression, nil
+	}
+	return &decompressingReader{buffered, []io.Closer{source}}, "", nil
+}
@@ -0,0 +1,68 @@
+package mongoimport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetectCompression(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With the start of some input", t, func() {
+		Convey("gzip data should be detected by its magic bytes", func() {
+			So(detectCompression([]byte{0x1f, 0x8b, 0x08, 0x00}), ShouldEqual, Gzip)
+		})
+		Convey("bzip2 data should be detected by its header and block magic", func() {
+			start := append([]byte("BZh9"), bzip2BlockMagic...)
+			So(detectCompression(start), ShouldEqual, Bzip2)
+		})
+		Convey("text that happens to start like bzip2 data should not be detected", func() {
+			So(detectCompression([]byte("BZh9,name,age\n")), ShouldEqual, "")
+		})
+		Convey("plain and short input should not be detected", func() {
+			So(detectCompression([]byte(`{"a":1}`)), ShouldEqual, "")
+			So(detectCompression([]byte{0x1f}), ShouldEqual, "")
+			So(detectCompression(nil), ShouldEqual, "")
+		})
+	})
+}
+
+func TestDecompressingReader(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a decompressing reader", t, func() {
+		Convey("gzip input should be decompressed", func() {
+			compressed := &bytes.Buffer{}
+			gzipWriter := gzip.NewWriter(compressed)
+			_, err := gzipWriter.Write([]byte("a,b,c\n1,2,3\n"))
+			So(err, ShouldBeNil)
+			So(gzipWriter.Close(), ShouldBeNil)
+
+			reader, compression, err := newDecompressingReader(ioutil.NopCloser(compressed))
+			So(err, ShouldBeNil)
+			So(compression, ShouldEqual, Gzip)
+			contents, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "a,b,c\n1,2,3\n")
+			So(reader.Close(), ShouldBeNil)
+		})
+		Convey("uncompressed input should be read as it is", func() {
+			reader, compression, err := newDecompressingReader(
+				ioutil.NopCloser(bytes.NewBufferString("a,b,c\n")))
+			So(err, ShouldBeNil)
+			So(compression, ShouldEqual, "")
+			contents, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "a,b,c\n")
+		})
+		Convey("empty input should be read as it is", func() {
+			reader, _, err := newDecompressingReader(ioutil.NopCloser(&bytes.Buffer{}))
+			So(err, ShouldBeNil)
+			contents, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(len(contents), ShouldEqual, 0)
+		})
+	})
+}
@@ -11,8 +11,8 @@ import (
 // CSV input source
 type CSVInputReader struct {
 
-	// Fields is a list of field names in the BSON documents to be imported
-	Fields []string
+	// colSpecs is a list of column specifications in the BSON documents to be imported
+	colSpecs []ColumnSpec
 
 	// csvReader is the underlying reader used to read data in from the CSV or CSV file
 	csvReader *csv.Reader
@@ -25,26 +25,50 @@ type CSVInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// parseGrace handles values that fail to parse
+	parseGrace *ParseGrace
+
+	// format is the delimiter, quoting and comments of the input
+	format *CSVFormat
+
+	// mapping renames, drops and adds fields of the documents
+	mapping *FieldMapping
+
+	// startOffset is the byte offset in the input the reader starts at
+	startOffset int64
 }
 
 // CSVConvertibleDoc implements the ConvertibleDoc interface for CSV input
 type CSVConvertibleDoc struct {
-	fields, data []string
-	numProcessed *uint64
+	colSpecs     []ColumnSpec
+	data         []string
+	raw          string
+	readErr      error
+	numProcessed uint64
+	parseGrace   *ParseGrace
+	format       *CSVFormat
+	mapping      *FieldMapping
+	offset       int64
 }
 
-// NewCSVInputReader returns a CSVInputReader configured to read input from the
-// given io.Reader, extracting the specified fields only.
-func NewCSVInputReader(fields []string, in io.Reader, numDecoders int) *CSVInputReader {
+// NewCSVInputReader returns a CSVInputReader configured to read input in the
+// given format from the given io.Reader, extracting only the specified columns
+// and mapping them to fields with the given field mapping.
+func NewCSVInputReader(colSpecs []ColumnSpec, in io.Reader, numDecoders int, parseGrace *ParseGrace, format *CSVFormat, mapping *FieldMapping) *CSVInputReader {
 	csvReader := csv.NewReader(in)
 	// allow variable number of fields in document
 	csvReader.FieldsPerRecord = -1
 	csvReader.TrimLeadingSpace = true
+	format.configure(csvReader)
 	return &CSVInputReader{
-		Fields:       fields,
+		colSpecs:     colSpecs,
 		csvReader:    csvReader,
 		numProcessed: uint64(0),
 		numDecoders:  numDecoders,
+		parseGrace:   parseGrace,
+		format:       format,
+		mapping:      mapping,
 	}
 }
 
@@ -54,8 +78,33 @@ func (csvInputReader *CSVInputReader) ReadAndValidateHeader() (err error) {
 	if err != nil {
 		return err
 	}
-	csvInputReader.Fields = fields
-	return validateReaderFields(csvInputReader.Fields)
+	csvInputReader.colSpecs = ParseAutoHeaders(fields)
+	return validateReaderFields(ColumnNames(csvInputReader.colSpecs), csvInputReader.mapping)
+}
+
+// ReadAndValidateTypedHeader sets the import fields and their types for a CSV importer
+func (csvInputReader *CSVInputReader) ReadAndValidateTypedHeader() (err error) {
+	fields, err := csvInputReader.csvReader.Read()
+	if err != nil {
+		return err
+	}
+	csvInputReader.colSpecs, err = ParseTypedHeaders(fields)
+	if err != nil {
+		return err
+	}
+	return validateReaderFields(ColumnNames(csvInputReader.colSpecs), csvInputReader.mapping)
+}
+
+// columnSpecs returns the columns of the CSV records
+func (csvInputReader *CSVInputReader) columnSpecs() []ColumnSpec {
+	return csvInputReader.colSpecs
+}
+
+// resumeAt continues reading CSV records after the given checkpoint
+func (csvInputReader *CSVInputReader) resumeAt(colSpecs []ColumnSpec, checkpoint Checkpoint) {
+	csvInputReader.colSpecs = colSpecs
+	csvInputReader.numProcessed = checkpoint.Records
+	csvInputReader.startOffset = checkpoint.Offset
 }
 
 // StreamDocument takes in two channels: it sends processed documents on the
@@ -63,12 +112,25 @@ func (csvInputReader *CSVInputReader) ReadAndValidateHeader() (err error) {
 // errChan channel. It keeps reading from the underlying input source until it
 // hits EOF or an error. If ordered is true, it streams the documents in which
 // the documents are read
-func (csvInputReader *CSVInputReader) StreamDocument(ordered bool, readDocChan chan bson.D, errChan chan error) {
+func (csvInputReader *CSVInputReader) StreamDocument(ordered bool, readDocChan chan ConvertedDoc, errChan chan error) {
 	csvRecordChan := make(chan ConvertibleDoc, csvInputReader.numDecoders)
 	go func() {
 		var err error
 		for {
 			csvInputReader.csvRecord, err = csvInputReader.csvReader.Read()
+			if _, ok := err.(*csv.ParseError); ok {
+				// records with quoting errors are rejected like records
+				// that fail to convert, and reading continues after them
+				csvInputReader.numProcessed++
+				csvRecordChan <- CSVConvertibleDoc{
+					raw:          string(csvInputReader.csvReader.RawRecord()),
+					readErr:      err,
+					numProcessed: csvInputReader.numProcessed,
+					parseGrace:   csvInputReader.parseGrace,
+					offset:       csvInputReader.startOffset + csvInputReader.csvReader.Offset(),
+				}
+				continue
+			}
 			if err != nil {
 				close(csvRecordChan)
 				if err != io.EOF {
@@ -77,12 +139,17 @@ func (csvInputReader *CSVInputReader) StreamDocument(ordered bool, readDocChan c
 				}
 				return
 			}
+			csvInputReader.numProcessed++
 			csvRecordChan <- CSVConvertibleDoc{
-				fields:       csvInputReader.Fields,
+				colSpecs:     csvInputReader.colSpecs,
 				data:         csvInputReader.csvRecord,
-				numProcessed: &csvInputReader.numProcessed,
+				raw:          string(csvInputReader.csvReader.RawRecord()),
+				numProcessed: csvInputReader.numProcessed,
+				parseGrace:   csvInputReader.parseGrace,
+				format:       csvInputReader.format,
+				mapping:      csvInputReader.mapping,
+				offset:       csvInputReader.startOffset + csvInputReader.csvReader.Offset(),
 			}
-			csvInputReader.numProcessed++
 		}
 	}()
 	errChan <- streamDocuments(ordered, csvInputReader.numDecoders, csvRecordChan, readDocChan)
@@ -91,9 +158,30 @@ func (csvInputReader *CSVInputReader) StreamDocument(ordered bool, readDocChan c
 // This is required to satisfy the ConvertibleDoc interface for CSV input. It
 // does CSV-specific processing to convert the CSVConvertibleDoc to a bson.D
 func (csvConvertibleDoc CSVConvertibleDoc) Convert() (bson.D, error) {
+	if csvConvertibleDoc.readErr != nil {
+		err := fmt.Errorf("read error on entry #%v: %v", csvConvertibleDoc.numProcessed, csvConvertibleDoc.readErr)
+		return nil, csvConvertibleDoc.parseGrace.onRecordError(err)
+	}
 	return tokensToBSON(
-		csvConvertibleDoc.fields,
+		csvConvertibleDoc.colSpecs,
 		csvConvertibleDoc.data,
-		*csvConvertibleDoc.numProcessed,
+		csvConvertibleDoc.numProcessed,
+		csvConvertibleDoc.parseGrace,
+		csvConvertibleDoc.mapping,
 	)
 }
+
+// fieldTokens returns the text of the CSV record's values by field
+func (csvConvertibleDoc CSVConvertibleDoc) fieldTokens() map[string]string {
+	return fieldTokens(csvConvertibleDoc.colSpecs, csvConvertibleDoc.data, csvConvertibleDoc.mapping)
+}
+
+// Record returns the number of the CSV record and its input, as read
+func (csvConvertibleDoc CSVConvertibleDoc) Record() (uint64, string) {
+	return csvConvertibleDoc.numProcessed, csvConvertibleDoc.raw
+}
+
+// position returns the number of the CSV record and the byte offset of its end
+func (csvConvertibleDoc CSVConvertibleDoc) position() (uint64, int64) {
+	return csvConvertibleDoc.numProcessed, csvConvertibleDoc.offset
+}
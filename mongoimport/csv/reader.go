@@ -56,6 +56,7 @@ import (
 	"fmt"
 	"io"
 	"unicode"
+	"unicode/utf8"
 )
 
 // A ParseError is returned for parsing errors.
@@ -76,6 +77,7 @@ var (
 	ErrBareQuote     = errors.New("bare \" in non-quoted-field")
 	ErrQuote         = errors.New("extraneous \" in field")
 	ErrFieldCount    = errors.New("wrong number of fields in line")
+	ErrEscape        = errors.New("escape character at end of input")
 )
 
 // A Reader reads records from a CSV-encoded file.
@@ -86,9 +88,20 @@ var (
 //
 // Comma is the field delimiter.  It defaults to ','.
 //
+// Quote is the character that quoted-fields start and stop with.  It
+// defaults to '"'.  If Quote is 0, fields are never quoted.
+//
+// Escape, if not 0 or Quote, is the escape character.  The character
+// following it is part of the field as it is, so it can be used for
+// quotes, delimiters and newlines.  Otherwise quotes within quoted-fields
+// are escaped by doubling them.
+//
 // Comment, if not 0, is the comment character. Lines beginning with the
 // Comment character are ignored.
 //
+// CommentPrefix, if not empty, is a comment prefix. Lines beginning with
+// CommentPrefix are ignored.
+//
 // If FieldsPerRecord is positive, Read requires each record to
 // have the given number of fields.  If FieldsPerRecord is 0, Read sets it to
 // the number of fields in the first record, so that future records must
@@ -100,14 +113,19 @@ var (
 //
 // If TrimLeadingSpace is true, leading white space in a field is ignored.
 type Reader struct {
-	Comma            rune // field delimiter (set to ',' by NewReader)
-	Comment          rune // comment character for start of line
-	FieldsPerRecord  int  // number of expected fields per record
-	LazyQuotes       bool // allow lazy quotes
-	TrailingComma    bool // ignored; here for backwards compatibility
-	TrimLeadingSpace bool // trim leading space
+	Comma            rune   // field delimiter (set to ',' by NewReader)
+	Quote            rune   // quote character (set to '"' by NewReader)
+	Escape           rune   // escape character
+	Comment          rune   // comment character for start of line
+	CommentPrefix    string // comment prefix for start of line
+	FieldsPerRecord  int    // number of expected fields per record
+	LazyQuotes       bool   // allow lazy quotes
+	TrailingComma    bool   // ignored; here for backwards compatibility
+	TrimLeadingSpace bool   // trim leading space
 	line             int
 	column           int
+	offset           int64
+	raw              []byte
 	r                *bufio.Reader
 	field            bytes.Buffer
 }
@@ -116,6 +134,7 @@ type Reader struct {
 func NewReader(r io.Reader) *Reader {
 	return &Reader{
 		Comma: ',',
+		Quote: '"',
 		r:     bufio.NewReader(r),
 	}
 }
@@ -130,13 +149,18 @@ func (r *Reader) error(err error) error {
 }
 
 // Read reads one record from r.  The record is a slice of strings with each
-// string representing one field.
+// string representing one field.  After a ParseError, the rest of the line
+// is skipped, so that the next call to Read continues with the next record.
 func (r *Reader) Read() (record []string, err error) {
 	for {
 		record, err = r.parseRecord()
 		if record != nil {
 			break
 		}
+		if _, ok := err.(*ParseError); ok {
+			r.skip('\n')
+			return nil, err
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -153,6 +177,18 @@ func (r *Reader) Read() (record []string, err error) {
 	return record, nil
 }
 
+// Offset returns the number of bytes of input read so far, which after a
+// call to Read is the offset of the end of the record it returned.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// RawRecord returns the input of the record last returned by Read, or of
+// the record that failed to parse, without its line ending.
+func (r *Reader) RawRecord() []byte {
+	return bytes.TrimSuffix(bytes.TrimSuffix(r.raw, []byte("\n")), []byte("\r"))
+}
+
 // ReadAll reads all the remaining records from r.
 // Each record is a slice of fields.
 // A successful call returns err == nil, not err == EOF. Because ReadAll is
@@ -175,17 +211,23 @@ func (r *Reader) ReadAll() (records [][]string, err error) {
 // of how far into the line we have read.  r.column will point to the start
 // of this rune, not the end of this rune.
 func (r *Reader) readRune() (rune, error) {
-	r1, _, err := r.r.ReadRune()
+	r1, size, err := r.r.ReadRune()
+	r.offset += int64(size)
+	r.appendRaw(r1, size)
 
 	// Handle \r\n here.  We make the simplifying assumption that
 	// anytime \r is followed by \n that it can be folded to \n.
 	// We will not detect files which contain both \r\n and bare \n.
 	if r1 == '\r' {
-		r1, _, err = r.r.ReadRune()
+		r1, size, err = r.r.ReadRune()
+		r.offset += int64(size)
 		if err == nil {
 			if r1 != '\n' {
 				r.r.UnreadRune()
+				r.offset -= int64(size)
 				r1 = '\r'
+			} else {
+				r.appendRaw(r1, size)
 			}
 		}
 	}
@@ -193,6 +235,42 @@ func (r *Reader) readRune() (rune, error) {
 	return r1, err
 }
 
+// appendRaw adds the rune just read to the input of the current record.
+// Invalid UTF-8 is read as utf8.RuneError, so its byte is read again.
+func (r *Reader) appendRaw(r1 rune, size int) {
+	if size == 0 {
+		return
+	}
+	if r1 == utf8.RuneError && size == 1 {
+		r.r.UnreadRune()
+		b, _ := r.r.ReadByte()
+		r.raw = append(r.raw, b)
+		return
+	}
+	r.raw = append(r.raw, string(r1)...)
+}
+
+// readEscaped reads the rune following an escape character.
+func (r *Reader) readEscaped() (rune, error) {
+	r1, err := r.readRune()
+	if err == io.EOF {
+		return 0, r.error(ErrEscape)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if r1 == '\n' {
+		r.line++
+		r.column = -1
+	}
+	return r1, nil
+}
+
+// escapes reports whether r has an escape character other than doubled quotes.
+func (r *Reader) escapes() bool {
+	return r.Escape != 0 && r.Escape != r.Quote
+}
+
 // skip reads runes up to and including the rune delim or until error.
 func (r *Reader) skip(delim rune) error {
 	for {
@@ -213,17 +291,28 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	// so as we increment in readRune it points to the character we read.
 	r.line++
 	r.column = -1
+	r.raw = r.raw[:0]
 
 	// Peek at the first rune.  If it is an error we are done.
 	// If we are support comments and it is the comment character
-	// then skip to the end of line.
+	// or the line starts with the comment prefix then skip to the
+	// end of line.
 
-	r1, _, err := r.r.ReadRune()
+	if r.CommentPrefix != "" {
+		prefix, _ := r.r.Peek(len(r.CommentPrefix))
+		if string(prefix) == r.CommentPrefix {
+			return nil, r.skip('\n')
+		}
+	}
+
+	r1, size, err := r.r.ReadRune()
 	if err != nil {
 		return nil, err
 	}
 
 	if r.Comment != 0 && r1 == r.Comment {
+		r.offset += int64(size)
+		r.appendRaw(r1, size)
 		return nil, r.skip('\n')
 	}
 	r.r.UnreadRune()
@@ -249,7 +338,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 	r.field.Reset()
 
 	r1, err := r.readRune()
-	for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+	for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 		r1, err = r.readRune()
 	}
 
@@ -262,18 +351,18 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 
 	var ws bytes.Buffer
 
-	switch r1 {
-	case r.Comma:
+	switch {
+	case r1 == r.Comma:
 		// will check below
 
-	case '\n':
+	case r1 == '\n':
 		// We are a trailing empty field or a blank line
 		if r.column == 0 {
 			return false, r1, nil
 		}
 		return true, r1, nil
 
-	case '"':
+	case r.Quote != 0 && r1 == r.Quote:
 		// quoted field
 	Quoted:
 		for {
@@ -287,18 +376,22 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				}
 				return false, 0, err
 			}
-			switch r1 {
-			case '"':
+			switch {
+			case r.escapes() && r1 == r.Escape:
+				if r1, err = r.readEscaped(); err != nil {
+					return false, 0, err
+				}
+			case r1 == r.Quote:
 				r1, err = r.readRune()
-				if err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
-					for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+				if err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
+					for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 						r1, err = r.readRune()
 					}
 					// we don't want '"foo" "bar",' to look like '"foo""bar"'
 					// which evaluates to 'foo"bar'
 					// so we explicitly test for the case that the trimed whitespace isn't
 					// followed by a '"'
-					if err == nil && r1 == '"' {
+					if err == nil && r1 == r.Quote {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
@@ -309,15 +402,15 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				if r1 == '\n' {
 					return true, r1, nil
 				}
-				if r1 != '"' {
+				if r1 != r.Quote {
 					if !r.LazyQuotes {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
 					// accept the bare quote
-					r.field.WriteRune('"')
+					r.field.WriteRune(r.Quote)
 				}
-			case '\n':
+			case r1 == '\n':
 				r.line++
 				r.column = -1
 			}
@@ -328,7 +421,14 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 		// unquoted field
 		for {
 			// only write sections of whitespace if it's followed by non-whitespace
-			if unicode.IsSpace(r1) {
+			if r.escapes() && r1 == r.Escape {
+				if r1, err = r.readEscaped(); err != nil {
+					return false, 0, err
+				}
+				r.field.WriteString(ws.String())
+				ws.Reset()
+				r.field.WriteRune(r1)
+			} else if unicode.IsSpace(r1) {
 				ws.WriteRune(r1)
 			} else {
 				r.field.WriteString(ws.String())
@@ -342,7 +442,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 			if r1 == '\n' {
 				return true, r1, nil
 			}
-			if !r.LazyQuotes && r1 == '"' {
+			if !r.LazyQuotes && r.Quote != 0 && r1 == r.Quote {
 				return false, 0, r.error(ErrBareQuote)
 			}
 		}
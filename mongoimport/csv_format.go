@@ -0,0 +1,101 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/mongoimport/csv"
+	"unicode/utf8"
+)
+
+// escape style constants, for values of --escape
+const (
+	EscapeDouble    = "double"
+	EscapeBackslash = "backslash"
+)
+
+// QuoteNone is the value of --quote for input without quoted fields
+const QuoteNone = "none"
+
+// CSVFormat describes the dialect of CSV input, as set with --delimiter,
+// --quote, --escape and --commentPrefix. A nil *CSVFormat is standard
+// comma-separated input with fields quoted by '"'.
+type CSVFormat struct {
+	// Delimiter separates the fields of a record
+	Delimiter rune
+	// Quote starts and ends quoted fields; 0 if fields are never quoted
+	Quote rune
+	// Escape makes the character following it literal; if 0,
+	// quotes in quoted fields are escaped by doubling them
+	Escape rune
+	// CommentPrefix starts lines that are skipped
+	CommentPrefix string
+}
+
+// defaultCSVFormat is the format of standard comma-separated input
+var defaultCSVFormat = &CSVFormat{Delimiter: ',', Quote: '"'}
+
+// NewCSVFormat returns the format of CSV input set in the given options,
+// or an error if they aren't valid
+func NewCSVFormat(inputOptions *InputOptions) (*CSVFormat, error) {
+	format := &CSVFormat{
+		Delimiter:     defaultCSVFormat.Delimiter,
+		Quote:         defaultCSVFormat.Quote,
+		CommentPrefix: inputOptions.CommentPrefix,
+	}
+	var err error
+	if inputOptions.Delimiter != "" {
+		if format.Delimiter, err = parseFormatChar("--delimiter", inputOptions.Delimiter); err != nil {
+			return nil, err
+		}
+	}
+	switch inputOptions.Quote {
+	case "":
+	case QuoteNone:
+		format.Quote = 0
+	default:
+		if format.Quote, err = parseFormatChar("--quote", inputOptions.Quote); err != nil {
+			return nil, err
+		}
+	}
+	switch inputOptions.Escape {
+	case "", EscapeDouble:
+	case EscapeBackslash:
+		format.Escape = '\\'
+	default:
+		return nil, fmt.Errorf("invalid --escape value '%v': must be %v or %v",
+			inputOptions.Escape, EscapeDouble, EscapeBackslash)
+	}
+	if format.Delimiter == format.Quote {
+		return nil, fmt.Errorf("--delimiter and --quote can not be the same character")
+	}
+	if format.Delimiter == format.Escape {
+		return nil, fmt.Errorf("--delimiter can not be the escape character")
+	}
+	return format, nil
+}
+
+// parseFormatChar returns the single character given as the value of an
+// option, which can also be written as "\t" or "tab" for a tab
+func parseFormatChar(option, value string) (rune, error) {
+	if value == `\t` || value == "tab" {
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("%v must be a single character, not '%v'", option, value)
+	}
+	char, _ := utf8.DecodeRuneInString(value)
+	if char == '\r' || char == '\n' || char == utf8.RuneError {
+		return 0, fmt.Errorf("invalid %v character '%v'", option, value)
+	}
+	return char, nil
+}
+
+// configure sets the format on a CSV reader
+func (format *CSVFormat) configure(csvReader *csv.Reader) {
+	if format == nil {
+		return
+	}
+	csvReader.Comma = format.Delimiter
+	csvReader.Quote = format.Quote
+	csvReader.Escape = format.Escape
+	csvReader.CommentPrefix = format.CommentPrefix
+}
@@ -0,0 +1,138 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// readCSVDocuments returns the documents read from CSV input in the given format
+func readCSVDocuments(contents string, fields []string, format *CSVFormat) ([]bson.D, error) {
+	csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, format, nil)
+	docChan := make(chan ConvertedDoc, 10)
+	errChan := make(chan error)
+	go csvInputReader.StreamDocument(true, docChan, errChan)
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	documents := []bson.D{}
+	for converted := range docChan {
+		documents = append(documents, converted.Document)
+	}
+	return documents, nil
+}
+
+func TestNewCSVFormat(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With CSV format options", t, func() {
+		Convey("no options should give the standard format", func() {
+			format, err := NewCSVFormat(&InputOptions{})
+			So(err, ShouldBeNil)
+			So(*format, ShouldResemble, *defaultCSVFormat)
+		})
+		Convey("the options should set the delimiter, quote, escape and comment prefix", func() {
+			format, err := NewCSVFormat(&InputOptions{
+				Delimiter:     "|",
+				Quote:         "'",
+				Escape:        EscapeBackslash,
+				CommentPrefix: "//",
+			})
+			So(err, ShouldBeNil)
+			So(*format, ShouldResemble, CSVFormat{Delimiter: '|', Quote: '\'', Escape: '\\', CommentPrefix: "//"})
+		})
+		Convey("a tab delimiter can be written as \\t", func() {
+			format, err := NewCSVFormat(&InputOptions{Delimiter: `\t`})
+			So(err, ShouldBeNil)
+			So(format.Delimiter, ShouldEqual, '\t')
+		})
+		Convey("quoting can be turned off", func() {
+			format, err := NewCSVFormat(&InputOptions{Quote: QuoteNone})
+			So(err, ShouldBeNil)
+			So(format.Quote, ShouldEqual, 0)
+		})
+		Convey("an error should be returned for invalid options", func() {
+			_, err := NewCSVFormat(&InputOptions{Delimiter: "||"})
+			So(err, ShouldNotBeNil)
+			_, err = NewCSVFormat(&InputOptions{Delimiter: "\n"})
+			So(err, ShouldNotBeNil)
+			_, err = NewCSVFormat(&InputOptions{Delimiter: `"`})
+			So(err, ShouldNotBeNil)
+			_, err = NewCSVFormat(&InputOptions{Escape: "slash"})
+			So(err, ShouldNotBeNil)
+			_, err = NewCSVFormat(&InputOptions{Delimiter: `\`, Escape: EscapeBackslash})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCSVFormatReading(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	fields := []string{"a", "b", "c"}
+	Convey("With CSV input in a custom format", t, func() {
+		Convey("pipe-delimited input should be split on pipes", func() {
+			format := &CSVFormat{Delimiter: '|', Quote: '"'}
+			documents, err := readCSVDocuments("1|x,y|\"p|q\"\n", fields, format)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, []bson.D{{
+				bson.DocElem{"a", 1},
+				bson.DocElem{"b", "x,y"},
+				bson.DocElem{"c", "p|q"},
+			}})
+		})
+		Convey("tab-delimited input should keep empty fields", func() {
+			format := &CSVFormat{Delimiter: '\t', Quote: '"'}
+			documents, err := readCSVDocuments("1\t\t3\n", fields, format)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, []bson.D{{
+				bson.DocElem{"a", 1},
+				bson.DocElem{"b", ""},
+				bson.DocElem{"c", 3},
+			}})
+		})
+		Convey("a custom quote character should quote fields", func() {
+			format := &CSVFormat{Delimiter: ',', Quote: '\''}
+			documents, err := readCSVDocuments(`'x,y','it''s',"z"`+"\n", fields, format)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, []bson.D{{
+				bson.DocElem{"a", "x,y"},
+				bson.DocElem{"b", "it's"},
+				bson.DocElem{"c", `"z"`},
+			}})
+		})
+		Convey("backslashes should escape quotes and delimiters", func() {
+			format := &CSVFormat{Delimiter: ',', Quote: '"', Escape: '\\'}
+			documents, err := readCSVDocuments(`"say \"hi\"",x\,y,a\\b`+"\n", fields, format)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, []bson.D{{
+				bson.DocElem{"a", `say "hi"`},
+				bson.DocElem{"b", "x,y"},
+				bson.DocElem{"c", `a\b`},
+			}})
+		})
+		Convey("quotes should be literal without quoting", func() {
+			format := &CSVFormat{Delimiter: '|'}
+			documents, err := readCSVDocuments(`"x"|y"z|1`+"\n", fields, format)
+			So(err, ShouldBeNil)
+			So(documents, ShouldResemble, []bson.D{{
+				bson.DocElem{"a", `"x"`},
+				bson.DocElem{"b", `y"z`},
+				bson.DocElem{"c", 1},
+			}})
+		})
+		Convey("lines starting with the comment prefix should be skipped", func() {
+			format := &CSVFormat{Delimiter: ',', Quote: '"', CommentPrefix: "//"}
+			documents, err := readCSVDocuments("// exported today\n1,2,3\n//4,5,6\n/7,8,9\n", fields, format)
+			So(err, ShouldBeNil)
+			So(len(documents), ShouldEqual, 2)
+			So(documents[0][0].Value, ShouldEqual, 1)
+			So(documents[1][0].Value, ShouldEqual, "/7")
+		})
+		Convey("an escape character at the end of the input should be an error", func() {
+			format := &CSVFormat{Delimiter: ',', Quote: '"', Escape: '\\'}
+			_, err := readCSVDocuments(`1,2,3\`, fields, format)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
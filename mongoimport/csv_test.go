@@ -11,6 +11,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -25,18 +26,42 @@ func TestCSVStreamDocument(t *testing.T) {
 		Convey("badly encoded CSV should result in a parsing error", func() {
 			contents := `1, 2, foo"bar`
 			fields := []string{"a", "b", "c"}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
+			converted := <-docChan
+			So(converted.Err, ShouldNotBeNil)
+			number, input := converted.Source.Record()
+			So(number, ShouldEqual, 1)
+			So(input, ShouldEqual, contents)
+		})
+		Convey("badly encoded CSV records should be skipped with skipRow", func() {
+			contents := "1,2,3\r\n4, 5, foo\"bar\r\n6,7,8\r\n"
+			fields := []string{"a", "b", "c"}
+			parseGrace, err := NewParseGrace(SkipRow)
+			So(err, ShouldBeNil)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, parseGrace, nil, nil)
+			errChan := make(chan error)
+			docChan := make(chan ConvertedDoc, 3)
+			go csvInputReader.StreamDocument(true, docChan, errChan)
+			So(<-errChan, ShouldBeNil)
+			So((<-docChan).Document, ShouldResemble, bson.D{{"a", 1}, {"b", 2}, {"c", 3}})
+			converted := <-docChan
+			_, skipped := converted.Err.(skippedRowError)
+			So(skipped, ShouldBeTrue)
+			number, input := converted.Source.Record()
+			So(number, ShouldEqual, 2)
+			So(input, ShouldEqual, `4, 5, foo"bar`)
+			So((<-docChan).Document, ShouldResemble, bson.D{{"a", 6}, {"b", 7}, {"c", 8}})
 		})
 		Convey("escaped quotes are parsed correctly", func() {
 			contents := `1, 2, "foo""bar"`
 			fields := []string{"a", "b", "c"}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldBeNil)
 		})
@@ -48,12 +73,12 @@ func TestCSVStreamDocument(t *testing.T) {
 				bson.DocElem{"b", 2},
 				bson.DocElem{"c", `foo" "bar`},
 			}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 		})
 		Convey("integer valued strings should be converted", func() {
 			contents := `1, 2, " 3e"`
@@ -63,12 +88,12 @@ func TestCSVStreamDocument(t *testing.T) {
 				bson.DocElem{"b", 2},
 				bson.DocElem{"c", " 3e"},
 			}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 		})
 		Convey("extra fields should be prefixed with 'field'", func() {
 			contents := `1, 2f , " 3e" , " may"`
@@ -79,11 +104,11 @@ func TestCSVStreamDocument(t *testing.T) {
 				bson.DocElem{"c", " 3e"},
 				bson.DocElem{"field3", " may"},
 			}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 		Convey("nested CSV fields should be imported properly", func() {
@@ -97,11 +122,11 @@ func TestCSVStreamDocument(t *testing.T) {
 				bson.DocElem{"c", " 3e"},
 				bson.DocElem{"field3", " may"},
 			}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
-			readDocument := <-docChan
+			readDocument := (<-docChan).Document
 			So(readDocument[0], ShouldResemble, expectedRead[0])
 			So(readDocument[1].Name, ShouldResemble, expectedRead[1].Name)
 			So(*readDocument[1].Value.(*bson.D), ShouldResemble, expectedRead[1].Value)
@@ -112,18 +137,18 @@ func TestCSVStreamDocument(t *testing.T) {
 		Convey("whitespace separated quoted strings are still an error", func() {
 			contents := `1, 2, "foo"  "bar"`
 			fields := []string{"a", "b", "c"}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
 		Convey("nested CSV fields causing header collisions should error", func() {
 			contents := `1, 2f , " 3e" , " may", june`
 			fields := []string{"a", "b.c", "field3"}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
@@ -141,17 +166,45 @@ func TestCSVStreamDocument(t *testing.T) {
 				bson.DocElem{"b", 5},
 				bson.DocElem{"c", 6},
 			}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).Document, ShouldResemble, expectedReadOne)
+			So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 			So(<-errChan, ShouldBeNil)
 		})
 	})
 }
 
+func TestCSVReadAndValidateTypedHeader(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a CSV input reader", t, func() {
+		Convey("setting a typed header should read the field names and types", func() {
+			contents := "zip.string(),created.date(2006-01-02),raw.binary(hex)\n01234,2015-03-04,6869\n"
+			csvInputReader := NewCSVInputReader(nil, bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
+			So(csvInputReader.ReadAndValidateTypedHeader(), ShouldBeNil)
+			So(ColumnNames(csvInputReader.colSpecs), ShouldResemble, []string{"zip", "created", "raw"})
+
+			errChan := make(chan error)
+			docChan := make(chan ConvertedDoc, 1)
+			go csvInputReader.StreamDocument(true, docChan, errChan)
+			expectedDocument := bson.D{
+				bson.DocElem{"zip", "01234"},
+				bson.DocElem{"created", time.Date(2015, 3, 4, 0, 0, 0, 0, time.UTC)},
+				bson.DocElem{"raw", []byte("hi")},
+			}
+			So((<-docChan).Document, ShouldResemble, expectedDocument)
+			So(<-errChan, ShouldBeNil)
+		})
+		Convey("a header field without a type should return an error", func() {
+			contents := "zip.string(),age\n"
+			csvInputReader := NewCSVInputReader(nil, bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
+			So(csvInputReader.ReadAndValidateTypedHeader(), ShouldNotBeNil)
+		})
+	})
+}
+
 func TestCSVReadAndValidateHeader(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
 	var err error
@@ -159,50 +212,50 @@ func TestCSVReadAndValidateHeader(t *testing.T) {
 		Convey("setting the header should read the first line of the CSV", func() {
 			contents := "extraHeader1, extraHeader2, extraHeader3"
 			fields := []string{}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(csvInputReader.Fields), ShouldEqual, 3)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 3)
 		})
 
 		Convey("setting non-colliding nested CSV headers should not raise an error", func() {
 			contents := "a, b, c"
 			fields := []string{}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(csvInputReader.Fields), ShouldEqual, 3)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 3)
 			contents = "a.b.c, a.b.d, c"
 			fields = []string{}
-			csvInputReader = NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader = NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(csvInputReader.Fields), ShouldEqual, 3)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 3)
 
 			contents = "a.b, ab, a.c"
 			fields = []string{}
-			csvInputReader = NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader = NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(csvInputReader.Fields), ShouldEqual, 3)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 3)
 
 			contents = "a, ab, ac, dd"
 			fields = []string{}
-			csvInputReader = NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader = NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(csvInputReader.Fields), ShouldEqual, 4)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 4)
 		})
 
 		Convey("setting colliding nested CSV headers should raise an error", func() {
 			contents := "a, a.b, c"
 			fields := []string{}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldNotBeNil)
 
 			contents = "a.b.c, a.b.d.c, a.b.d"
 			fields = []string{}
-			csvInputReader = NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader = NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldNotBeNil)
 
 			contents = "a, a, a"
 			fields = []string{}
-			csvInputReader = NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader = NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldNotBeNil)
 		})
 
@@ -210,42 +263,42 @@ func TestCSVReadAndValidateHeader(t *testing.T) {
 			contents := "c, a., b"
 			fields := []string{}
 			So(err, ShouldBeNil)
-			So(NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1).ReadAndValidateHeader(), ShouldNotBeNil)
+			So(NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil).ReadAndValidateHeader(), ShouldNotBeNil)
 		})
 
 		Convey("setting the header that starts in a dot should error", func() {
 			contents := "c, .a, b"
 			fields := []string{}
-			So(NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1).ReadAndValidateHeader(), ShouldNotBeNil)
+			So(NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil).ReadAndValidateHeader(), ShouldNotBeNil)
 		})
 
 		Convey("setting the header that contains multiple consecutive dots should error", func() {
 			contents := "c, a..a, b"
 			fields := []string{}
-			So(NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1).ReadAndValidateHeader(), ShouldNotBeNil)
+			So(NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil).ReadAndValidateHeader(), ShouldNotBeNil)
 
 			contents = "c, a.a, b.b...b"
 			fields = []string{}
-			So(NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1).ReadAndValidateHeader(), ShouldNotBeNil)
+			So(NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil).ReadAndValidateHeader(), ShouldNotBeNil)
 		})
 
 		Convey("setting the header using an empty file should return EOF", func() {
 			contents := ""
 			fields := []string{}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldEqual, io.EOF)
-			So(len(csvInputReader.Fields), ShouldEqual, 0)
+			So(len(csvInputReader.colSpecs), ShouldEqual, 0)
 		})
 		Convey("setting the header with fields already set, should "+
 			"the header line with the existing fields", func() {
 			contents := "extraHeader1,extraHeader2,extraHeader3"
 			fields := []string{"a", "b", "c"}
-			csvInputReader := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, nil, nil)
 			So(csvInputReader.ReadAndValidateHeader(), ShouldBeNil)
 			// if ReadAndValidateHeader() is called with fields already passed in,
 			// the header should be replaced with the read header line
-			So(len(csvInputReader.Fields), ShouldEqual, 3)
-			So(csvInputReader.Fields, ShouldResemble, strings.Split(contents, ","))
+			So(len(csvInputReader.colSpecs), ShouldEqual, 3)
+			So(ColumnNames(csvInputReader.colSpecs), ShouldResemble, strings.Split(contents, ","))
 		})
 		Convey("plain CSV input file sources should be parsed correctly and "+
 			"subsequent imports should parse correctly", func() {
@@ -262,13 +315,13 @@ func TestCSVReadAndValidateHeader(t *testing.T) {
 			}
 			fileHandle, err := os.Open("testdata/test.csv")
 			So(err, ShouldBeNil)
-			csvInputReader := NewCSVInputReader(fields, fileHandle, 1)
+			csvInputReader := NewCSVInputReader(ParseAutoHeaders(fields), fileHandle, 1, nil, nil, nil)
 
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go csvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).Document, ShouldResemble, expectedReadOne)
+			So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 			So(<-errChan, ShouldBeNil)
 		})
 	})
@@ -280,9 +333,9 @@ func TestCSVConvert(t *testing.T) {
 		Convey("calling convert on a CSVConvertibleDoc should return the expected BSON document", func() {
 			numProcessed := uint64(0)
 			csvConvertibleDoc := CSVConvertibleDoc{
-				fields:       []string{"field1", "field2", "field3"},
+				colSpecs:     ParseAutoHeaders([]string{"field1", "field2", "field3"}),
 				data:         []string{"a", "b", "c"},
-				numProcessed: &numProcessed,
+				numProcessed: numProcessed,
 			}
 			expectedDocument := bson.D{
 				bson.DocElem{"field1", "a"},
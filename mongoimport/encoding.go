@@ -0,0 +1,169 @@
+package mongoimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encoding constants, for values of --encoding
+const (
+	UTF8        = "utf-8"
+	UTF16       = "utf-16"
+	Latin1      = "latin-1"
+	Windows1252 = "windows-1252"
+)
+
+// NormalizeEncoding returns the encoding constant for the name of an input
+// encoding, accepting common aliases, or an error if it isn't supported
+func NormalizeEncoding(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16", "utf16":
+		return UTF16, nil
+	case "latin-1", "latin1", "iso-8859-1", "iso8859-1":
+		return Latin1, nil
+	case "windows-1252", "windows1252", "cp1252":
+		return Windows1252, nil
+	}
+	return "", fmt.Errorf("invalid --encoding value '%v': must be one of %v, %v, %v or %v",
+		name, UTF8, UTF16, Latin1, Windows1252)
+}
+
+// windows1252Runes are the characters of the Windows-1252 bytes from 0x80
+// to 0x9f; the bytes it leaves undefined are read as the same code points,
+// as in Latin-1. All other bytes are the same as in Latin-1.
+var windows1252Runes = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// decodingReader converts input in another encoding to UTF-8, one character at a time
+type decodingReader struct {
+	in         *bufio.Reader
+	decodeRune func(in *bufio.Reader) (rune, error)
+	// pending holds the UTF-8 bytes of a character that didn't fit in the last read
+	pending []byte
+}
+
+func (reader *decodingReader) Read(p []byte) (int, error) {
+	n := 0
+	var encoded [utf8.UTFMax]byte
+	for n < len(p) {
+		if len(reader.pending) != 0 {
+			copied := copy(p[n:], reader.pending)
+			reader.pending = reader.pending[copied:]
+			n += copied
+			continue
+		}
+		char, err := reader.decodeRune(reader.in)
+		if err != nil {
+			return n, err
+		}
+		size := utf8.EncodeRune(encoded[:], char)
+		copied := copy(p[n:], encoded[:size])
+		reader.pending = append(reader.pending[:0], encoded[copied:size]...)
+		n += copied
+	}
+	return n, nil
+}
+
+// newDecodingReader returns a reader that converts input in the given
+// encoding to UTF-8. UTF-16 input must start with a byte order mark.
+func newDecodingReader(in io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "", UTF8:
+		return in, nil
+	case Latin1:
+		return &decodingReader{in: bufio.NewReader(in), decodeRune: decodeLatin1Rune}, nil
+	case Windows1252:
+		return &decodingReader{in: bufio.NewReader(in), decodeRune: decodeWindows1252Rune}, nil
+	case UTF16:
+		buffered := bufio.NewReader(in)
+		bom, err := buffered.Peek(2)
+		if err == io.EOF && len(bom) == 0 {
+			return buffered, nil
+		}
+		var decoder *utf16Decoder
+		switch {
+		case len(bom) == 2 && bom[0] == 0xfe && bom[1] == 0xff:
+			decoder = &utf16Decoder{bigEndian: true}
+		case len(bom) == 2 && bom[0] == 0xff && bom[1] == 0xfe:
+			decoder = &utf16Decoder{bigEndian: false}
+		default:
+			return nil, fmt.Errorf("UTF-16 input must start with a byte order mark")
+		}
+		buffered.Discard(2)
+		return &decodingReader{in: buffered, decodeRune: decoder.decodeRune}, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding '%v'", encoding)
+}
+
+func decodeLatin1Rune(in *bufio.Reader) (rune, error) {
+	b, err := in.ReadByte()
+	return rune(b), err
+}
+
+func decodeWindows1252Rune(in *bufio.Reader) (rune, error) {
+	b, err := in.ReadByte()
+	if b >= 0x80 && b <= 0x9f {
+		return windows1252Runes[b-0x80], err
+	}
+	return rune(b), err
+}
+
+// utf16Decoder decodes UTF-16 characters, including surrogate pairs
+type utf16Decoder struct {
+	bigEndian bool
+	// lookahead holds a code unit read after an unpaired surrogate
+	lookahead    uint16
+	hasLookahead bool
+}
+
+// readUnit reads a 16-bit code unit
+func (decoder *utf16Decoder) readUnit(in *bufio.Reader) (uint16, error) {
+	if decoder.hasLookahead {
+		decoder.hasLookahead = false
+		return decoder.lookahead, nil
+	}
+	var unit [2]byte
+	if _, err := io.ReadFull(in, unit[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("UTF-16 input ends in the middle of a character")
+		}
+		return 0, err
+	}
+	if decoder.bigEndian {
+		return uint16(unit[0])<<8 | uint16(unit[1]), nil
+	}
+	return uint16(unit[1])<<8 | uint16(unit[0]), nil
+}
+
+func (decoder *utf16Decoder) decodeRune(in *bufio.Reader) (rune, error) {
+	unit, err := decoder.readUnit(in)
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(rune(unit)) {
+		return rune(unit), nil
+	}
+	next, err := decoder.readUnit(in)
+	if err == io.EOF {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	char := utf16.DecodeRune(rune(unit), rune(next))
+	if char == utf8.RuneError {
+		// the surrogate is unpaired, so the next unit is a character of its own
+		decoder.lookahead, decoder.hasLookahead = next, true
+	}
+	return char, nil
+}
@@ -0,0 +1,82 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// decodeString returns the UTF-8 text of the input in the given encoding
+func decodeString(input []byte, encoding string) (string, error) {
+	reader, err := newDecodingReader(bytes.NewReader(input), encoding)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := ioutil.ReadAll(reader)
+	return string(decoded), err
+}
+
+func TestNormalizeEncoding(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("Encoding names and their aliases should be normalized", t, func() {
+		for name, expected := range map[string]string{
+			"":           UTF8,
+			"UTF8":       UTF8,
+			"utf-16":     UTF16,
+			"ISO-8859-1": Latin1,
+			"latin1":     Latin1,
+			"cp1252":     Windows1252,
+		} {
+			encoding, err := NormalizeEncoding(name)
+			So(err, ShouldBeNil)
+			So(encoding, ShouldEqual, expected)
+		}
+		_, err := NormalizeEncoding("ebcdic")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDecodingReader(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With input in another encoding", t, func() {
+		Convey("Latin-1 should be converted to UTF-8", func() {
+			decoded, err := decodeString([]byte{'c', 'a', 'f', 0xe9, ',', 0x80}, Latin1)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "café,\u0080")
+		})
+		Convey("Windows-1252 should be converted to UTF-8", func() {
+			decoded, err := decodeString([]byte{'c', 'a', 'f', 0xe9, ',', 0x80, 0x93, 'x', 0x94}, Windows1252)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "café,€“x”")
+		})
+		Convey("UTF-16 should be converted to UTF-8 according to its byte order mark", func() {
+			littleEndian := []byte{0xff, 0xfe, 'a', 0, ',', 0, 0xe9, 0, 0x3d, 0xd8, 0x00, 0xde}
+			decoded, err := decodeString(littleEndian, UTF16)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "a,é😀")
+
+			bigEndian := []byte{0xfe, 0xff, 0, 'a', 0, ',', 0, 0xe9, 0xd8, 0x3d, 0xde, 0x00}
+			decoded, err = decodeString(bigEndian, UTF16)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "a,é😀")
+		})
+		Convey("an unpaired surrogate should be replaced without losing the next character", func() {
+			decoded, err := decodeString([]byte{0xff, 0xfe, 0x3d, 0xd8, 'a', 0}, UTF16)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "�a")
+		})
+		Convey("UTF-16 without a byte order mark or with an odd length should be an error", func() {
+			_, err := decodeString([]byte{'a', 0}, UTF16)
+			So(err, ShouldNotBeNil)
+			_, err = decodeString([]byte{0xff, 0xfe, 'a'}, UTF16)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("UTF-8 should be read as it is", func() {
+			decoded, err := decodeString([]byte("café"), UTF8)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldEqual, "café")
+		})
+	})
+}
@@ -0,0 +1,321 @@
+package mongoimport
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"hash"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hash constants, for the hash of an _id built by a mapping file
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+// nowConstant is the value of a constant field set to the time of the import
+const nowConstant = "$now"
+
+// mappingFile is the format of the file given with --mappingFile, e.g.
+//
+//	{
+//	  "rename": {"Cust Name": "customer.name", "Zip": "customer.zip"},
+//	  "drop": ["Internal Notes"],
+//	  "constants": {"source": "partnerX", "importedAt": "$now"},
+//	  "id": {"columns": ["Country", "Cust No"], "separator": "-", "hash": "sha1"}
+//	}
+type mappingFile struct {
+	Rename    map[string]string `json:"rename"`
+	Drop      []string          `json:"drop"`
+	Constants json.RawMessage   `json:"constants"`
+	ID        *idMapping        `json:"id"`
+}
+
+// idMapping builds the _id of each document from the values of source
+// columns, joined by the separator and optionally hashed
+type idMapping struct {
+	Columns   []string `json:"columns"`
+	Separator string   `json:"separator"`
+	Hash      string   `json:"hash"`
+}
+
+// FieldMapping changes the fields of each document before it's imported,
+// as set with --mappingFile: source fields are renamed to target paths or
+// dropped, constant fields are added and the _id can be built from source
+// fields. A nil *FieldMapping leaves documents as they are.
+type FieldMapping struct {
+	rename    map[string]string
+	drop      map[string]bool
+	constants bson.D
+	id        *idMapping
+}
+
+// LoadFieldMapping reads the mapping file with the given name. Constants
+// set to "$now" are the time the file is loaded.
+func LoadFieldMapping(filename string) (*FieldMapping, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mapping file: %v", err)
+	}
+	mapping, err := NewFieldMapping(data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping file %v: %v", filename, err)
+	}
+	return mapping, nil
+}
+
+// NewFieldMapping returns the FieldMapping in the given JSON mapping file
+// contents, with constants set to "$now" as the given time
+func NewFieldMapping(data []byte, now time.Time) (*FieldMapping, error) {
+	keys, err := json.UnmarshalMap(data)
+	if err != nil {
+		return nil, err
+	}
+	for key := range keys {
+		switch key {
+		case "rename", "drop", "constants", "id":
+		default:
+			return nil, fmt.Errorf("unknown key '%v'", key)
+		}
+	}
+	file := mappingFile{}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	mapping := &FieldMapping{
+		rename: file.Rename,
+		drop:   map[string]bool{},
+		id:     file.ID,
+	}
+	targets := []string{}
+	for _, name := range file.Drop {
+		if _, ok := mapping.rename[name]; ok {
+			return nil, fmt.Errorf("field '%v' can not be both renamed and dropped", name)
+		}
+		mapping.drop[name] = true
+	}
+	for _, target := range mapping.rename {
+		targets = append(targets, target)
+	}
+
+	if len(file.Constants) != 0 {
+		constants, err := json.UnmarshalBsonD(file.Constants)
+		if err != nil {
+			return nil, fmt.Errorf("error reading constants: %v", err)
+		}
+		if mapping.constants, err = bsonutil.GetExtendedBsonD(constants); err != nil {
+			return nil, fmt.Errorf("error reading constants: %v", err)
+		}
+		for index, constant := range mapping.constants {
+			if constant.Value == nowConstant {
+				mapping.constants[index].Value = now
+			}
+			targets = append(targets, constant.Name)
+		}
+	}
+
+	if mapping.id != nil {
+		if len(mapping.id.Columns) == 0 {
+			return nil, fmt.Errorf("the _id must be built from at least one column")
+		}
+		switch mapping.id.Hash {
+		case "", HashMD5, HashSHA1, HashSHA256:
+		default:
+			return nil, fmt.Errorf("invalid _id hash '%v': must be one of %v, %v or %v",
+				mapping.id.Hash, HashMD5, HashSHA1, HashSHA256)
+		}
+		targets = append(targets, "_id")
+	}
+	if err = validateFields(targets); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// validateColumns checks that the fields the named source columns are
+// imported as, along with the constant fields and the _id, don't conflict,
+// e.g. a column renamed to "a" alongside a column "a.b"
+func (mapping *FieldMapping) validateColumns(names []string) error {
+	if mapping == nil {
+		return nil
+	}
+	targets := []string{}
+	for _, name := range names {
+		if target, ok := mapping.target(name); ok {
+			targets = append(targets, target)
+		}
+	}
+	for _, constant := range mapping.constants {
+		targets = append(targets, constant.Name)
+	}
+	if mapping.id != nil {
+		targets = append(targets, "_id")
+	}
+	if err := validateFields(targets); err != nil {
+		return fmt.Errorf("invalid mapping file: %v", err)
+	}
+	return nil
+}
+
+// target returns the name a source field is imported as, and
+// false if the field is dropped
+func (mapping *FieldMapping) target(name string) (string, bool) {
+	if mapping == nil {
+		return name, true
+	}
+	if mapping.drop[name] {
+		return "", false
+	}
+	if target, ok := mapping.rename[name]; ok {
+		return target, true
+	}
+	return name, true
+}
+
+// mapDocument renames and drops the top-level fields of a document, adds the
+// constant fields and builds its _id from the values of its source fields
+func (mapping *FieldMapping) mapDocument(document bson.D) (bson.D, error) {
+	if mapping == nil {
+		return document, nil
+	}
+	mapped := bson.D{}
+	for _, elem := range document {
+		target, ok := mapping.target(elem.Name)
+		if !ok {
+			continue
+		}
+		if err := setMappedValue(&mapped, target, elem.Value); err != nil {
+			return nil, err
+		}
+	}
+	return mapping.finish(mapped, func(name string) (string, bool) {
+		for _, elem := range document {
+			if elem.Name == name {
+				return idString(elem.Value), true
+			}
+		}
+		return "", false
+	})
+}
+
+// finish adds the constant fields and the _id to a mapped document. The
+// sourceValue function returns the value of a source field as a string, or
+// false if the source has no such field.
+func (mapping *FieldMapping) finish(document bson.D, sourceValue func(name string) (string, bool)) (bson.D, error) {
+	if mapping == nil {
+		return document, nil
+	}
+	for _, constant := range mapping.constants {
+		if err := setMappedValue(&document, constant.Name, constant.Value); err != nil {
+			return nil, err
+		}
+	}
+	if mapping.id == nil {
+		return document, nil
+	}
+	parts := make([]string, len(mapping.id.Columns))
+	for index, column := range mapping.id.Columns {
+		value, ok := sourceValue(column)
+		if !ok {
+			return nil, fmt.Errorf("no value for _id column '%v'", column)
+		}
+		parts[index] = value
+	}
+	id := strings.Join(parts, mapping.id.Separator)
+	if mapping.id.Hash != "" {
+		var hasher hash.Hash
+		switch mapping.id.Hash {
+		case HashMD5:
+			hasher = md5.New()
+		case HashSHA1:
+			hasher = sha1.New()
+		case HashSHA256:
+			hasher = sha256.New()
+		}
+		hasher.Write([]byte(id))
+		id = hex.EncodeToString(hasher.Sum(nil))
+	}
+	withID := bson.D{{"_id", id}}
+	for _, elem := range document {
+		if elem.Name != "_id" {
+			withID = append(withID, elem)
+		}
+	}
+	return withID, nil
+}
+
+// idString returns a field value as the string it contributes to an _id
+func idString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bson.ObjectId:
+		return v.Hex()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// setMappedValue sets the field at a dotted path in a document to a value,
+// adding embedded documents as needed. A field that is already set has its
+// value replaced, unless both values are documents, which are merged, so that
+// fields renamed into an embedded document are kept whatever their order. An
+// embedded document isn't replaced by a value that isn't one, since its
+// fields would be lost.
+func setMappedValue(document *bson.D, path string, value interface{}) error {
+	name, rest := path, ""
+	if index := strings.Index(path, "."); index != -1 {
+		name, rest = path[:index], path[index+1:]
+	}
+	for index, elem := range *document {
+		if elem.Name != name {
+			continue
+		}
+		subDocument, ok := embeddedDocument(elem.Value)
+		if rest == "" {
+			newDocument, isDocument := embeddedDocument(value)
+			if ok && !isDocument {
+				return fmt.Errorf("can not set field '%v' since it is already a document", path)
+			}
+			if !ok || !isDocument {
+				(*document)[index].Value = value
+				return nil
+			}
+			merged := append(bson.D{}, subDocument...)
+			for _, newElem := range newDocument {
+				if err := setMappedValue(&merged, newElem.Name, newElem.Value); err != nil {
+					return err
+				}
+			}
+			(*document)[index].Value = &merged
+			return nil
+		}
+		if !ok {
+			return fmt.Errorf("can not set field '%v' since '%v' is not a document", path, name)
+		}
+		subDocument = append(bson.D{}, subDocument...)
+		(*document)[index].Value = &subDocument
+		return setMappedValue(&subDocument, rest, value)
+	}
+	if rest == "" {
+		*document = append(*document, bson.DocElem{name, value})
+		return nil
+	}
+	subDocument := &bson.D{}
+	*document = append(*document, bson.DocElem{name, subDocument})
+	return setMappedValue(subDocument, rest, value)
+}
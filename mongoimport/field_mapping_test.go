@@ -0,0 +1,130 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestNewFieldMapping(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	now := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	Convey("With a mapping file", t, func() {
+		Convey("constants set to $now should be the given time", func() {
+			mapping, err := NewFieldMapping([]byte(`{"constants": {"source": "partnerX", "importedAt": "$now"}}`), now)
+			So(err, ShouldBeNil)
+			So(mapping.constants, ShouldResemble, bson.D{{"source", "partnerX"}, {"importedAt", now}})
+		})
+		Convey("constants should be read as extended JSON", func() {
+			mapping, err := NewFieldMapping([]byte(`{"constants": {"n": {"$numberLong": "5"}}}`), now)
+			So(err, ShouldBeNil)
+			So(mapping.constants, ShouldResemble, bson.D{{"n", int64(5)}})
+		})
+		Convey("an error should be returned for unknown keys", func() {
+			_, err := NewFieldMapping([]byte(`{"renames": {"a": "b"}}`), now)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("an error should be returned for a field that is renamed and dropped", func() {
+			_, err := NewFieldMapping([]byte(`{"rename": {"a": "b"}, "drop": ["a"]}`), now)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("an error should be returned for conflicting target fields", func() {
+			_, err := NewFieldMapping([]byte(`{"rename": {"a": "x.y"}, "constants": {"x": 1}}`), now)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("an error should be returned for an invalid _id", func() {
+			_, err := NewFieldMapping([]byte(`{"id": {"columns": []}}`), now)
+			So(err, ShouldNotBeNil)
+			_, err = NewFieldMapping([]byte(`{"id": {"columns": ["a"], "hash": "crc32"}}`), now)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFieldMappingConvert(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a field mapping", t, func() {
+		mapping, err := NewFieldMapping([]byte(`{
+			"rename": {"Cust Name": "customer.name", "Zip": "customer.zip"},
+			"drop": ["Notes"],
+			"constants": {"source": "partnerX"},
+			"id": {"columns": ["Country", "No"], "separator": "-"}
+		}`), time.Now())
+		So(err, ShouldBeNil)
+
+		Convey("CSV columns should be renamed, dropped and added to", func() {
+			colSpecs := ParseAutoHeaders([]string{"Country", "No", "Cust Name", "Notes", "Zip"})
+			document, err := tokensToBSON(colSpecs, []string{"FR", "007", "Ann", "n/a", "75001"}, 1, nil, mapping)
+			So(err, ShouldBeNil)
+			So(document, ShouldResemble, bson.D{
+				{"_id", "FR-007"},
+				{"Country", "FR"},
+				{"No", 7},
+				{"customer", &bson.D{{"name", "Ann"}, {"zip", 75001}}},
+				{"source", "partnerX"},
+			})
+		})
+		Convey("CSV records without a column of the _id should fail to convert", func() {
+			colSpecs := ParseAutoHeaders([]string{"Country", "No"})
+			_, err := tokensToBSON(colSpecs, []string{"FR"}, 1, nil, mapping)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("CSV columns should fail to convert, rather than panic, when a rename "+
+			"conflicts with a dotted column", func() {
+			mapping, err := NewFieldMapping([]byte(`{"rename": {"X": "a"}}`), time.Now())
+			So(err, ShouldBeNil)
+			_, err = tokensToBSON(ParseAutoHeaders([]string{"X", "a.b"}), []string{"1", "2"}, 1, nil, mapping)
+			So(err, ShouldNotBeNil)
+			_, err = tokensToBSON(ParseAutoHeaders([]string{"a.b", "X"}), []string{"2", "1"}, 1, nil, mapping)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("JSON fields should be renamed, dropped and added to", func() {
+			contents := `{"Country": "FR", "No": 7, "Cust Name": "Ann", "Notes": "n/a", "customer": {"vip": true}}`
+			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1, nil, mapping)
+			docChan := make(chan ConvertedDoc, 1)
+			errChan := make(chan error)
+			go r.StreamDocument(true, docChan, errChan)
+			So((<-docChan).Document, ShouldResemble, bson.D{
+				{"_id", "FR-7"},
+				{"Country", "FR"},
+				{"No", 7.0},
+				{"customer", &bson.D{{"name", "Ann"}, {"vip", true}}},
+				{"source", "partnerX"},
+			})
+			So(<-errChan, ShouldBeNil)
+		})
+	})
+	Convey("With a field mapping that hashes the _id", t, func() {
+		mapping, err := NewFieldMapping([]byte(`{"id": {"columns": ["a", "b"], "hash": "md5"}}`), time.Now())
+		So(err, ShouldBeNil)
+		document, err := mapping.mapDocument(bson.D{{"_id", 1}, {"a", "x"}, {"b", "y"}})
+		So(err, ShouldBeNil)
+		// the md5 hash of "xy"
+		So(document, ShouldResemble, bson.D{{"_id", "3e44107170a520582ade522fa73c1d15"}, {"a", "x"}, {"b", "y"}})
+	})
+	Convey("With a field mapping that renames a column", t, func() {
+		mapping, err := NewFieldMapping([]byte(`{"rename": {"X": "a"}, "constants": {"c": 1}}`), time.Now())
+		So(err, ShouldBeNil)
+
+		Convey("columns whose targets conflict should be rejected", func() {
+			So(mapping.validateColumns([]string{"X", "a.b"}), ShouldNotBeNil)
+			So(mapping.validateColumns([]string{"X", "a"}), ShouldNotBeNil)
+			So(mapping.validateColumns([]string{"X", "c.d"}), ShouldNotBeNil)
+			So(mapping.validateColumns([]string{"X", "b.a"}), ShouldBeNil)
+		})
+		Convey("a CSV header with conflicting columns should be rejected", func() {
+			contents := "X,a.b\n1,2\n"
+			r := NewCSVInputReader(nil, bytes.NewReader([]byte(contents)), 1, nil, &CSVFormat{Delimiter: ',', Quote: '"'}, mapping)
+			So(r.ReadAndValidateHeader(), ShouldNotBeNil)
+		})
+	})
+	Convey("A nil field mapping should leave documents as they are", t, func() {
+		var mapping *FieldMapping
+		document, err := mapping.mapDocument(bson.D{{"a", 1}})
+		So(err, ShouldBeNil)
+		So(document, ShouldResemble, bson.D{{"a", 1}})
+	})
+}
@@ -0,0 +1,450 @@
+package mongoimport
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxSchemaSamples is the most distinct sample values reported for a field
+	maxSchemaSamples = 3
+	// maxSampleLength is the most characters of a sample value reported
+	maxSampleLength = 32
+)
+
+// fieldStats holds what was observed of the values of a field path
+type fieldStats struct {
+	path   string
+	count  uint64
+	types  map[string]uint64
+	nulls  uint64
+	blanks uint64
+	// leadingZeros counts input tokens, such as "02134", that look like
+	// numbers but would lose their leading zeros if imported as one
+	leadingZeros uint64
+	hasLength    bool
+	minLength    int
+	maxLength    int
+	hasRange     bool
+	min          float64
+	max          float64
+	samples      []string
+}
+
+// SchemaReport summarizes the fields of the documents read from the input,
+// as reported with --inferSchema
+type SchemaReport struct {
+	numDocuments uint64
+	numRejected  uint64
+	// fields are in the order they were first seen
+	fields     []*fieldStats
+	fieldIndex map[string]*fieldStats
+}
+
+// NewSchemaReport returns an empty SchemaReport
+func NewSchemaReport() *SchemaReport {
+	return &SchemaReport{fieldIndex: map[string]*fieldStats{}}
+}
+
+// AddDocument adds the fields of a document to the report
+func (report *SchemaReport) AddDocument(document bson.D) {
+	report.numDocuments++
+	report.addFields("", document)
+}
+
+// tokenizedDoc is implemented by the records of CSV and TSV input, whose
+// values are converted from text
+type tokenizedDoc interface {
+	// fieldTokens returns the text of each value by the field it is imported as
+	fieldTokens() map[string]string
+}
+
+// fieldTokens maps each token of a CSV or TSV record to the field it is
+// imported as, leaving out dropped columns
+func fieldTokens(colSpecs []ColumnSpec, tokens []string, mapping *FieldMapping) map[string]string {
+	byField := map[string]string{}
+	for index, token := range tokens {
+		name := "field" + strconv.Itoa(index)
+		if index < len(colSpecs) {
+			name = colSpecs[index].Name
+		}
+		if target, ok := mapping.target(name); ok {
+			byField[target] = token
+		}
+	}
+	return byField
+}
+
+// addTokens adds the input text of the values of the last document added,
+// since the converted values don't show how they were written
+func (report *SchemaReport) addTokens(tokens map[string]string) {
+	for path, token := range tokens {
+		if stats, ok := report.fieldIndex[path]; ok && hasLeadingZero(token) {
+			stats.leadingZeros++
+		}
+	}
+}
+
+// hasLeadingZero returns true for numbers written with a leading zero
+// before their first digit, like zip codes and other identifiers
+func hasLeadingZero(token string) bool {
+	token = strings.TrimSpace(token)
+	digits := strings.TrimLeft(token, "+-")
+	if len(digits) < 2 || digits[0] != '0' || digits[1] < '0' || digits[1] > '9' {
+		return false
+	}
+	_, isString := getParsedValue(token).(string)
+	return !isString
+}
+
+// addFields adds the fields of a document or embedded document, as dotted paths
+func (report *SchemaReport) addFields(prefix string, document bson.D) {
+	for _, elem := range document {
+		path := prefix + elem.Name
+		report.addValue(path, elem.Value)
+		if subDocument, ok := embeddedDocument(elem.Value); ok {
+			report.addFields(path+".", subDocument)
+		}
+	}
+}
+
+// embeddedDocument returns the value as a document, if it is one
+func embeddedDocument(value interface{}) (bson.D, bool) {
+	switch document := value.(type) {
+	case bson.D:
+		return document, true
+	case *bson.D:
+		return *document, true
+	case bson.M:
+		return sortedDocument(document), true
+	case map[string]interface{}:
+		return sortedDocument(document), true
+	}
+	return nil, false
+}
+
+// sortedDocument returns the fields of a map in order of name
+func sortedDocument(fields map[string]interface{}) bson.D {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	document := make(bson.D, len(names))
+	for i, name := range names {
+		document[i] = bson.DocElem{name, fields[name]}
+	}
+	return document
+}
+
+func (report *SchemaReport) addValue(path string, value interface{}) {
+	stats, ok := report.fieldIndex[path]
+	if !ok {
+		stats = &fieldStats{path: path, types: map[string]uint64{}}
+		report.fieldIndex[path] = stats
+		report.fields = append(report.fields, stats)
+	}
+	stats.count++
+	stats.types[bsonTypeName(value)]++
+
+	switch v := value.(type) {
+	case nil:
+		stats.nulls++
+		return
+	case string:
+		if v == "" {
+			stats.blanks++
+			return
+		}
+		stats.addLength(utf8.RuneCountInString(v))
+	}
+	if number, ok := numericValue(value); ok {
+		stats.addNumber(number)
+	}
+	if _, ok := embeddedDocument(value); !ok {
+		stats.addSample(value)
+	}
+}
+
+func (stats *fieldStats) addLength(length int) {
+	if !stats.hasLength || length < stats.minLength {
+		stats.minLength = length
+	}
+	if !stats.hasLength || length > stats.maxLength {
+		stats.maxLength = length
+	}
+	stats.hasLength = true
+}
+
+func (stats *fieldStats) addNumber(number float64) {
+	if !stats.hasRange || number < stats.min {
+		stats.min = number
+	}
+	if !stats.hasRange || number > stats.max {
+		stats.max = number
+	}
+	stats.hasRange = true
+}
+
+func (stats *fieldStats) addSample(value interface{}) {
+	if len(stats.samples) == maxSchemaSamples {
+		return
+	}
+	sample := fmt.Sprintf("%v", value)
+	if _, ok := value.(string); ok {
+		sample = strconv.Quote(sample)
+	}
+	if utf8.RuneCountInString(sample) > maxSampleLength {
+		sample = string([]rune(sample)[:maxSampleLength]) + "..."
+	}
+	for _, existing := range stats.samples {
+		if existing == sample {
+			return
+		}
+	}
+	stats.samples = append(stats.samples, sample)
+}
+
+// bsonTypeName returns the name of the BSON type a value is imported as
+func bsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return "int32"
+		}
+		return "int64"
+	case int32:
+		return "int32"
+	case int64:
+		return "int64"
+	case float32, float64:
+		return "double"
+	case time.Time:
+		return "date"
+	case bson.ObjectId:
+		return "objectId"
+	case []byte, bson.Binary:
+		return "binary"
+	case []interface{}:
+		return "array"
+	case bson.RegEx:
+		return "regex"
+	case bson.MongoTimestamp:
+		return "timestamp"
+	}
+	if _, ok := embeddedDocument(value); ok {
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// numericValue returns the value as a float64, if it is a number
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// inferredType returns the type of a --columnsHaveTypes field list that the
+// values of a field can be imported as. Nulls and blanks are left out, and
+// fields with types that have no such type are imported with auto. Fields
+// with numbers written with leading zeros are imported as strings to keep them.
+func (stats *fieldStats) inferredType() string {
+	if stats.leadingZeros > 0 {
+		return "string"
+	}
+	observed := map[string]bool{}
+	for typeName := range stats.types {
+		if typeName != "null" {
+			observed[typeName] = true
+		}
+	}
+	if stats.blanks == stats.types["string"] {
+		delete(observed, "string")
+	}
+	onlyTypes := func(typeNames ...string) bool {
+		allowed := map[string]bool{}
+		for _, typeName := range typeNames {
+			allowed[typeName] = true
+		}
+		for typeName := range observed {
+			if !allowed[typeName] {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case len(observed) == 0:
+		return "auto"
+	case onlyTypes("int32"):
+		return "int32"
+	case onlyTypes("int32", "int64"):
+		return "int64"
+	case onlyTypes("int32", "int64", "double"):
+		return "double"
+	case onlyTypes("boolean"):
+		return "boolean"
+	case onlyTypes("objectId"):
+		return "objectId"
+	case observed["object"] || observed["array"] || observed["date"] || observed["binary"]:
+		return "auto"
+	}
+	return "string"
+}
+
+// FieldsOption returns the --fields option, with the inferred type of each
+// column, to import the same input with --columnsHaveTypes. Embedded
+// documents are left out, since their fields are columns of their own.
+func (report *SchemaReport) FieldsOption() string {
+	fields := []string{}
+	for _, stats := range report.fields {
+		if stats.types["object"] == stats.count {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%v.%v()", stats.path, stats.inferredType()))
+	}
+	list := strings.Replace(strings.Join(fields, ","), "'", `'\''`, -1)
+	return fmt.Sprintf("--columnsHaveTypes --fields '%v'", list)
+}
+
+// Write writes the report as a table with a row for each field path
+func (report *SchemaReport) Write(out io.Writer) error {
+	fmt.Fprintf(out, "read %v document(s)", report.numDocuments)
+	if report.numRejected > 0 {
+		fmt.Fprintf(out, "; %v record(s) failed to convert", report.numRejected)
+	}
+	fmt.Fprintln(out)
+
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tTYPES\tNULL\tBLANK\tLENGTH\tRANGE\tSAMPLES")
+	for _, stats := range report.fields {
+		length, valueRange := "", ""
+		if stats.hasLength {
+			length = fmt.Sprintf("%v-%v", stats.minLength, stats.maxLength)
+		}
+		if stats.hasRange {
+			valueRange = fmt.Sprintf("%v to %v",
+				strconv.FormatFloat(stats.min, 'g', -1, 64), strconv.FormatFloat(stats.max, 'g', -1, 64))
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			stats.path,
+			stats.typeCounts(),
+			report.rate(stats.nulls),
+			report.rate(stats.blanks),
+			length,
+			valueRange,
+			strings.Join(stats.samples, ", "),
+		)
+	}
+	return table.Flush()
+}
+
+// typeCounts returns the observed types with their counts, most common first
+func (stats *fieldStats) typeCounts() string {
+	typeNames := make([]string, 0, len(stats.types))
+	for typeName := range stats.types {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Slice(typeNames, func(i, j int) bool {
+		if stats.types[typeNames[i]] != stats.types[typeNames[j]] {
+			return stats.types[typeNames[i]] > stats.types[typeNames[j]]
+		}
+		return typeNames[i] < typeNames[j]
+	})
+	counts := make([]string, len(typeNames))
+	for i, typeName := range typeNames {
+		counts[i] = fmt.Sprintf("%v(%v)", typeName, stats.types[typeName])
+	}
+	return strings.Join(counts, " ")
+}
+
+// rate returns the count as a percentage of the documents read
+func (report *SchemaReport) rate(count uint64) string {
+	if report.numDocuments == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(count)/float64(report.numDocuments))
+}
+
+// InferSchema reads all the input without importing it, and returns a
+// report of the fields of the documents read
+func (mongoImport *MongoImport) InferSchema() (*SchemaReport, error) {
+	report := NewSchemaReport()
+	if len(mongoImport.inputFiles) > 1 {
+		for _, inputFile := range mongoImport.inputFiles {
+			if err := mongoImport.newFileImport(inputFile).inferSchema(report); err != nil {
+				return nil, fmt.Errorf("error reading %v: %v", inputFile, err)
+			}
+		}
+		return report, nil
+	}
+	if err := mongoImport.inferSchema(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// inferSchema adds the documents of the input source to the report
+func (mongoImport *MongoImport) inferSchema(report *SchemaReport) error {
+	inputReader, source, err := mongoImport.openInputReader()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	readDocChan := make(chan ConvertedDoc, workerBufferSize)
+	readErrChan := make(chan error)
+	go inputReader.StreamDocument(true, readDocChan, readErrChan)
+	for convertedDoc := range readDocChan {
+		if convertedDoc.Err != nil {
+			report.numRejected++
+			continue
+		}
+		report.AddDocument(convertedDoc.Document)
+		if source, ok := convertedDoc.Source.(tokenizedDoc); ok {
+			report.addTokens(source.fieldTokens())
+		}
+	}
+	return <-readErrChan
+}
+
+// ReportSchema writes the --inferSchema report of the input, followed by
+// the --fields option for its inferred types if --inferSchemaFields is set
+func (mongoImport *MongoImport) ReportSchema(out io.Writer) error {
+	report, err := mongoImport.InferSchema()
+	if err != nil {
+		return err
+	}
+	if err = report.Write(out); err != nil {
+		return err
+	}
+	if mongoImport.InputOptions.InferSchemaFields {
+		_, err = fmt.Fprintf(out, "\n%v\n", report.FieldsOption())
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSchemaReport(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a schema report", t, func() {
+		report := NewSchemaReport()
+
+		Convey("the types of each field should be counted", func() {
+			report.AddDocument(bson.D{{"a", 1}, {"b", "x"}})
+			report.AddDocument(bson.D{{"a", 1 << 40}, {"b", 2.5}})
+			report.AddDocument(bson.D{{"a", 3}, {"b", nil}})
+			So(report.numDocuments, ShouldEqual, 3)
+			So(len(report.fields), ShouldEqual, 2)
+			So(report.fields[0].typeCounts(), ShouldEqual, "int32(2) int64(1)")
+			So(report.fields[1].typeCounts(), ShouldEqual, "double(1) null(1) string(1)")
+			So(report.fields[1].nulls, ShouldEqual, 1)
+		})
+		Convey("embedded documents should be reported as dotted paths", func() {
+			report.AddDocument(bson.D{{"a", &bson.D{{"b", 1}, {"c", bson.D{{"d", "x"}}}}}})
+			report.AddDocument(bson.D{{"a", map[string]interface{}{"c": map[string]interface{}{"d": "y"}}}})
+			paths := []string{}
+			for _, stats := range report.fields {
+				paths = append(paths, stats.path)
+			}
+			So(paths, ShouldResemble, []string{"a", "a.b", "a.c", "a.c.d"})
+			So(report.fieldIndex["a.c.d"].count, ShouldEqual, 2)
+			So(report.fieldIndex["a.c.d"].samples, ShouldResemble, []string{`"x"`, `"y"`})
+		})
+		Convey("lengths, ranges, blanks and samples should be recorded", func() {
+			for _, value := range []interface{}{"ab", "", "abcd", -2, 10.5, "ab"} {
+				report.AddDocument(bson.D{{"a", value}})
+			}
+			stats := report.fields[0]
+			So(stats.blanks, ShouldEqual, 1)
+			So(stats.minLength, ShouldEqual, 2)
+			So(stats.maxLength, ShouldEqual, 4)
+			So(stats.min, ShouldEqual, -2)
+			So(stats.max, ShouldEqual, 10.5)
+			So(stats.samples, ShouldResemble, []string{`"ab"`, `"abcd"`, "-2"})
+		})
+		Convey("the --fields option should have the inferred type of each column", func() {
+			report.AddDocument(bson.D{{"a", 1}, {"b", 1}, {"c", "x"}, {"d", bson.D{{"e", true}}}, {"f", ""}})
+			report.AddDocument(bson.D{{"a", 2}, {"b", 1.5}, {"c", 3}, {"d", bson.D{{"e", false}}}, {"f", nil}})
+			report.AddDocument(bson.D{{"a", ""}, {"b", nil}, {"c", "y"}, {"d", bson.D{{"e", true}}}, {"f", ""}})
+			So(report.FieldsOption(), ShouldEqual,
+				"--columnsHaveTypes --fields 'a.int32(),b.double(),c.string(),d.e.boolean(),f.auto()'")
+		})
+		Convey("numbers written with leading zeros should be inferred as strings", func() {
+			report.AddDocument(bson.D{{"zip", 2134}, {"n", 5}, {"x", 0.5}})
+			report.addTokens(map[string]string{"zip": "02134", "n": "5", "x": "0.5"})
+			report.AddDocument(bson.D{{"zip", 94105}, {"n", 6}, {"x", 1.5}})
+			report.addTokens(map[string]string{"zip": "94105", "n": "6", "x": "1.5"})
+			So(report.FieldsOption(), ShouldEqual,
+				"--columnsHaveTypes --fields 'zip.string(),n.int32(),x.double()'")
+		})
+		Convey("only numbers should be found to have leading zeros", func() {
+			for _, token := range []string{"007", "-012", " 00.5"} {
+				So(hasLeadingZero(token), ShouldBeTrue)
+			}
+			for _, token := range []string{"0", "0.5", "-0", "70", "0x1f", "0abc", ""} {
+				So(hasLeadingZero(token), ShouldBeFalse)
+			}
+		})
+		Convey("the report should have a row for each field", func() {
+			report.AddDocument(bson.D{{"a", 1}, {"b", ""}})
+			report.AddDocument(bson.D{{"a", 5}})
+			buffer := &bytes.Buffer{}
+			So(report.Write(buffer), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+			So(len(lines), ShouldEqual, 4)
+			So(lines[0], ShouldEqual, "read 2 document(s)")
+			So(strings.Fields(lines[1]), ShouldResemble,
+				[]string{"FIELD", "TYPES", "NULL", "BLANK", "LENGTH", "RANGE", "SAMPLES"})
+			So(strings.Fields(lines[2]), ShouldResemble,
+				[]string{"a", "int32(2)", "0.0%", "0.0%", "1", "to", "5", "1,", "5"})
+			So(strings.Fields(lines[3]), ShouldResemble,
+				[]string{"b", "string(1)", "0.0%", "50.0%"})
+		})
+	})
+}
+
+func TestInferSchema(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a mongoimport instance inferring the schema of a CSV file", t, func() {
+		mongoImport, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		fields := "a,b,c"
+		mongoImport.InputOptions.Fields = &fields
+		mongoImport.InputOptions.Type = CSV
+		mongoImport.InputOptions.File = "testdata/test_blanks.csv"
+
+		Convey("every record should be read, and nothing imported", func() {
+			report, err := mongoImport.InferSchema()
+			So(err, ShouldBeNil)
+			So(report.numDocuments, ShouldEqual, 3)
+			So(report.fieldIndex["a"].typeCounts(), ShouldEqual, "int32(3)")
+			So(report.fieldIndex["b"].blanks, ShouldEqual, 1)
+			So(report.FieldsOption(), ShouldEqual,
+				"--columnsHaveTypes --fields 'a.int32(),b.int32(),c.string()'")
+		})
+		Convey("the --fields option should follow the report with --inferSchemaFields", func() {
+			mongoImport.InputOptions.InferSchemaFields = true
+			buffer := &bytes.Buffer{}
+			So(mongoImport.ReportSchema(buffer), ShouldBeNil)
+			So(buffer.String(), ShouldEndWith,
+				"\n\n--columnsHaveTypes --fields 'a.int32(),b.int32(),c.string()'\n")
+		})
+		Convey("types should be inferred from the input text of the values", func() {
+			file, err := ioutil.TempFile("", "zips")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			_, err = file.WriteString("1,02134,x\n2,94105,y\n")
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+			mongoImport.InputOptions.File = file.Name()
+			report, err := mongoImport.InferSchema()
+			So(err, ShouldBeNil)
+			So(report.fieldIndex["b"].typeCounts(), ShouldEqual, "int32(2)")
+			So(report.FieldsOption(), ShouldEqual,
+				"--columnsHaveTypes --fields 'a.int32(),b.string(),c.string()'")
+		})
+		Convey("an error should be returned if the file can't be read", func() {
+			mongoImport.InputOptions.File = "testdata/missing.csv"
+			_, err := mongoImport.InferSchema()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,154 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// expandInputFiles returns the files to import for the given positional
+// arguments or --file. Each is a file, a glob pattern matching files, or a
+// directory whose files are all imported, in order of name. Hidden files and
+// subdirectories are left out. Plain file names are returned as they are,
+// so that missing files are reported when opened.
+func expandInputFiles(patterns []string) ([]string, error) {
+	inputFiles := []string{}
+	for _, pattern := range patterns {
+		path := util.ToUniversalPath(pattern)
+		if fileInfo, err := os.Stat(path); err == nil && fileInfo.IsDir() {
+			dirFiles, err := listDirectoryFiles(path)
+			if err != nil {
+				return nil, err
+			}
+			inputFiles = append(inputFiles, dirFiles...)
+			continue
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			inputFiles = append(inputFiles, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern '%v': %v", pattern, err)
+		}
+		numMatched := 0
+		for _, match := range matches {
+			if fileInfo, err := os.Stat(match); err == nil && fileInfo.Mode().IsRegular() {
+				inputFiles = append(inputFiles, match)
+				numMatched++
+			}
+		}
+		if numMatched == 0 {
+			return nil, fmt.Errorf("no files match '%v'", pattern)
+		}
+	}
+	return inputFiles, nil
+}
+
+// listDirectoryFiles returns the paths of the files in a directory
+func listDirectoryFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %v: %v", dir, err)
+	}
+	dirFiles := []string{}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dirFiles = append(dirFiles, filepath.Join(dir, entry.Name()))
+	}
+	if len(dirFiles) == 0 {
+		return nil, fmt.Errorf("no files to import in directory %v", dir)
+	}
+	return dirFiles, nil
+}
+
+// importFiles imports several input files into the same collection, with up
+// to --numParallelFiles at a time. Each file is imported with its own readers
+// and insertion workers, so that a file that fails is reported without
+// stopping the others.
+func (mongoImport *MongoImport) importFiles() (uint64, error) {
+	if err := mongoImport.prepareImport(); err != nil {
+		return 0, err
+	}
+
+	fileChan := make(chan string, len(mongoImport.inputFiles))
+	for _, inputFile := range mongoImport.inputFiles {
+		fileChan <- inputFile
+	}
+	close(fileChan)
+
+	numParallelFiles := mongoImport.InputOptions.NumParallelFiles
+	if numParallelFiles > len(mongoImport.inputFiles) {
+		numParallelFiles = len(mongoImport.inputFiles)
+	}
+	log.Logf(log.Info, "importing %v files, %v at a time", len(mongoImport.inputFiles), numParallelFiles)
+
+	var numImported, numFailed uint64
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numParallelFiles; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for inputFile := range fileChan {
+				log.Logf(log.Always, "importing %v", inputFile)
+				numFileImported, err := mongoImport.newFileImport(inputFile).importFile()
+				atomic.AddUint64(&numImported, numFileImported)
+				if err != nil {
+					atomic.AddUint64(&numFailed, 1)
+					log.Logf(log.Always, "error importing %v after %v document(s): %v",
+						inputFile, numFileImported, err)
+					continue
+				}
+				log.Logf(log.Always, "imported %v document(s) from %v", numFileImported, inputFile)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if numFailed > 0 {
+		return numImported, fmt.Errorf("%v of %v files failed to import", numFailed, len(mongoImport.inputFiles))
+	}
+	return numImported, nil
+}
+
+// newFileImport returns a MongoImport for one of several input files, sharing
+// the settings and server details of this one
+func (mongoImport *MongoImport) newFileImport(inputFile string) *MongoImport {
+	inputOptions := *mongoImport.InputOptions
+	inputOptions.File = inputFile
+	return &MongoImport{
+		ToolOptions:           mongoImport.ToolOptions,
+		InputOptions:          &inputOptions,
+		IngestOptions:         mongoImport.IngestOptions,
+		SessionProvider:       mongoImport.SessionProvider,
+		isReplicaSet:          mongoImport.isReplicaSet,
+		upsertFields:          mongoImport.upsertFields,
+		parseGrace:            mongoImport.parseGrace,
+		csvFormat:             mongoImport.csvFormat,
+		fieldMapping:          mongoImport.fieldMapping,
+		supportsWriteCommands: mongoImport.supportsWriteCommands,
+		rejects:               mongoImport.rejects.ForFile(inputFile),
+		progressManager:       mongoImport.progressManager,
+		inputFiles:            []string{inputFile},
+		inputName:             inputFile,
+	}
+}
+
+// importFile imports the single input file of a MongoImport
+// made by newFileImport
+func (mongoImport *MongoImport) importFile() (uint64, error) {
+	inputReader, source, err := mongoImport.openInputReader()
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+	return mongoImport.ingestFromReader(inputReader)
+}
@@ -0,0 +1,46 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestExpandInputFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("When expanding the input files to import", t, func() {
+		Convey("plain file names should be kept, whether or not they exist", func() {
+			inputFiles, err := expandInputFiles([]string{"testdata/test.csv", "testdata/missing.csv"})
+			So(err, ShouldBeNil)
+			So(inputFiles, ShouldResemble, []string{"testdata/test.csv", "testdata/missing.csv"})
+		})
+		Convey("glob patterns should be expanded to the files they match", func() {
+			inputFiles, err := expandInputFiles([]string{"testdata/test_plain*.json"})
+			So(err, ShouldBeNil)
+			So(inputFiles, ShouldResemble, []string{"testdata/test_plain.json", "testdata/test_plain2.json"})
+		})
+		Convey("directories should be expanded to their files in order", func() {
+			inputFiles, err := expandInputFiles([]string{"testdata/multi"})
+			So(err, ShouldBeNil)
+			So(inputFiles, ShouldResemble, []string{"testdata/multi/a.csv", "testdata/multi/b.csv.gz"})
+		})
+		Convey("an error should be returned if a glob pattern matches no files", func() {
+			_, err := expandInputFiles([]string{"testdata/*.xml"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRejectsWriterForFile(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("Rejected records of one of several files should name the file", t, func() {
+		buffer := &bytes.Buffer{}
+		rejects := NewRejectsWriter(buffer)
+		fileRejects := rejects.ForFile("a.csv")
+		So(fileRejects.Reject(TSVConvertibleDoc{data: "x", numProcessed: 1}, fmt.Errorf("bad value")), ShouldBeNil)
+		So(buffer.String(), ShouldEqual, `{"file":"a.csv","record":1,"reason":"bad value","input":"x"}`+"\n")
+		So(rejects.Count(), ShouldEqual, 1)
+	})
+}
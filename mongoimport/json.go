@@ -8,6 +8,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"reflect"
 	"strings"
 )
 
@@ -44,10 +45,21 @@ type JSONInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// parseGrace handles values that fail to convert to BSON types
+	parseGrace *ParseGrace
+
+	// mapping renames, drops and adds fields of the documents
+	mapping *FieldMapping
 }
 
 // JSONConvertibleDoc implements the ConvertibleDoc interface for JSON input
-type JSONConvertibleDoc []byte
+type JSONConvertibleDoc struct {
+	data         []byte
+	numProcessed int64
+	parseGrace   *ParseGrace
+	mapping      *FieldMapping
+}
 
 const (
 	JSON_ARRAY_START = '['
@@ -68,14 +80,17 @@ var (
 )
 
 // NewJSONInputReader creates a new JSONInputReader in array mode if specified,
-// configured to read data to the given io.Reader
-func NewJSONInputReader(isArray bool, in io.Reader, numDecoders int) *JSONInputReader {
+// configured to read data to the given io.Reader and map the fields of the
+// documents with the given field mapping
+func NewJSONInputReader(isArray bool, in io.Reader, numDecoders int, parseGrace *ParseGrace, mapping *FieldMapping) *JSONInputReader {
 	return &JSONInputReader{
 		IsArray:            isArray,
 		Decoder:            json.NewDecoder(in),
 		readOpeningBracket: false,
 		bytesFromReader:    make([]byte, 1),
 		numDecoders:        numDecoders,
+		parseGrace:         parseGrace,
+		mapping:            mapping,
 	}
 }
 
@@ -84,12 +99,17 @@ func (jsonInputReader *JSONInputReader) ReadAndValidateHeader() error {
 	return nil
 }
 
+// ReadAndValidateTypedHeader is a no-op for JSON imports
+func (jsonInputReader *JSONInputReader) ReadAndValidateTypedHeader() error {
+	return nil
+}
+
 // StreamDocument takes in two channels: it sends processed documents on the
 // readChan channel and if any error is encountered, the error is sent on the
 // errChan channel. It keeps reading from the underlying input source until it
 // hits EOF or an error. If ordered is true, it streams the documents in which
 // the documents are read
-func (jsonInputReader *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D, errChan chan error) {
+func (jsonInputReader *JSONInputReader) StreamDocument(ordered bool, readChan chan ConvertedDoc, errChan chan error) {
 	rawChan := make(chan ConvertibleDoc, jsonInputReader.numDecoders)
 	go func() {
 		var err error
@@ -113,30 +133,83 @@ func (jsonInputReader *JSONInputReader) StreamDocument(ordered bool, readChan ch
 				}
 				return
 			}
-			rawChan <- JSONConvertibleDoc(rawBytes)
 			jsonInputReader.numProcessed++
+			rawChan <- JSONConvertibleDoc{
+				data:         rawBytes,
+				numProcessed: jsonInputReader.numProcessed,
+				parseGrace:   jsonInputReader.parseGrace,
+				mapping:      jsonInputReader.mapping,
+			}
 		}
 	}()
 	errChan <- streamDocuments(ordered, jsonInputReader.numDecoders, rawChan, readChan)
 }
 
 // This is required to satisfy the ConvertibleDoc interface for JSON input. It
-// does JSON-specific processing to convert the JSONConvertibleDoc to a bson.D
+// does JSON-specific processing to convert the JSONConvertibleDoc to a bson.D.
+// Fields whose extended JSON values fail to convert are handled according to
+// the parse grace, and the fields are then mapped with the field mapping.
 func (jsonConvertibleDoc JSONConvertibleDoc) Convert() (bson.D, error) {
-	document, err := json.UnmarshalBsonD(jsonConvertibleDoc)
+	document, err := json.UnmarshalBsonD(jsonConvertibleDoc.data)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling bytes on document #%v: %v", 1, err)
+		return nil, fmt.Errorf("error unmarshaling bytes on document #%v: %v",
+			jsonConvertibleDoc.numProcessed, err)
 	}
 	log.Logf(log.DebugHigh, "got line: %v", document)
 	// TODO: perhaps move this to decode.go
-	bsonD, err := bsonutil.GetExtendedBsonD(document)
-	if err != nil {
-		return nil, fmt.Errorf("error getting extended BSON for document #%v: %v", 1, err)
+	bsonD := bson.D{}
+	for index, docElem := range document {
+		extendedElem, err := bsonutil.GetExtendedBsonD(bson.D{docElem})
+		if err == nil {
+			bsonD = append(bsonD, extendedElem...)
+			continue
+		}
+		err = fmt.Errorf("error getting extended BSON for field '%v' of document #%v: %v",
+			docElem.Name, jsonConvertibleDoc.numProcessed, err)
+		action, err := jsonConvertibleDoc.parseGrace.onParseError(err)
+		if err != nil {
+			return nil, err
+		}
+		if action == castField {
+			value, err := jsonConvertibleDoc.rawValueString(index)
+			if err != nil {
+				return nil, err
+			}
+			bsonD = append(bsonD, bson.DocElem{docElem.Name, value})
+		}
 	}
 	log.Logf(log.DebugHigh, "got extended line: %#v", bsonD)
+	if bsonD, err = jsonConvertibleDoc.mapping.mapDocument(bsonD); err != nil {
+		return nil, fmt.Errorf("error mapping document #%v: %v", jsonConvertibleDoc.numProcessed, err)
+	}
 	return bsonD, nil
 }
 
+// Record returns the number of the JSON document and its JSON text
+func (jsonConvertibleDoc JSONConvertibleDoc) Record() (uint64, string) {
+	return uint64(jsonConvertibleDoc.numProcessed), string(jsonConvertibleDoc.data)
+}
+
+// rawValueString returns the JSON value of the field at the given index as a
+// string, for fields imported as strings after failing to convert. The
+// document is read again, since failed conversions can modify its values.
+func (jsonConvertibleDoc JSONConvertibleDoc) rawValueString(index int) (string, error) {
+	document, err := json.UnmarshalBsonD(jsonConvertibleDoc.data)
+	if err != nil {
+		return "", err
+	}
+	value := document[index].Value
+	if reflect.ValueOf(value).Kind() == reflect.String {
+		return reflect.ValueOf(value).String(), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("error converting field '%v' of document #%v to a string: %v",
+			document[index].Name, jsonConvertibleDoc.numProcessed, err)
+	}
+	return string(data), nil
+}
+
 // readJSONArraySeparator is a helper method used to process JSON arrays. It is
 // used to read any of the valid separators for a JSON array and flag invalid
 // characters.
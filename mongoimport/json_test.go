@@ -16,9 +16,9 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 		var jsonFile, fileHandle *os.File
 		Convey("an error should be thrown if a plain JSON document is supplied", func() {
 			contents := `{"a": "ae"}`
-			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
@@ -26,9 +26,9 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 		Convey("reading a JSON object that has no opening bracket should "+
 			"error out", func() {
 			contents := `{"a":3},{"b":4}]`
-			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
@@ -36,21 +36,21 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 		Convey("JSON arrays that do not end with a closing bracket should "+
 			"error out", func() {
 			contents := `[{"a": "ae"}`
-			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			// first read should be fine
-			So(<-docChan, ShouldResemble, bson.D{bson.DocElem{"a", "ae"}})
+			So((<-docChan).Document, ShouldResemble, bson.D{bson.DocElem{"a", "ae"}})
 			So(<-errChan, ShouldNotBeNil)
 		})
 
 		Convey("an error should be thrown if a plain JSON file is supplied", func() {
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			jsonInputReader := NewJSONInputReader(true, fileHandle, 1)
+			jsonInputReader := NewJSONInputReader(true, fileHandle, 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
@@ -70,12 +70,12 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 			}
 			fileHandle, err := os.Open("testdata/test_array.json")
 			So(err, ShouldBeNil)
-			jsonInputReader := NewJSONInputReader(true, fileHandle, 1)
+			jsonInputReader := NewJSONInputReader(true, fileHandle, 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).Document, ShouldResemble, expectedReadOne)
+			So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 		})
 
 		Reset(func() {
@@ -92,11 +92,11 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 		Convey("string valued JSON documents should be imported properly", func() {
 			contents := `{"a": "ae"}`
 			expectedRead := bson.D{bson.DocElem{"a", "ae"}}
-			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 
@@ -105,31 +105,31 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 			contents := `{"a": "ae"}{"b": "dc"}`
 			expectedReadOne := bson.D{bson.DocElem{"a", "ae"}}
 			expectedReadTwo := bson.D{bson.DocElem{"b", "dc"}}
-			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).Document, ShouldResemble, expectedReadOne)
+			So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 			So(<-errChan, ShouldBeNil)
 		})
 
 		Convey("number valued JSON documents should be imported properly", func() {
 			contents := `{"a": "ae", "b": 2.0}`
 			expectedRead := bson.D{bson.DocElem{"a", "ae"}, bson.DocElem{"b", 2.0}}
-			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 
 		Convey("JSON arrays should return an error", func() {
 			contents := `[{"a": "ae", "b": 2.0}]`
-			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
+			jsonInputReader := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
@@ -155,12 +155,12 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 			}
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			jsonInputReader := NewJSONInputReader(false, fileHandle, 1)
+			jsonInputReader := NewJSONInputReader(false, fileHandle, 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			for i := 0; i < len(expectedReads); i++ {
-				for j, readDocument := range <-docChan {
+				for j, readDocument := range (<-docChan).Document {
 					So(readDocument.Name, ShouldEqual, expectedReads[i][j].Name)
 					So(readDocument.Value, ShouldEqual, expectedReads[i][j].Value)
 				}
@@ -181,7 +181,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 		Convey("reading a JSON array separator should consume [",
 			func() {
 				contents := `[{"a": "ae"}`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				// at this point it should have consumed all bytes up to `{`
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
@@ -190,14 +190,14 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"corresponding opening bracket should error out ",
 			func() {
 				contents := `]`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
 		Convey("reading an opening JSON array separator without a "+
 			"corresponding closing bracket should error out ",
 			func() {
 				contents := `[`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
@@ -205,7 +205,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"closing bracket should return EOF",
 			func() {
 				contents := `[]`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldEqual, io.EOF)
 			})
@@ -213,7 +213,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"bracket but then additional characters after that, should error",
 			func() {
 				contents := `[]a`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
@@ -221,9 +221,9 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"error out",
 			func() {
 				contents := `[{"a":3}x{"b":4}]`
-				jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				errChan := make(chan error)
-				docChan := make(chan bson.D, 1)
+				docChan := make(chan ConvertedDoc, 1)
 				go jsonInputReader.StreamDocument(true, docChan, errChan)
 				// read first valid document
 				<-docChan
@@ -233,17 +233,17 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"valid objects should error out",
 			func() {
 				contents := `[{"a":3},b{"b":4}]`
-				jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonInputReader := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				errChan := make(chan error)
-				docChan := make(chan bson.D, 1)
+				docChan := make(chan ConvertedDoc, 1)
 				go jsonInputReader.StreamDocument(true, docChan, errChan)
 				So(jsonInputReader.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonInputReader.readJSONArraySeparator(), ShouldNotBeNil)
 
 				contents = `[{"a":3},,{"b":4}]`
-				jsonInputReader = NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonInputReader = NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1, nil, nil)
 				errChan = make(chan error)
-				docChan = make(chan bson.D, 1)
+				docChan = make(chan ConvertedDoc, 1)
 				go jsonInputReader.StreamDocument(true, docChan, errChan)
 				So(jsonInputReader.readJSONArraySeparator(), ShouldBeNil)
 				err := <-errChan
@@ -257,7 +257,7 @@ func TestJSONConvert(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
 	Convey("With a JSON input reader", t, func() {
 		Convey("calling convert on a JSONConvertibleDoc should return the expected BSON document", func() {
-			jsonConvertibleDoc := JSONConvertibleDoc([]byte(`{field1:"a",field2:"b",field3:"c"}`))
+			jsonConvertibleDoc := JSONConvertibleDoc{data: []byte(`{field1:"a",field2:"b",field3:"c"}`)}
 			expectedDocument := bson.D{
 				bson.DocElem{"field1", "a"},
 				bson.DocElem{"field2", "b"},
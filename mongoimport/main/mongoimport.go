@@ -14,7 +14,8 @@ func main() {
 	// initialize command-line opts
 	usageStr := " --host myhost --db my_cms --collection docs < mydocfile." +
 		"json \n\nImport CSV, TSV or JSON data into MongoDB.\n\nWhen importing " +
-		"JSON documents, each document must be a separate line of the input file."
+		"JSON documents, each document must be a separate line of the input file. Several files, globs or " +
+		"directories can be given to import them into the same collection."
 	opts := options.New("mongoimport", usageStr, options.EnabledOptions{Auth: true, Connection: true, Namespace: true})
 
 	inputOpts := &mongoimport.InputOptions{}
@@ -65,6 +66,15 @@ func main() {
 		os.Exit(util.ExitError)
 	}
 
+	// report the fields of the input, without importing it
+	if inputOpts.InferSchema {
+		if err = mongoImport.ReportSchema(os.Stdout); err != nil {
+			log.Logf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
 	numDocs, err := mongoImport.ImportDocuments()
 	if !opts.Quiet {
 		if err != nil {
@@ -2,9 +2,11 @@ package mongoimport
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -14,6 +16,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // input type constants
@@ -47,13 +50,17 @@ type MongoImport struct {
 	// indicates whether the connected server is part of a replica set
 	isReplicaSet bool
 
-	// insertionLock is used to prevent race conditions in incrementing
-	// the insertion count
-	insertionLock sync.Mutex
-
 	// insertionCount keeps track of how many documents have successfully
-	// been inserted into the database
-	insertionCount uint64
+	// been inserted into the database; it's updated atomically
+	insertionCount int64
+
+	// bytesRead counts the bytes read from the input source, and inputSize
+	// is the size of the input file, or 0 if it's unknown
+	bytesRead int64
+	inputSize int64
+
+	// shows the progress of the import
+	progressManager *progress.Manager
 
 	// the tomb is used to synchronize ingestion goroutines and causes
 	// other sibling goroutines to terminate immediately if one errors out
@@ -61,21 +68,54 @@ type MongoImport struct {
 
 	// fields to use for upsert operations
 	upsertFields []string
+
+	// handles values that fail to parse, as set with --parseGrace
+	parseGrace *ParseGrace
+
+	// the delimiter, quoting and comments of CSV input
+	csvFormat *CSVFormat
+
+	// renames, drops and adds fields of the documents, as set with --mappingFile
+	fieldMapping *FieldMapping
+
+	// the checkpoint to continue the import from, as set with --resume
+	resumeFrom *Checkpoint
+
+	// keeps the --checkpointFile up to date as records are imported
+	checkpoints *checkpointTracker
+
+	// indicates whether the connected server supports write commands,
+	// used to batch updates and deletes
+	supportsWriteCommands bool
+
+	// writes records that could not be imported to the --rejectsFile
+	rejects *RejectsWriter
+
+	// the input files, expanded from globs and directories
+	inputFiles []string
+
+	// names the input file in progress messages, when importing several files
+	inputName string
 }
 
 // InputReader is an interface that wraps the StreamDocument and ReadAndValidateHeader
 // methods.
 //
-// StreamDocument sends InputReader processed BSON documents on the read channel
+// StreamDocument sends InputReader processed BSON documents on the read channel,
+// along with any records that failed to convert so they can be rejected.
 // If an error is encountered during processing, it is sent on the err channel.
 // Otherwise, once documents are streamed, nil is sent on the err channel.
 //
 // ReadAndValidateHeader reads the header line from the InputReader and returns
 // a non-nil error if the fields from the header line are invalid; returns
 // nil otherwise. No-op for JSON input readers
+//
+// ReadAndValidateTypedHeader does the same for header lines whose fields
+// have types, as with --columnsHaveTypes
 type InputReader interface {
-	StreamDocument(ordered bool, read chan bson.D, err chan error)
+	StreamDocument(ordered bool, read chan ConvertedDoc, err chan error)
 	ReadAndValidateHeader() error
+	ReadAndValidateTypedHeader() error
 }
 
 // ValidateSettings ensures that the tool specific options supplied for
@@ -128,6 +168,17 @@ func (mongoImport *MongoImport) ValidateSettings(args []string) error {
 				return fmt.Errorf("incompatible options: --fieldFile and --headerline")
 			}
 		}
+		if mongoImport.InputOptions.Type == CSV {
+			csvFormat, err := NewCSVFormat(mongoImport.InputOptions)
+			if err != nil {
+				return err
+			}
+			mongoImport.csvFormat = csvFormat
+		} else if mongoImport.InputOptions.Delimiter != "" ||
+			mongoImport.InputOptions.Quote != "" ||
+			mongoImport.InputOptions.Escape != "" {
+			return fmt.Errorf("can only use --delimiter, --quote and --escape when input type is CSV")
+		}
 	} else {
 		// input type is JSON
 		if mongoImport.InputOptions.HeaderLine {
@@ -142,20 +193,76 @@ func (mongoImport *MongoImport) ValidateSettings(args []string) error {
 		if mongoImport.IngestOptions.IgnoreBlanks {
 			return fmt.Errorf("can not use --ignoreBlanks when input type is JSON")
 		}
+		if mongoImport.InputOptions.ColumnsHaveTypes {
+			return fmt.Errorf("can not use --columnsHaveTypes when input type is JSON")
+		}
+		if mongoImport.InputOptions.Delimiter != "" ||
+			mongoImport.InputOptions.Quote != "" ||
+			mongoImport.InputOptions.Escape != "" {
+			return fmt.Errorf("can only use --delimiter, --quote and --escape when input type is CSV")
+		}
+		if mongoImport.InputOptions.CommentPrefix != "" {
+			return fmt.Errorf("can not use --commentPrefix when input type is JSON")
+		}
+	}
+
+	encoding, err := NormalizeEncoding(mongoImport.InputOptions.Encoding)
+	if err != nil {
+		return err
+	}
+	mongoImport.InputOptions.Encoding = encoding
+
+	// stop at the first value that fails to parse by default
+	if mongoImport.InputOptions.ParseGrace == "" {
+		mongoImport.InputOptions.ParseGrace = Stop
+	}
+	parseGrace, err := NewParseGrace(mongoImport.InputOptions.ParseGrace)
+	if err != nil {
+		return err
+	}
+	mongoImport.parseGrace = parseGrace
+
+	if mongoImport.InputOptions.MappingFile != "" {
+		fieldMapping, err := LoadFieldMapping(mongoImport.InputOptions.MappingFile)
+		if err != nil {
+			return err
+		}
+		mongoImport.fieldMapping = fieldMapping
 	}
 
 	if mongoImport.IngestOptions.UpsertFields != "" {
 		mongoImport.IngestOptions.Upsert = true
+	}
+
+	// --upsert is the same as --mode=upsert, and can be used with merge
+	switch mongoImport.IngestOptions.Mode {
+	case "", ModeUpsert, ModeMerge:
+	case ModeInsert:
+		if mongoImport.IngestOptions.Upsert {
+			return fmt.Errorf("incompatible options: --mode=%v and --upsert/--upsertFields", ModeInsert)
+		}
+	case ModeDelete:
+		if mongoImport.IngestOptions.Upsert && mongoImport.IngestOptions.UpsertFields == "" {
+			return fmt.Errorf("incompatible options: --mode=%v and --upsert", ModeDelete)
+		}
+	default:
+		return fmt.Errorf("invalid --mode value '%v': must be one of %v, %v, %v or %v",
+			mongoImport.IngestOptions.Mode, ModeInsert, ModeUpsert, ModeMerge, ModeDelete)
+	}
+	mongoImport.IngestOptions.Mode = mongoImport.importMode()
+
+	if mongoImport.IngestOptions.UpsertFields != "" {
 		mongoImport.upsertFields = strings.Split(mongoImport.IngestOptions.UpsertFields, ",")
 		if err := validateFields(mongoImport.upsertFields); err != nil {
 			return fmt.Errorf("invalid --upsertFields argument: %v", err)
 		}
-	} else if mongoImport.IngestOptions.Upsert {
+	} else if mongoImport.IngestOptions.Mode != ModeInsert {
 		mongoImport.upsertFields = []string{"_id"}
 	}
 
-	if mongoImport.IngestOptions.Upsert {
-		log.Logf(log.Info, "using upsert fields: %v", mongoImport.upsertFields)
+	if mongoImport.IngestOptions.Mode != ModeInsert {
+		log.Logf(log.Info, "using %v mode with upsert fields: %v",
+			mongoImport.IngestOptions.Mode, mongoImport.upsertFields)
 	}
 
 	// set the number of decoding workers to use for imports
@@ -181,34 +288,90 @@ func (mongoImport *MongoImport) ValidateSettings(args []string) error {
 		mongoImport.ToolOptions.BulkBufferSize = 10000
 	}
 
-	// ensure no more than one positional argument is supplied
-	if len(args) > 1 {
-		return fmt.Errorf("only one positional argument is allowed")
-	}
-
-	// ensure either a positional argument is supplied or an argument is passed
+	// ensure either positional arguments are supplied or an argument is passed
 	// to the --file flag - and not both
 	if mongoImport.InputOptions.File != "" && len(args) != 0 {
 		return fmt.Errorf("incompatible options: --file and positional argument(s)")
 	}
 
+	// each positional argument, or --file, is a file, glob or directory
+	patterns := args
+	if mongoImport.InputOptions.File != "" {
+		patterns = []string{mongoImport.InputOptions.File}
+	}
+	if len(patterns) != 0 {
+		inputFiles, err := expandInputFiles(patterns)
+		if err != nil {
+			return err
+		}
+		mongoImport.inputFiles = inputFiles
+	}
+
+	// set the number of files to import at once
+	if mongoImport.InputOptions.NumParallelFiles <= 0 {
+		mongoImport.InputOptions.NumParallelFiles = 1
+	}
+
 	var fileBaseName string
 
-	if mongoImport.InputOptions.File != "" {
-		fileBaseName = mongoImport.InputOptions.File
-	} else {
-		if len(args) != 0 {
-			fileBaseName = args[0]
-			mongoImport.InputOptions.File = fileBaseName
+	if len(mongoImport.inputFiles) == 1 {
+		fileBaseName = mongoImport.inputFiles[0]
+		mongoImport.InputOptions.File = fileBaseName
+	}
+
+	if mongoImport.InputOptions.Resume && mongoImport.InputOptions.CheckpointFile == "" {
+		return fmt.Errorf("--resume requires --checkpointFile")
+	}
+	if mongoImport.InputOptions.CheckpointFile != "" {
+		if mongoImport.InputOptions.Type == JSON {
+			return fmt.Errorf("--checkpointFile can only be used with CSV or TSV input")
+		}
+		if len(mongoImport.inputFiles) != 1 {
+			return fmt.Errorf("--checkpointFile can only be used when importing a single file")
 		}
 	}
+	if mongoImport.InputOptions.Resume {
+		if mongoImport.IngestOptions.Drop {
+			return fmt.Errorf("incompatible options: --resume and --drop")
+		}
+		checkpoint, err := LoadCheckpoint(mongoImport.InputOptions.CheckpointFile)
+		if err != nil {
+			return err
+		}
+		if checkpoint.File != mongoImport.InputOptions.File {
+			return fmt.Errorf("can not resume: the checkpoint file is for %v, not %v",
+				checkpoint.File, mongoImport.InputOptions.File)
+		}
+		mongoImport.resumeFrom = checkpoint
+	}
+
+	if mongoImport.InputOptions.InferSchemaFields {
+		if !mongoImport.InputOptions.InferSchema {
+			return fmt.Errorf("--inferSchemaFields can only be used with --inferSchema")
+		}
+		if mongoImport.InputOptions.Type == JSON {
+			return fmt.Errorf("--inferSchemaFields can only be used with CSV or TSV input")
+		}
+	}
+
+	// nothing is imported with --inferSchema, so no collection is needed
+	if mongoImport.InputOptions.InferSchema {
+		return nil
+	}
 
 	// ensure we have a valid string to use for the collection
 	if mongoImport.ToolOptions.Namespace.Collection == "" {
+		if len(mongoImport.inputFiles) > 1 {
+			return fmt.Errorf("no collection specified; --collection is required to import multiple files")
+		}
 		if fileBaseName == "" {
 			return fmt.Errorf("no collection specified")
 		}
 		fileBaseName = filepath.Base(fileBaseName)
+		// leave out the extensions of compressed files, e.g. data.csv.gz
+		for _, extension := range []string{".gz", ".bz2"} {
+			fileBaseName = strings.TrimSuffix(fileBaseName, extension)
+		}
 		if lastDotIndex := strings.LastIndex(fileBaseName, "."); lastDotIndex != -1 {
 			fileBaseName = fileBaseName[0:lastDotIndex]
 		}
@@ -223,8 +386,10 @@ func (mongoImport *MongoImport) ValidateSettings(args []string) error {
 	return nil
 }
 
-// getSourceReader returns an io.Reader to read from the input source
+// getSourceReader returns an io.Reader to read from the input source,
+// decompressing it if it is gzip or bzip2 compressed
 func (mongoImport *MongoImport) getSourceReader() (io.ReadCloser, error) {
+	var source io.ReadCloser = &countingReader{os.Stdin, &mongoImport.bytesRead}
 	if mongoImport.InputOptions.File != "" {
 		file, err := os.Open(util.ToUniversalPath(mongoImport.InputOptions.File))
 		if err != nil {
@@ -232,45 +397,132 @@ func (mongoImport *MongoImport) getSourceReader() (io.ReadCloser, error) {
 		}
 		fileStat, err := file.Stat()
 		if err != nil {
+			file.Close()
 			return nil, err
 		}
 		log.Logf(log.Info, "filesize: %v bytes", fileStat.Size())
-		return file, err
+		mongoImport.inputSize = fileStat.Size()
+		source = &countingReader{file, &mongoImport.bytesRead}
+	} else {
+		log.Logf(log.Info, "filesize: 0 bytes")
+	}
+	reader, compression, err := newDecompressingReader(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	if compression != "" {
+		log.Logf(log.Info, "reading %v compressed input", compression)
 	}
-	log.Logf(log.Info, "filesize: 0 bytes")
-	return os.Stdin, nil
+	return reader, nil
 }
 
-// ImportDocuments is used to write input data to the database. It returns the
-// number of documents successfully imported to the appropriate namespace and
-// any error encountered in doing this
-func (mongoImport *MongoImport) ImportDocuments() (uint64, error) {
+// openInputReader opens the input source and returns an InputReader for it,
+// having read its header line if there is one. With --resume, the records
+// are read from the checkpoint on. The returned io.Closer closes the input
+// source.
+func (mongoImport *MongoImport) openInputReader() (InputReader, io.Closer, error) {
+	inputReader, source, err := mongoImport.openInputReaderAtStart()
+	if err != nil || mongoImport.resumeFrom == nil {
+		return inputReader, source, err
+	}
+	source.Close()
+	return mongoImport.openResumedInputReader(inputReader)
+}
+
+// openInputReaderAtStart opens the input source and returns an InputReader
+// for it from its start, having read its header line if there is one
+func (mongoImport *MongoImport) openInputReaderAtStart() (InputReader, io.Closer, error) {
 	source, err := mongoImport.getSourceReader()
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	defer source.Close()
 
 	inputReader, err := mongoImport.getInputReader(source)
 	if err != nil {
-		return 0, err
+		source.Close()
+		return nil, nil, err
 	}
 
 	if mongoImport.InputOptions.HeaderLine {
-		if err = inputReader.ReadAndValidateHeader(); err != nil {
+		if mongoImport.InputOptions.ColumnsHaveTypes {
+			err = inputReader.ReadAndValidateTypedHeader()
+		} else {
+			err = inputReader.ReadAndValidateHeader()
+		}
+		if err != nil {
+			source.Close()
+			return nil, nil, err
+		}
+	}
+	return inputReader, source, nil
+}
+
+// ImportDocuments is used to write input data to the database. It returns the
+// number of documents successfully imported to the appropriate namespace and
+// any error encountered in doing this
+func (mongoImport *MongoImport) ImportDocuments() (uint64, error) {
+	if mongoImport.IngestOptions.RejectsFile != "" {
+		rejectsFile, err := os.Create(util.ToUniversalPath(mongoImport.IngestOptions.RejectsFile))
+		if err != nil {
+			return 0, fmt.Errorf("error creating rejects file: %v", err)
+		}
+		defer rejectsFile.Close()
+		mongoImport.rejects = NewRejectsWriter(rejectsFile)
+	}
+
+	mongoImport.progressManager = progress.NewProgressBarManager(progressBarWaitTime)
+	mongoImport.progressManager.Start()
+	defer mongoImport.progressManager.Stop()
+
+	var numImported uint64
+	var err error
+	if len(mongoImport.inputFiles) > 1 {
+		numImported, err = mongoImport.importFiles()
+	} else {
+		var inputReader InputReader
+		var source io.Closer
+		if inputReader, source, err = mongoImport.openInputReader(); err != nil {
 			return 0, err
 		}
+		defer source.Close()
+		if mongoImport.InputOptions.CheckpointFile != "" {
+			start := Checkpoint{File: mongoImport.InputOptions.File}
+			if mongoImport.resumeFrom != nil {
+				start = *mongoImport.resumeFrom
+			}
+			mongoImport.checkpoints = newCheckpointTracker(mongoImport.InputOptions.CheckpointFile, start)
+			mongoImport.checkpoints.Start()
+		}
+		numImported, err = mongoImport.importDocuments(inputReader)
+		if checkpointErr := mongoImport.checkpoints.Stop(); checkpointErr != nil && err == nil {
+			err = checkpointErr
+		}
 	}
-	return mongoImport.importDocuments(inputReader)
+	mongoImport.parseGrace.LogSummary()
+	if mongoImport.rejects != nil {
+		log.Logf(log.Always, "rejected %v record(s), written to %v",
+			mongoImport.rejects.Count(), mongoImport.IngestOptions.RejectsFile)
+	}
+	return numImported, err
 }
 
 // importDocuments is a helper to ImportDocuments and does all the ingestion
 // work by taking data from the inputReader source and writing it to the
 // appropriate namespace
 func (mongoImport *MongoImport) importDocuments(inputReader InputReader) (numImported uint64, retErr error) {
+	if err := mongoImport.prepareImport(); err != nil {
+		return 0, err
+	}
+	return mongoImport.ingestFromReader(inputReader)
+}
+
+// prepareImport checks the server being imported to, and drops
+// the collection if necessary, before any input is read
+func (mongoImport *MongoImport) prepareImport() error {
 	session, err := mongoImport.SessionProvider.GetSession()
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer session.Close()
 
@@ -290,12 +542,22 @@ func (mongoImport *MongoImport) importDocuments(inputReader InputReader) (numImp
 	// check if the server is a replica set
 	mongoImport.isReplicaSet, err = mongoImport.SessionProvider.IsReplicaSet()
 	if err != nil {
-		return 0, fmt.Errorf("error checking if server is part of a replicaset: %v", err)
+		return fmt.Errorf("error checking if server is part of a replicaset: %v", err)
 	}
 	log.Logf(log.Info, "is replica set: %v", mongoImport.isReplicaSet)
 
 	if err = mongoImport.configureSession(session); err != nil {
-		return 0, fmt.Errorf("error configuring session: %v", err)
+		return fmt.Errorf("error configuring session: %v", err)
+	}
+
+	// updates and deletes are batched with write commands when the server supports
+	// them, as are inserts when rejected documents need to be identified
+	if mongoImport.importMode() != ModeInsert || mongoImport.rejects != nil {
+		mongoImport.supportsWriteCommands, err = mongoImport.SessionProvider.SupportsWriteCommands()
+		if err != nil {
+			return fmt.Errorf("error checking if server supports write commands: %v", err)
+		}
+		log.Logf(log.Info, "supports write commands: %v", mongoImport.supportsWriteCommands)
 	}
 
 	// drop the database if necessary
@@ -307,12 +569,18 @@ func (mongoImport *MongoImport) importDocuments(inputReader InputReader) (numImp
 			C(mongoImport.ToolOptions.Collection)
 		if err := collection.DropCollection(); err != nil {
 			if err.Error() != db.ErrNsNotFound.Error() {
-				return 0, err
+				return err
 			}
 		}
 	}
 
-	readDocChan := make(chan bson.D, workerBufferSize)
+	return nil
+}
+
+// ingestFromReader streams documents from the inputReader
+// and writes them to the appropriate namespace
+func (mongoImport *MongoImport) ingestFromReader(inputReader InputReader) (uint64, error) {
+	readDocChan := make(chan ConvertedDoc, workerBufferSize)
 
 	// any read errors should cause mongoimport to stop ingestion and immediately
 	// terminate; thus, we leave this channel unbuffered
@@ -324,18 +592,22 @@ func (mongoImport *MongoImport) importDocuments(inputReader InputReader) (numImp
 	// handle all input reads in a separate goroutine
 	go inputReader.StreamDocument(ordered, readDocChan, readErrChan)
 
+	stopProgress := mongoImport.trackProgress()
+	defer stopProgress()
+
 	// return immediately on ingest errors - these will be triggered
 	// either by an issue ingesting data or if the read channel is
 	// closed so we can block here while reads happen in a goroutine
-	if err = mongoImport.IngestDocuments(readDocChan); err != nil {
-		return mongoImport.insertionCount, err
+	if err := mongoImport.IngestDocuments(readDocChan); err != nil {
+		return uint64(atomic.LoadInt64(&mongoImport.insertionCount)), err
 	}
-	return mongoImport.insertionCount, <-readErrChan
+	err := <-readErrChan
+	return uint64(atomic.LoadInt64(&mongoImport.insertionCount)), err
 }
 
 // IngestDocuments takes a slice of documents and either inserts/upserts them -
 // based on whether an upsert is requested - into the given collection
-func (mongoImport *MongoImport) IngestDocuments(readDocChan chan bson.D) (retErr error) {
+func (mongoImport *MongoImport) IngestDocuments(readDocChan chan ConvertedDoc) (retErr error) {
 	numInsertionWorkers := mongoImport.ToolOptions.NumInsertionWorkers
 	if numInsertionWorkers <= 0 {
 		numInsertionWorkers = 1
@@ -387,8 +659,10 @@ func (mongoImport *MongoImport) configureSession(session *mgo.Session) error {
 }
 
 // runInsertionWorker is a helper to InsertDocuments - it reads document off
-// the read channel and prepares then in batches for insertion into the databas
-func (mongoImport *MongoImport) runInsertionWorker(readDocChan chan bson.D) (err error) {
+// the read channel and prepares then in batches for insertion into the databas.
+// Records that failed to convert are rejected; any error that stops the import
+// because of them is reported by the input reader.
+func (mongoImport *MongoImport) runInsertionWorker(readDocChan chan ConvertedDoc) (err error) {
 	session, err := mongoImport.SessionProvider.GetSession()
 	if err != nil {
 		return fmt.Errorf("error connecting to mongod: %v", err)
@@ -401,39 +675,54 @@ func (mongoImport *MongoImport) runInsertionWorker(readDocChan chan bson.D) (err
 	ignoreBlanks := mongoImport.IngestOptions.IgnoreBlanks && mongoImport.InputOptions.Type != JSON
 	documentBytes := make([]byte, 0)
 	documents := make([]bson.Raw, 0)
+	sources := make([]ConvertibleDoc, 0)
 	numMessageBytes := 0
 
 readLoop:
 	for {
 		select {
-		case document, alive := <-readDocChan:
+		case convertedDoc, alive := <-readDocChan:
 			if !alive {
 				break readLoop
 			}
+			if convertedDoc.Err != nil {
+				if err = mongoImport.rejectRecord(convertedDoc); err != nil {
+					return err
+				}
+				continue
+			}
 			// the mgo driver doesn't currently respect the maxBatchSize
 			// limit so we self impose a limit by using maxMessageSizeBytes
 			// and send documents over the wire when we hit the batch size
 			// or when we're at/over the maximum message size threshold
 			if len(documents) == mongoImport.ToolOptions.BulkBufferSize || numMessageBytes >= maxMessageSizeBytes {
-				if err = mongoImport.insert(documents, collection); err != nil {
+				if err = mongoImport.insert(documents, sources, collection); err != nil {
 					return err
 				}
-				// TODO: TOOLS-313; better to use a progress bar here
-				if mongoImport.insertionCount%10000 == 0 {
-					log.Logf(log.Always, "Progress: %v documents inserted...", mongoImport.insertionCount)
-				}
+				mongoImport.checkpoints.acknowledge(sources...)
 				documents = documents[:0]
+				sources = sources[:0]
 				numMessageBytes = 0
 			}
+			document := convertedDoc.Document
 			// ignore blank fields if specified
 			if ignoreBlanks {
 				document = removeBlankFields(document)
 			}
 			if documentBytes, err = bson.Marshal(document); err != nil {
+				mongoImport.rejects.Reject(convertedDoc.Source, err)
 				return err
 			}
+			if mongoImport.IngestOptions.ObjCheck {
+				if err = bsonutil.ValidateBSON(documentBytes, bsonutil.DefaultValidationOptions); err != nil {
+					err = fmt.Errorf("invalid document: %v", err)
+					mongoImport.rejects.Reject(convertedDoc.Source, err)
+					return err
+				}
+			}
 			numMessageBytes += len(documentBytes)
 			documents = append(documents, bson.Raw{3, documentBytes})
+			sources = append(sources, convertedDoc.Source)
 		case <-mongoImport.Dying():
 			return nil
 		}
@@ -441,54 +730,43 @@ readLoop:
 
 	// ingest any documents left in slice
 	if len(documents) != 0 {
-		return mongoImport.insert(documents, collection)
+		if err = mongoImport.insert(documents, sources, collection); err != nil {
+			return err
+		}
+		mongoImport.checkpoints.acknowledge(sources...)
 	}
 	return nil
 }
 
-// TODO: TOOLS-317: add tests/update this to be more efficient
-// handleUpsert upserts documents into the database - used if --upsert is passed
-// to mongoimport
-func (mongoImport *MongoImport) handleUpsert(documents []bson.Raw, collection *mgo.Collection) (numInserted int, err error) {
-	stopOnError := mongoImport.IngestOptions.StopOnError
-	for _, rawBsonDocument := range documents {
-		document := bson.M{}
-		err = bson.Unmarshal(rawBsonDocument.Data, &document)
-		if err != nil {
-			return numInserted, fmt.Errorf("error unmarshaling document: %v", err)
-		}
-		selector := constructUpsertDocument(mongoImport.upsertFields, document)
-		if selector == nil {
-			err = collection.Insert(document)
-		} else {
-			_, err = collection.Upsert(selector, document)
-		}
-		if err == nil {
-			numInserted += 1
-		}
-		if err = filterIngestError(stopOnError, err); err != nil {
-			return numInserted, err
-		}
+// rejectRecord writes a record that failed to convert to the --rejectsFile.
+// The record only counts towards the checkpoint if it was written there or
+// skipped with --parseGrace, so that resuming after an error that stopped the
+// import reads the record again.
+func (mongoImport *MongoImport) rejectRecord(convertedDoc ConvertedDoc) error {
+	if err := mongoImport.rejects.Reject(convertedDoc.Source, convertedDoc.Err); err != nil {
+		return err
 	}
-	return numInserted, nil
+	if _, skipped := convertedDoc.Err.(skippedRowError); skipped || mongoImport.rejects != nil {
+		mongoImport.checkpoints.acknowledge(convertedDoc.Source)
+	}
+	return nil
 }
 
-// insert  performs the actual insertion/updates. If no upsert fields are
-// present in the document to be inserted, it simply inserts the documents
-// into the given collection
-func (mongoImport *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection) (err error) {
+// insert  performs the actual insertion/updates. Unless the import mode is
+// insert, the documents are written according to the mode with writeDocuments,
+// which is also used with --rejectsFile to find the sources of failed writes;
+// otherwise it simply inserts the documents into the given collection
+func (mongoImport *MongoImport) insert(documents []bson.Raw, sources []ConvertibleDoc, collection *mgo.Collection) (err error) {
 	numInserted := 0
 	stopOnError := mongoImport.IngestOptions.StopOnError
 	maintainInsertionOrder := mongoImport.IngestOptions.MaintainInsertionOrder
 
 	defer func() {
-		mongoImport.insertionLock.Lock()
-		mongoImport.insertionCount += uint64(numInserted)
-		mongoImport.insertionLock.Unlock()
+		atomic.AddInt64(&mongoImport.insertionCount, int64(numInserted))
 	}()
 
-	if mongoImport.IngestOptions.Upsert {
-		numInserted, err = mongoImport.handleUpsert(documents, collection)
+	if mongoImport.importMode() != ModeInsert || mongoImport.rejects != nil {
+		numInserted, err = mongoImport.writeDocuments(documents, sources, collection)
 		return err
 	} else {
 		if len(documents) == 0 {
@@ -522,8 +800,19 @@ func (mongoImport *MongoImport) insert(documents []bson.Raw, collection *mgo.Col
 	return filterIngestError(stopOnError, err)
 }
 
-// getInputReader returns an implementation of InputReader based on the input type
+// getInputReader returns an implementation of InputReader based on the input
+// type, converting the input to UTF-8 before parsing
 func (mongoImport *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
+	in, err := newDecodingReader(in, mongoImport.InputOptions.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return mongoImport.newInputReader(in)
+}
+
+// newInputReader returns an implementation of InputReader based on the
+// input type, for input that is already UTF-8
+func (mongoImport *MongoImport) newInputReader(in io.Reader) (InputReader, error) {
 	var fields []string
 	var err error
 	if mongoImport.InputOptions.Fields != nil {
@@ -535,17 +824,29 @@ func (mongoImport *MongoImport) getInputReader(in io.Reader) (InputReader, error
 		}
 	}
 
+	var colSpecs []ColumnSpec
+	if mongoImport.InputOptions.ColumnsHaveTypes {
+		if colSpecs, err = ParseTypedHeaders(fields); err != nil {
+			return nil, err
+		}
+	} else {
+		colSpecs = ParseAutoHeaders(fields)
+	}
+
 	// header fields validation can only happen once we have an input reader
 	if !mongoImport.InputOptions.HeaderLine {
-		if err = validateReaderFields(fields); err != nil {
+		if err = validateReaderFields(ColumnNames(colSpecs), mongoImport.fieldMapping); err != nil {
 			return nil, err
 		}
 	}
 
 	if mongoImport.InputOptions.Type == CSV {
-		return NewCSVInputReader(fields, in, mongoImport.ToolOptions.NumDecodingWorkers), nil
+		return NewCSVInputReader(colSpecs, in, mongoImport.ToolOptions.NumDecodingWorkers,
+			mongoImport.parseGrace, mongoImport.csvFormat, mongoImport.fieldMapping), nil
 	} else if mongoImport.InputOptions.Type == TSV {
-		return NewTSVInputReader(fields, in, mongoImport.ToolOptions.NumDecodingWorkers), nil
+		return NewTSVInputReader(colSpecs, in, mongoImport.ToolOptions.NumDecodingWorkers,
+			mongoImport.parseGrace, mongoImport.InputOptions.CommentPrefix, mongoImport.fieldMapping), nil
 	}
-	return NewJSONInputReader(mongoImport.InputOptions.JSONArray, in, mongoImport.ToolOptions.NumDecodingWorkers), nil
+	return NewJSONInputReader(mongoImport.InputOptions.JSONArray, in, mongoImport.ToolOptions.NumDecodingWorkers,
+		mongoImport.parseGrace, mongoImport.fieldMapping), nil
 }
@@ -104,6 +104,45 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
 		})
 
+		Convey("an error should be thrown if an invalid --mode is given", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.IngestOptions.Mode = "replace"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --mode=insert is used with --upsertFields", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.IngestOptions.Mode = ModeInsert
+			mongoImport.IngestOptions.UpsertFields = "a"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("if --mode=merge is used without --upsertFields, _id should be set as "+
+			"the upsert field", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.IngestOptions.Mode = ModeMerge
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.upsertFields, ShouldResemble, []string{"_id"})
+		})
+
+		Convey("--upsert should set the mode to upsert", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.IngestOptions.Upsert = true
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.IngestOptions.Mode, ShouldEqual, ModeUpsert)
+		})
+
+		Convey("an error should be thrown if an invalid --parseGrace is given", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.ParseGrace = "skipColumn"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
 		Convey("an error should be thrown if neither --headerline is supplied "+
 			"nor --fields/--fieldFile", func() {
 			mongoImport, err := NewMongoImport()
@@ -141,12 +180,54 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(mongoImport.ValidateSettings([]string{"a"}), ShouldNotBeNil)
 		})
 
-		Convey("an error should be thrown if there's more than one positional argument", func() {
+		Convey("no error should be thrown if there's more than one positional argument", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			So(mongoImport.ValidateSettings([]string{"a", "b"}), ShouldBeNil)
+			So(mongoImport.inputFiles, ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("an error should be thrown if there's more than one positional "+
+			"argument and no collection", func() {
 			mongoImport, err := NewMongoImport()
 			So(err, ShouldBeNil)
+			mongoImport.ToolOptions.Namespace.Collection = ""
 			So(mongoImport.ValidateSettings([]string{"a", "b"}), ShouldNotBeNil)
 		})
 
+		Convey("--delimiter, --quote and --escape should only be allowed with CSV input", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.Delimiter = "|"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.Type = TSV
+			mongoImport.InputOptions.HeaderLine = true
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.Type = CSV
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.csvFormat.Delimiter, ShouldEqual, '|')
+		})
+
+		Convey("an error should be thrown for an unsupported --encoding", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.Encoding = "ebcdic"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.Encoding = "cp1252"
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.InputOptions.Encoding, ShouldEqual, Windows1252)
+		})
+
+		Convey("a directory given as a positional argument should be expanded to its files", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.Type = CSV
+			fields := "a,b,c"
+			mongoImport.InputOptions.Fields = &fields
+			So(mongoImport.ValidateSettings([]string{"testdata/multi"}), ShouldBeNil)
+			So(mongoImport.inputFiles, ShouldResemble, []string{"testdata/multi/a.csv", "testdata/multi/b.csv.gz"})
+		})
+
 		Convey("an error should be thrown if --headerline is used with JSON input", func() {
 			mongoImport, err := NewMongoImport()
 			So(err, ShouldBeNil)
@@ -300,6 +381,99 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
 			So(mongoImport.ToolOptions.Namespace.Collection, ShouldEqual, "input")
 		})
+
+		Convey("with no collection name and a compressed file the extension "+
+			"of the compression should also be left out of the collection name", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.File = "/path/to/input/file/dot/input.json.gz"
+			mongoImport.ToolOptions.Namespace.Collection = ""
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.ToolOptions.Namespace.Collection, ShouldEqual, "input")
+		})
+
+		Convey("the --mappingFile should be loaded, and an error thrown if it can't be", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.MappingFile = "testdata/test_mapping.json"
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.fieldMapping, ShouldNotBeNil)
+			So(mongoImport.fieldMapping.rename["a"], ShouldEqual, "ids.a")
+			mongoImport.InputOptions.MappingFile = "testdata/missing.json"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --resume is used without --checkpointFile, "+
+			"or --checkpointFile without a single CSV or TSV file", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.Resume = true
+			mongoImport.InputOptions.File = "testdata/test.csv"
+			mongoImport.InputOptions.HeaderLine = true
+			mongoImport.InputOptions.Type = CSV
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.Resume = false
+			mongoImport.InputOptions.CheckpointFile = "checkpoint.json"
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+
+			mongoImport, err = NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.CheckpointFile = "checkpoint.json"
+			mongoImport.InputOptions.HeaderLine = true
+			mongoImport.InputOptions.Type = CSV
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.Type = JSON
+			mongoImport.InputOptions.HeaderLine = false
+			So(mongoImport.ValidateSettings([]string{"testdata/test_plain.json"}), ShouldNotBeNil)
+		})
+
+		Convey("with --resume the checkpoint should be loaded, and an error thrown "+
+			"if it is for another file or --drop is used", func() {
+			checkpointFile, err := ioutil.TempFile("", "mongoimport_")
+			So(err, ShouldBeNil)
+			defer os.Remove(checkpointFile.Name())
+			_, err = checkpointFile.WriteString(`{"file":"testdata/test.csv","offset":6,"records":1}`)
+			So(err, ShouldBeNil)
+			checkpointFile.Close()
+
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.Resume = true
+			mongoImport.InputOptions.CheckpointFile = checkpointFile.Name()
+			mongoImport.InputOptions.File = "testdata/test.csv"
+			mongoImport.InputOptions.HeaderLine = true
+			mongoImport.InputOptions.Type = CSV
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(*mongoImport.resumeFrom, ShouldResemble, Checkpoint{File: "testdata/test.csv", Offset: 6, Records: 1})
+			mongoImport.IngestOptions.Drop = true
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.IngestOptions.Drop = false
+			mongoImport.InputOptions.File = "testdata/test_blanks.csv"
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("no collection should be needed with --inferSchema", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.InferSchema = true
+			mongoImport.ToolOptions.Namespace.Collection = ""
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			So(mongoImport.ToolOptions.Namespace.Collection, ShouldEqual, "")
+		})
+
+		Convey("an error should be thrown if --inferSchemaFields is used "+
+			"without --inferSchema or with JSON input", func() {
+			mongoImport, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			mongoImport.InputOptions.InferSchemaFields = true
+			mongoImport.InputOptions.HeaderLine = true
+			mongoImport.InputOptions.Type = CSV
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+			mongoImport.InputOptions.InferSchema = true
+			So(mongoImport.ValidateSettings([]string{}), ShouldBeNil)
+			mongoImport.InputOptions.Type = JSON
+			So(mongoImport.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
 	})
 }
 
@@ -327,6 +501,22 @@ func TestGetSourceReader(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			Convey("gzip and bzip2 compressed files should be decompressed", func() {
+				mongoImport, err := NewMongoImport()
+				So(err, ShouldBeNil)
+				expected, err := ioutil.ReadFile("testdata/test_plain.json")
+				So(err, ShouldBeNil)
+				for _, file := range []string{"testdata/test_plain.json.gz", "testdata/test_plain.json.bz2"} {
+					mongoImport.InputOptions.File = file
+					source, err := mongoImport.getSourceReader()
+					So(err, ShouldBeNil)
+					contents, err := ioutil.ReadAll(source)
+					So(err, ShouldBeNil)
+					So(string(contents), ShouldEqual, string(expected))
+					So(source.Close(), ShouldBeNil)
+				}
+			})
+
 			Convey("no error should be thrown if stdin is used", func() {
 				mongoImport, err := NewMongoImport()
 				So(err, ShouldBeNil)
@@ -686,9 +876,9 @@ func TestImportDocuments(t *testing.T) {
 		Convey("an error should be thrown if a plain JSON file is supplied", func() {
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			jsonInputReader := NewJSONInputReader(true, fileHandle, 1)
+			jsonInputReader := NewJSONInputReader(true, fileHandle, 1, nil, nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go jsonInputReader.StreamDocument(true, docChan, errChan)
 			So(<-errChan, ShouldNotBeNil)
 		})
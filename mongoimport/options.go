@@ -8,14 +8,53 @@ type InputOptions struct {
 	FieldFile *string `long:"fieldFile" description:"file with field names - 1 per line"`
 
 	// Specifies the location and name of a file containing the data to import.
-	File string `long:"file" description:"file to import from; if not specified stdin is used"`
+	File string `long:"file" description:"file, glob or directory to import from; gzip and bzip2 compressed files are detected and decompressed; if not specified stdin is used"`
+
+	// Specifies how many input files to import at once, when importing several files.
+	NumParallelFiles int `long:"numParallelFiles" default:"4" description:"number of input files to import in parallel, when several files, globs or directories are given"`
 
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (csv and tsv only)"`
 
+	// Indicates that the field list specifies types, e.g. "zip.string(),age.int32()" (csv and tsv only).
+	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldFile or --headerline) specifies types in the form <field>.<type>(<arg>), e.g. zip.string(), age.int32(), created.date(2006-01-02), raw.binary(base64) (csv and tsv only)"`
+
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
 
+	// Specifies the character separating fields in CSV input.
+	Delimiter string `long:"delimiter" description:"character separating the fields of CSV input, e.g. '|' or '\\t' for a tab; defaults to ',' (csv only)"`
+
+	// Specifies the character quoting fields in CSV input.
+	Quote string `long:"quote" description:"character quoting the fields of CSV input, or 'none' if fields are not quoted; defaults to '\"' (csv only)"`
+
+	// Specifies how quotes and other special characters are escaped in CSV input.
+	Escape string `long:"escape" description:"how special characters are escaped in CSV input: double for doubled quotes, or backslash for a backslash before any character; defaults to double (csv only)"`
+
+	// Specifies a prefix for lines to skip in CSV and TSV input.
+	CommentPrefix string `long:"commentPrefix" description:"skip lines starting with this prefix, e.g. '#' (csv and tsv only)"`
+
+	// Specifies the character encoding of the input, which is converted to UTF-8 before parsing.
+	Encoding string `long:"encoding" default:"utf-8" description:"character encoding of the input: utf-8, utf-16 (with a byte order mark), latin-1 or windows-1252"`
+
+	// Specifies what to do with values that fail to parse as the type of their field.
+	ParseGrace string `long:"parseGrace" default:"stop" description:"what to do when a value fails to parse: autoCast imports it as a string, skipField leaves out the field, skipRow leaves out the document and stop ends the import (autoCast, skipField, skipRow, stop)"`
+
+	// Specifies a file that renames, drops and adds fields of the imported documents.
+	MappingFile string `long:"mappingFile" description:"JSON file mapping the input to the imported documents: \"rename\" source fields to dotted paths, \"drop\" fields, add \"constants\" (\"$now\" for the time of the import) and build the \"id\" from \"columns\" joined by a \"separator\", optionally with a \"hash\" (md5, sha1 or sha256)"`
+
+	// Specifies a file to periodically save the position in the input up to which it has been imported.
+	CheckpointFile string `long:"checkpointFile" description:"periodically save the byte offset and number of the last record imported to this file, so that an interrupted import can be continued with --resume (csv and tsv files only)"`
+
+	// Continues an interrupted import from the position saved in the checkpoint file.
+	Resume bool `long:"resume" description:"continue an interrupted import after the last record saved in the --checkpointFile, reading the header line again if there is one"`
+
+	// Reads the input and reports the fields it contains, without importing anything.
+	InferSchema bool `long:"inferSchema" description:"read the input without importing it, and report the types, null and blank rates, lengths, numeric ranges and sample values of each field"`
+
+	// Also prints a typed field list for the inferred schema (csv and tsv only).
+	InferSchemaFields bool `long:"inferSchemaFields" description:"with --inferSchema, also print a --fields list of the inferred types, to import the input with --columnsHaveTypes (csv and tsv only)"`
+
 	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
 	Type string `long:"type" default:"json" description:"type of file to import (json, csv, tsv)"`
 }
@@ -34,6 +73,9 @@ type IngestOptions struct {
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert documents in the order of their appearance in the input source"`
 
+	// Validates each document before inserting it, halting the import at the first invalid document.
+	ObjCheck bool `long:"objcheck" description:"validate each document before inserting it"`
+
 	// Forces mongoimport to halt the import operation at the first insert or upsert error.
 	StopOnError bool `long:"stopOnError" description:"stop importing at first insert/upsert error"`
 
@@ -43,6 +85,12 @@ type IngestOptions struct {
 	// Specifies a list of fields for the query portion of the upsert; defaults to _id field.
 	UpsertFields string `long:"upsertFields" description:"comma-separated fields for the query part of the upsert"`
 
+	// Specifies how documents are written: inserted, upserted, merged into or deleted from existing documents.
+	Mode string `long:"mode" description:"insert: insert only; upsert: insert or replace existing documents; merge: insert or set the imported fields of existing documents; delete: remove documents matching the upsert fields (defaults to upsert with --upsert, otherwise insert)"`
+
+	// Specifies a file to write records that could not be imported to, with their numbers and the reasons.
+	RejectsFile string `long:"rejectsFile" description:"file to write input records that fail to parse or insert to, one JSON document per line with the record number, the error and the original record"`
+
 	// Sets write concern level for write operations.
 	WriteConcern string `long:"writeConcern" default:"majority" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
 }
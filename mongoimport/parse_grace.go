@@ -0,0 +1,110 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"sync/atomic"
+)
+
+// parse grace constants, for values of --parseGrace
+const (
+	AutoCast  = "autoCast"
+	SkipField = "skipField"
+	SkipRow   = "skipRow"
+	Stop      = "stop"
+)
+
+// parseGraceAction is what to do with a field whose value could not be parsed
+type parseGraceAction int
+
+const (
+	// castField keeps the field, importing its value as a string
+	castField parseGraceAction = iota
+	// dropField leaves the field out of the document
+	dropField
+)
+
+// skippedRowError is returned when converting a record that is left out of
+// the import because one of its values failed to parse, as with skipRow
+type skippedRowError struct {
+	err error
+}
+
+func (skipped skippedRowError) Error() string {
+	return skipped.err.Error()
+}
+
+// ParseGrace decides what happens when a value can't be converted to the
+// type of its field, as set with --parseGrace, and counts the fields and
+// rows affected. A nil *ParseGrace stops the import at the first failure.
+type ParseGrace struct {
+	Mode string
+
+	// counters are updated atomically, since documents are converted concurrently
+	castFields    uint64
+	skippedFields uint64
+	skippedRows   uint64
+}
+
+// NewParseGrace returns a ParseGrace for the given mode, or
+// an error if the mode is not one of the parse grace constants
+func NewParseGrace(mode string) (*ParseGrace, error) {
+	switch mode {
+	case AutoCast, SkipField, SkipRow, Stop:
+		return &ParseGrace{Mode: mode}, nil
+	}
+	return nil, fmt.Errorf("invalid --parseGrace value '%v': must be one of %v, %v, %v or %v",
+		mode, AutoCast, SkipField, SkipRow, Stop)
+}
+
+// onParseError applies the parse grace mode to a field that failed to parse
+// with the given error. It returns the error itself if the import should stop,
+// or a skippedRowError if the record should be left out of the import.
+func (parseGrace *ParseGrace) onParseError(err error) (parseGraceAction, error) {
+	if parseGrace == nil {
+		return 0, err
+	}
+	switch parseGrace.Mode {
+	case AutoCast:
+		atomic.AddUint64(&parseGrace.castFields, 1)
+		log.Logf(log.DebugLow, "%v; importing the value as a string", err)
+		return castField, nil
+	case SkipField:
+		atomic.AddUint64(&parseGrace.skippedFields, 1)
+		log.Logf(log.DebugLow, "%v; skipping the field", err)
+		return dropField, nil
+	case SkipRow:
+		atomic.AddUint64(&parseGrace.skippedRows, 1)
+		log.Logf(log.Info, "%v; skipping the row", err)
+		return 0, skippedRowError{err}
+	}
+	return 0, err
+}
+
+// onRecordError applies the parse grace mode to a record that could not be
+// read, such as a CSV line with a stray quote. Since it has no fields to cast
+// or leave out, the record is either skipped with skipRow or stops the import.
+func (parseGrace *ParseGrace) onRecordError(err error) error {
+	if parseGrace == nil || parseGrace.Mode != SkipRow {
+		return err
+	}
+	atomic.AddUint64(&parseGrace.skippedRows, 1)
+	log.Logf(log.Info, "%v; skipping the row", err)
+	return skippedRowError{err}
+}
+
+// LogSummary logs the number of fields and rows affected by parse failures, if any
+func (parseGrace *ParseGrace) LogSummary() {
+	if parseGrace == nil {
+		return
+	}
+	if count := atomic.LoadUint64(&parseGrace.castFields); count > 0 {
+		log.Logf(log.Always, "imported %v field(s) that failed to parse as strings", count)
+	}
+	if count := atomic.LoadUint64(&parseGrace.skippedFields); count > 0 {
+		log.Logf(log.Always, "skipped %v field(s) that failed to parse", count)
+	}
+	if count := atomic.LoadUint64(&parseGrace.skippedRows); count > 0 {
+		log.Logf(log.Always, "skipped %v row(s) with fields that failed to parse", count)
+	}
+}
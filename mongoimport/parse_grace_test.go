@@ -0,0 +1,147 @@
+package mongoimport
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseGraceTokensToBSON(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("Given typed columns and a value that fails to parse", t, func() {
+		colSpecs, err := ParseTypedHeaders([]string{"a.string()", "b.int32()", "c.int32()"})
+		So(err, ShouldBeNil)
+		tokens := []string{"x", "two", "3"}
+		numProcessed := uint64(1)
+
+		Convey("autoCast should import the value as a string", func() {
+			parseGrace, err := NewParseGrace(AutoCast)
+			So(err, ShouldBeNil)
+			bsonD, err := tokensToBSON(colSpecs, tokens, numProcessed, parseGrace, nil)
+			So(err, ShouldBeNil)
+			So(bsonD, ShouldResemble, bson.D{
+				bson.DocElem{"a", "x"},
+				bson.DocElem{"b", "two"},
+				bson.DocElem{"c", int32(3)},
+			})
+			So(parseGrace.castFields, ShouldEqual, 1)
+		})
+		Convey("skipField should leave out the field", func() {
+			parseGrace, err := NewParseGrace(SkipField)
+			So(err, ShouldBeNil)
+			bsonD, err := tokensToBSON(colSpecs, tokens, numProcessed, parseGrace, nil)
+			So(err, ShouldBeNil)
+			So(bsonD, ShouldResemble, bson.D{
+				bson.DocElem{"a", "x"},
+				bson.DocElem{"c", int32(3)},
+			})
+			So(parseGrace.skippedFields, ShouldEqual, 1)
+		})
+		Convey("skipRow should return no document and an error skipping the row", func() {
+			parseGrace, err := NewParseGrace(SkipRow)
+			So(err, ShouldBeNil)
+			bsonD, err := tokensToBSON(colSpecs, tokens, numProcessed, parseGrace, nil)
+			_, skipped := err.(skippedRowError)
+			So(skipped, ShouldBeTrue)
+			So(bsonD, ShouldBeNil)
+			So(parseGrace.skippedRows, ShouldEqual, 1)
+		})
+		Convey("stop should return an error", func() {
+			parseGrace, err := NewParseGrace(Stop)
+			So(err, ShouldBeNil)
+			_, err = tokensToBSON(colSpecs, tokens, numProcessed, parseGrace, nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("An invalid parse grace should return an error", t, func() {
+		_, err := NewParseGrace("skipColumn")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseGraceJSONConvert(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("Given a JSON document with a value that fails to convert", t, func() {
+		data := []byte(`{a:"x",b:ObjectId("123"),c:{"$date":"soon"}}`)
+
+		Convey("autoCast should import the values as strings", func() {
+			parseGrace, err := NewParseGrace(AutoCast)
+			So(err, ShouldBeNil)
+			document, err := JSONConvertibleDoc{data: data, parseGrace: parseGrace}.Convert()
+			So(err, ShouldBeNil)
+			So(document, ShouldResemble, bson.D{
+				bson.DocElem{"a", "x"},
+				bson.DocElem{"b", "123"},
+				bson.DocElem{"c", `{"$date":"soon"}`},
+			})
+		})
+		Convey("skipField should leave out the fields", func() {
+			parseGrace, err := NewParseGrace(SkipField)
+			So(err, ShouldBeNil)
+			document, err := JSONConvertibleDoc{data: data, parseGrace: parseGrace}.Convert()
+			So(err, ShouldBeNil)
+			So(document, ShouldResemble, bson.D{bson.DocElem{"a", "x"}})
+			So(parseGrace.skippedFields, ShouldEqual, 2)
+		})
+		Convey("skipRow should return no document and an error skipping the row", func() {
+			parseGrace, err := NewParseGrace(SkipRow)
+			So(err, ShouldBeNil)
+			document, err := JSONConvertibleDoc{data: data, parseGrace: parseGrace}.Convert()
+			_, skipped := err.(skippedRowError)
+			So(skipped, ShouldBeTrue)
+			So(document, ShouldBeNil)
+		})
+		Convey("stop should return an error", func() {
+			_, err := JSONConvertibleDoc{data: data}.Convert()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseGraceStreamDocuments(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With rows skipped by the parse grace", t, func() {
+		colSpecs, err := ParseTypedHeaders([]string{"a.int32()"})
+		So(err, ShouldBeNil)
+		parseGrace, err := NewParseGrace(SkipRow)
+		So(err, ShouldBeNil)
+		rows := []string{"1", "two", "3", "four", "5"}
+
+		for _, ordered := range []bool{true, false} {
+			inputChannel := make(chan ConvertibleDoc, len(rows))
+			outputChannel := make(chan ConvertedDoc, len(rows))
+			for i, row := range rows {
+				inputChannel <- CSVConvertibleDoc{
+					colSpecs:     colSpecs,
+					data:         []string{row},
+					numProcessed: uint64(i + 1),
+					parseGrace:   parseGrace,
+				}
+			}
+			close(inputChannel)
+			So(streamDocuments(ordered, 3, inputChannel, outputChannel), ShouldBeNil)
+
+			documents := []bson.D{}
+			skipped := []uint64{}
+			for converted := range outputChannel {
+				if converted.Err != nil {
+					number, _ := converted.Source.Record()
+					skipped = append(skipped, number)
+					continue
+				}
+				documents = append(documents, converted.Document)
+			}
+			So(len(documents), ShouldEqual, 3)
+			if ordered {
+				So(documents, ShouldResemble, []bson.D{
+					bson.D{bson.DocElem{"a", int32(1)}},
+					bson.D{bson.DocElem{"a", int32(3)}},
+					bson.D{bson.DocElem{"a", int32(5)}},
+				})
+				So(skipped, ShouldResemble, []uint64{2, 4})
+			}
+		}
+		So(parseGrace.skippedRows, ShouldEqual, 4)
+	})
+}
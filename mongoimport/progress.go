@@ -0,0 +1,60 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// progress bar constants
+const progressBarLength = 24
+
+var progressBarWaitTime = time.Second * 3
+
+// countingReader counts the bytes read from the input source, before they're
+// decompressed or decoded, so that progress is measured against the size of
+// the input file
+type countingReader struct {
+	io.ReadCloser
+	count *int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	atomic.AddInt64(reader.count, int64(n))
+	return n, err
+}
+
+// newProgressBar returns a progress bar for the bytes read from the input,
+// against the size of the input file, and the documents imported from it.
+// Input of unknown size, such as stdin, is shown as a plain count.
+func (mongoImport *MongoImport) newProgressBar() *progress.ProgressBar {
+	name := mongoImport.inputName
+	if name == "" {
+		name = fmt.Sprintf("%v.%v", mongoImport.ToolOptions.DB, mongoImport.ToolOptions.Collection)
+	}
+	return &progress.ProgressBar{
+		Name:       name,
+		Max:        mongoImport.inputSize,
+		CounterPtr: &mongoImport.bytesRead,
+		Writer:     log.Writer(0),
+		BarLength:  progressBarLength,
+		IsBytes:    true,
+		Counters:   []progress.Counter{{Name: "docs", CounterPtr: &mongoImport.insertionCount}},
+		ShowRates:  true,
+	}
+}
+
+// trackProgress shows the progress of the import with the progress manager,
+// if there is one, and returns a function that stops showing it
+func (mongoImport *MongoImport) trackProgress() func() {
+	if mongoImport.progressManager == nil {
+		return func() {}
+	}
+	bar := mongoImport.newProgressBar()
+	mongoImport.progressManager.Attach(bar)
+	return func() { mongoImport.progressManager.Detach(bar) }
+}
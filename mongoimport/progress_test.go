@@ -0,0 +1,63 @@
+package mongoimport
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestImportProgress(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a mongoimport instance reading a CSV file", t, func() {
+		mongoImport, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		mongoImport.ToolOptions.Namespace.DB = "db"
+		mongoImport.ToolOptions.Namespace.Collection = "c"
+		mongoImport.InputOptions.Type = CSV
+		mongoImport.InputOptions.HeaderLine = true
+		mongoImport.InputOptions.File = "testdata/test_resume.csv"
+		fileInfo, err := os.Stat(mongoImport.InputOptions.File)
+		So(err, ShouldBeNil)
+
+		Convey("the bytes read should be counted against the size of the file", func() {
+			source, err := mongoImport.getSourceReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			_, err = io.Copy(ioutil.Discard, source)
+			So(err, ShouldBeNil)
+			So(mongoImport.bytesRead, ShouldEqual, fileInfo.Size())
+			bar := mongoImport.newProgressBar()
+			So(bar.Name, ShouldEqual, "db.c")
+			So(bar.Max, ShouldEqual, fileInfo.Size())
+		})
+		Convey("compressed input should be counted against the size of the compressed file", func() {
+			mongoImport.InputOptions.File = "testdata/test_resume.csv.gz"
+			gzInfo, err := os.Stat(mongoImport.InputOptions.File)
+			So(err, ShouldBeNil)
+			source, err := mongoImport.getSourceReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			_, err = io.Copy(ioutil.Discard, source)
+			So(err, ShouldBeNil)
+			So(mongoImport.bytesRead, ShouldEqual, gzInfo.Size())
+			So(mongoImport.inputSize, ShouldEqual, gzInfo.Size())
+		})
+		Convey("a resumed import should count from the checkpoint", func() {
+			mongoImport.resumeFrom = &Checkpoint{File: mongoImport.InputOptions.File, Offset: 11, Records: 1}
+			inputReader, source, err := mongoImport.openInputReader()
+			So(err, ShouldBeNil)
+			defer source.Close()
+			So(mongoImport.bytesRead, ShouldEqual, 11)
+			_, _, err = streamPositions(inputReader)
+			So(err, ShouldBeNil)
+			So(mongoImport.bytesRead, ShouldEqual, fileInfo.Size())
+		})
+		Convey("each of several files should have its own bar", func() {
+			bar := mongoImport.newFileImport("testdata/test_resume.csv").newProgressBar()
+			So(bar.Name, ShouldEqual, "testdata/test_resume.csv")
+		})
+	})
+}
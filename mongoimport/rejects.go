@@ -0,0 +1,82 @@
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// rejectedRecord is a line of the rejects file
+type rejectedRecord struct {
+	File   string `json:"file,omitempty"`
+	Record uint64 `json:"record"`
+	Reason string `json:"reason"`
+	Input  string `json:"input"`
+}
+
+// RejectsWriter writes input records that could not be imported to the
+// --rejectsFile, one JSON document per line, with the 1-based number of the
+// record, the reason it was rejected and the record in its original form.
+// It is safe for concurrent use. A nil *RejectsWriter discards rejected records.
+type RejectsWriter struct {
+	*rejectsOutput
+	// file is the input file of the records, when importing several files
+	file string
+}
+
+// rejectsOutput is shared by the RejectsWriters of all input files
+type rejectsOutput struct {
+	writer io.Writer
+	lock   sync.Mutex
+	count  uint64
+}
+
+// NewRejectsWriter returns a RejectsWriter writing to the given writer
+func NewRejectsWriter(writer io.Writer) *RejectsWriter {
+	return &RejectsWriter{rejectsOutput: &rejectsOutput{writer: writer}}
+}
+
+// ForFile returns a RejectsWriter to the same output that
+// also records the input file of each rejected record
+func (rejects *RejectsWriter) ForFile(file string) *RejectsWriter {
+	if rejects == nil {
+		return nil
+	}
+	return &RejectsWriter{rejectsOutput: rejects.rejectsOutput, file: file}
+}
+
+// Reject writes the record that the document was converted from,
+// along with the reason the document was rejected
+func (rejects *RejectsWriter) Reject(source ConvertibleDoc, reason error) error {
+	if rejects == nil {
+		return nil
+	}
+	rejected := rejectedRecord{File: rejects.file, Reason: reason.Error()}
+	if source != nil {
+		rejected.Record, rejected.Input = source.Record()
+	}
+	line, err := json.Marshal(rejected)
+	if err != nil {
+		return fmt.Errorf("error encoding rejected record #%v: %v", rejected.Record, err)
+	}
+	line = append(line, '\n')
+
+	rejects.lock.Lock()
+	defer rejects.lock.Unlock()
+	if _, err = rejects.writer.Write(line); err != nil {
+		return fmt.Errorf("error writing rejected record #%v: %v", rejected.Record, err)
+	}
+	rejects.count++
+	return nil
+}
+
+// Count returns the number of records rejected so far
+func (rejects *RejectsWriter) Count() uint64 {
+	if rejects == nil {
+		return 0
+	}
+	rejects.lock.Lock()
+	defer rejects.lock.Unlock()
+	return rejects.count
+}
@@ -0,0 +1,49 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestRejectsWriter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a rejects writer", t, func() {
+		buffer := &bytes.Buffer{}
+		rejects := NewRejectsWriter(buffer)
+		reason := fmt.Errorf("bad value")
+
+		Convey("CSV records should be written as they were read", func() {
+			source := CSVConvertibleDoc{data: []string{"a", `b "c",d`, "e"}, raw: `a, "b ""c"",d",e`, numProcessed: 3}
+			So(rejects.Reject(source, reason), ShouldBeNil)
+			So(buffer.String(), ShouldEqual,
+				`{"record":3,"reason":"bad value","input":"a, \"b \"\"c\"\",d\",e"}`+"\n")
+		})
+		Convey("TSV records should be written without their line endings", func() {
+			source := TSVConvertibleDoc{data: "a\tb\r\n", numProcessed: 2}
+			So(rejects.Reject(source, reason), ShouldBeNil)
+			So(buffer.String(), ShouldEqual,
+				`{"record":2,"reason":"bad value","input":"a\tb"}`+"\n")
+		})
+		Convey("JSON records should be written as their original text", func() {
+			source := JSONConvertibleDoc{data: []byte(`{a:1}`), numProcessed: 7}
+			So(rejects.Reject(source, reason), ShouldBeNil)
+			So(buffer.String(), ShouldEqual,
+				`{"record":7,"reason":"bad value","input":"{a:1}"}`+"\n")
+		})
+		Convey("each rejected record should be written on its own line and counted", func() {
+			So(rejects.Reject(TSVConvertibleDoc{data: "1", numProcessed: 1}, reason), ShouldBeNil)
+			So(rejects.Reject(TSVConvertibleDoc{data: "2", numProcessed: 2}, reason), ShouldBeNil)
+			So(len(strings.Split(strings.TrimSpace(buffer.String()), "\n")), ShouldEqual, 2)
+			So(rejects.Count(), ShouldEqual, 2)
+		})
+	})
+	Convey("A nil rejects writer should discard rejected records", t, func() {
+		var rejects *RejectsWriter
+		So(rejects.Reject(nil, fmt.Errorf("bad value")), ShouldBeNil)
+		So(rejects.Count(), ShouldEqual, 0)
+	})
+}
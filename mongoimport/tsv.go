@@ -16,8 +16,8 @@ const (
 // TSVInputReader is a struct that implements the InputReader interface for a
 // TSV input source
 type TSVInputReader struct {
-	// Fields is a list of field names in the BSON documents to be imported
-	Fields []string
+	// colSpecs is a list of column specifications in the BSON documents to be imported
+	colSpecs []ColumnSpec
 
 	// tsvReader is the underlying reader used to read data in from the TSV
 	// or TSV file
@@ -31,36 +31,104 @@ type TSVInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// parseGrace handles values that fail to parse
+	parseGrace *ParseGrace
+
+	// commentPrefix starts lines that are skipped, if not empty
+	commentPrefix string
+
+	// mapping renames, drops and adds fields of the documents
+	mapping *FieldMapping
+
+	// offset is the byte offset in the input of the end of the last line read
+	offset int64
 }
 
 // TSVConvertibleDoc implements the ConvertibleDoc interface for TSV input
 type TSVConvertibleDoc struct {
-	fields       []string
+	colSpecs     []ColumnSpec
 	data         string
-	numProcessed *uint64
+	numProcessed uint64
+	parseGrace   *ParseGrace
+	mapping      *FieldMapping
+	offset       int64
 }
 
 // NewTSVInputReader returns a TSVInputReader configured to read input from the
-// given io.Reader, extracting the specified fields only.
-func NewTSVInputReader(fields []string, in io.Reader, numDecoders int) *TSVInputReader {
+// given io.Reader, extracting only the specified columns and skipping lines
+// that start with the comment prefix, if it isn't empty. The columns are mapped
+// to fields with the given field mapping.
+func NewTSVInputReader(colSpecs []ColumnSpec, in io.Reader, numDecoders int, parseGrace *ParseGrace, commentPrefix string, mapping *FieldMapping) *TSVInputReader {
 	return &TSVInputReader{
-		Fields:       fields,
-		tsvReader:    bufio.NewReader(in),
-		numProcessed: uint64(0),
-		numDecoders:  numDecoders,
+		colSpecs:      colSpecs,
+		tsvReader:     bufio.NewReader(in),
+		numProcessed:  uint64(0),
+		numDecoders:   numDecoders,
+		parseGrace:    parseGrace,
+		commentPrefix: commentPrefix,
+		mapping:       mapping,
 	}
 }
 
 // ReadAndValidateHeader sets the import fields for a TSV importer
 func (tsvInputReader *TSVInputReader) ReadAndValidateHeader() (err error) {
-	header, err := tsvInputReader.tsvReader.ReadString(entryDelimiter)
+	fields, err := tsvInputReader.readHeader()
+	if err != nil {
+		return err
+	}
+	tsvInputReader.colSpecs = ParseAutoHeaders(fields)
+	return validateReaderFields(ColumnNames(tsvInputReader.colSpecs), tsvInputReader.mapping)
+}
+
+// ReadAndValidateTypedHeader sets the import fields and their types for a TSV importer
+func (tsvInputReader *TSVInputReader) ReadAndValidateTypedHeader() (err error) {
+	fields, err := tsvInputReader.readHeader()
 	if err != nil {
 		return err
 	}
+	tsvInputReader.colSpecs, err = ParseTypedHeaders(fields)
+	if err != nil {
+		return err
+	}
+	return validateReaderFields(ColumnNames(tsvInputReader.colSpecs), tsvInputReader.mapping)
+}
+
+// readLine reads the next line of input, skipping comment lines
+func (tsvInputReader *TSVInputReader) readLine() (string, error) {
+	for {
+		line, err := tsvInputReader.tsvReader.ReadString(entryDelimiter)
+		tsvInputReader.offset += int64(len(line))
+		if err != nil || tsvInputReader.commentPrefix == "" ||
+			!strings.HasPrefix(line, tsvInputReader.commentPrefix) {
+			return line, err
+		}
+	}
+}
+
+// readHeader reads the field names in the header line
+func (tsvInputReader *TSVInputReader) readHeader() ([]string, error) {
+	header, err := tsvInputReader.readLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{}
 	for _, field := range strings.Split(header, tokenSeparator) {
-		tsvInputReader.Fields = append(tsvInputReader.Fields, strings.TrimRight(field, "\r\n"))
+		fields = append(fields, strings.TrimRight(field, "\r\n"))
 	}
-	return validateReaderFields(tsvInputReader.Fields)
+	return fields, nil
+}
+
+// columnSpecs returns the columns of the TSV records
+func (tsvInputReader *TSVInputReader) columnSpecs() []ColumnSpec {
+	return tsvInputReader.colSpecs
+}
+
+// resumeAt continues reading TSV records after the given checkpoint
+func (tsvInputReader *TSVInputReader) resumeAt(colSpecs []ColumnSpec, checkpoint Checkpoint) {
+	tsvInputReader.colSpecs = colSpecs
+	tsvInputReader.numProcessed = checkpoint.Records
+	tsvInputReader.offset = checkpoint.Offset
 }
 
 // StreamDocument takes in two channels: it sends processed documents on the
@@ -68,12 +136,12 @@ func (tsvInputReader *TSVInputReader) ReadAndValidateHeader() (err error) {
 // errChan channel. It keeps reading from the underlying input source until it
 // hits EOF or an error. If ordered is true, it streams the documents in which
 // the documents are read
-func (tsvInputReader *TSVInputReader) StreamDocument(ordered bool, readDocChan chan bson.D, errChan chan error) {
+func (tsvInputReader *TSVInputReader) StreamDocument(ordered bool, readDocChan chan ConvertedDoc, errChan chan error) {
 	tsvRecordChan := make(chan ConvertibleDoc, tsvInputReader.numDecoders)
 	go func() {
 		var err error
 		for {
-			tsvInputReader.tsvRecord, err = tsvInputReader.tsvReader.ReadString(entryDelimiter)
+			tsvInputReader.tsvRecord, err = tsvInputReader.readLine()
 			if err != nil {
 				close(tsvRecordChan)
 				if err != io.EOF {
@@ -82,12 +150,15 @@ func (tsvInputReader *TSVInputReader) StreamDocument(ordered bool, readDocChan c
 				}
 				return
 			}
+			tsvInputReader.numProcessed++
 			tsvRecordChan <- TSVConvertibleDoc{
-				fields:       tsvInputReader.Fields,
+				colSpecs:     tsvInputReader.colSpecs,
 				data:         tsvInputReader.tsvRecord,
-				numProcessed: &tsvInputReader.numProcessed,
+				numProcessed: tsvInputReader.numProcessed,
+				parseGrace:   tsvInputReader.parseGrace,
+				mapping:      tsvInputReader.mapping,
+				offset:       tsvInputReader.offset,
 			}
-			tsvInputReader.numProcessed++
 		}
 	}()
 	errChan <- streamDocuments(ordered, tsvInputReader.numDecoders, tsvRecordChan, readDocChan)
@@ -96,13 +167,31 @@ func (tsvInputReader *TSVInputReader) StreamDocument(ordered bool, readDocChan c
 // This is required to satisfy the ConvertibleDoc interface for TSV input. It
 // does TSV-specific processing to convert the TSVConvertibleDoc to a bson.D
 func (tsvConvertibleDoc TSVConvertibleDoc) Convert() (bson.D, error) {
-	tsvTokens := strings.Split(
-		strings.TrimRight(tsvConvertibleDoc.data, "\r\n"),
-		tokenSeparator,
-	)
 	return tokensToBSON(
-		tsvConvertibleDoc.fields,
-		tsvTokens,
-		*tsvConvertibleDoc.numProcessed,
+		tsvConvertibleDoc.colSpecs,
+		tsvConvertibleDoc.tokens(),
+		tsvConvertibleDoc.numProcessed,
+		tsvConvertibleDoc.parseGrace,
+		tsvConvertibleDoc.mapping,
 	)
 }
+
+// tokens splits the TSV line into its values
+func (tsvConvertibleDoc TSVConvertibleDoc) tokens() []string {
+	return strings.Split(strings.TrimRight(tsvConvertibleDoc.data, "\r\n"), tokenSeparator)
+}
+
+// fieldTokens returns the text of the TSV line's values by field
+func (tsvConvertibleDoc TSVConvertibleDoc) fieldTokens() map[string]string {
+	return fieldTokens(tsvConvertibleDoc.colSpecs, tsvConvertibleDoc.tokens(), tsvConvertibleDoc.mapping)
+}
+
+// Record returns the number of the TSV line and the line itself
+func (tsvConvertibleDoc TSVConvertibleDoc) Record() (uint64, string) {
+	return tsvConvertibleDoc.numProcessed, strings.TrimRight(tsvConvertibleDoc.data, "\r\n")
+}
+
+// position returns the number of the TSV line and the byte offset of its end
+func (tsvConvertibleDoc TSVConvertibleDoc) position() (uint64, int64) {
+	return tsvConvertibleDoc.numProcessed, tsvConvertibleDoc.offset
+}
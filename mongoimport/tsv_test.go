@@ -21,11 +21,11 @@ func TestTSVStreamDocument(t *testing.T) {
 				bson.DocElem{"b", 2},
 				bson.DocElem{"c", "3e"},
 			}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go tsvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 
@@ -38,11 +38,11 @@ func TestTSVStreamDocument(t *testing.T) {
 				bson.DocElem{"c", "3e"},
 				bson.DocElem{"field3", " may"},
 			}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go tsvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 
@@ -55,11 +55,11 @@ func TestTSVStreamDocument(t *testing.T) {
 				bson.DocElem{"c", "Inline"},
 				bson.DocElem{"d", 14},
 			}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go tsvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).Document, ShouldResemble, expectedRead)
 			So(<-errChan, ShouldBeNil)
 		})
 
@@ -79,12 +79,12 @@ func TestTSVStreamDocument(t *testing.T) {
 					bson.DocElem{"c", 6},
 				},
 			}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go tsvInputReader.StreamDocument(true, docChan, errChan)
 			for i := 0; i < len(expectedReads); i++ {
-				for j, readDocument := range <-docChan {
+				for j, readDocument := range (<-docChan).Document {
 					So(readDocument.Name, ShouldEqual, expectedReads[i][j].Name)
 					So(readDocument.Value, ShouldEqual, expectedReads[i][j].Value)
 				}
@@ -106,12 +106,12 @@ func TestTSVStreamDocument(t *testing.T) {
 				bson.DocElem{"b", `"`},
 				bson.DocElem{"c", 6},
 			}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			errChan := make(chan error)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan ConvertedDoc, 1)
 			go tsvInputReader.StreamDocument(true, docChan, errChan)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).Document, ShouldResemble, expectedReadOne)
+			So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 			So(<-errChan, ShouldBeNil)
 		})
 
@@ -131,12 +131,12 @@ func TestTSVStreamDocument(t *testing.T) {
 				}
 				fileHandle, err := os.Open("testdata/test.tsv")
 				So(err, ShouldBeNil)
-				tsvInputReader := NewTSVInputReader(fields, fileHandle, 1)
+				tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), fileHandle, 1, nil, "", nil)
 				errChan := make(chan error)
-				docChan := make(chan bson.D, 1)
+				docChan := make(chan ConvertedDoc, 1)
 				go tsvInputReader.StreamDocument(true, docChan, errChan)
-				So(<-docChan, ShouldResemble, expectedReadOne)
-				So(<-docChan, ShouldResemble, expectedReadTwo)
+				So((<-docChan).Document, ShouldResemble, expectedReadOne)
+				So((<-docChan).Document, ShouldResemble, expectedReadTwo)
 				So(<-errChan, ShouldBeNil)
 			})
 	})
@@ -148,9 +148,22 @@ func TestTSVReadAndValidateHeader(t *testing.T) {
 		Convey("setting the header should read the first line of the TSV", func() {
 			contents := "extraHeader1\textraHeader2\textraHeader3\n"
 			fields := []string{}
-			tsvInputReader := NewTSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			tsvInputReader := NewTSVInputReader(ParseAutoHeaders(fields), bytes.NewReader([]byte(contents)), 1, nil, "", nil)
 			So(tsvInputReader.ReadAndValidateHeader(), ShouldBeNil)
-			So(len(tsvInputReader.Fields), ShouldEqual, 3)
+			So(len(tsvInputReader.colSpecs), ShouldEqual, 3)
+		})
+		Convey("lines starting with the comment prefix should be skipped", func() {
+			contents := "# exported today\na\tb\n# 0\t0\n1\t2\n"
+			tsvInputReader := NewTSVInputReader(nil, bytes.NewReader([]byte(contents)), 1, nil, "#", nil)
+			So(tsvInputReader.ReadAndValidateHeader(), ShouldBeNil)
+			So(ColumnNames(tsvInputReader.colSpecs), ShouldResemble, []string{"a", "b"})
+			errChan := make(chan error, 1)
+			docChan := make(chan ConvertedDoc, 2)
+			tsvInputReader.StreamDocument(true, docChan, errChan)
+			So(<-errChan, ShouldBeNil)
+			So((<-docChan).Document, ShouldResemble, bson.D{bson.DocElem{"a", 1}, bson.DocElem{"b", 2}})
+			_, open := <-docChan
+			So(open, ShouldBeFalse)
 		})
 	})
 }
@@ -161,9 +174,9 @@ func TestTSVConvert(t *testing.T) {
 		Convey("calling convert on a TSVConvertibleDoc should return the expected BSON document", func() {
 			numProcessed := uint64(0)
 			tsvConvertibleDoc := TSVConvertibleDoc{
-				fields:       []string{"field1", "field2", "field3"},
+				colSpecs:     ParseAutoHeaders([]string{"field1", "field2", "field3"}),
 				data:         "a\tb\tc",
-				numProcessed: &numProcessed,
+				numProcessed: numProcessed,
 			}
 			expectedDocument := bson.D{
 				bson.DocElem{"field1", "a"},
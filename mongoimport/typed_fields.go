@@ -0,0 +1,225 @@
+package mongoimport
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnSpec describes a column of CSV or TSV input: the name of the field
+// it is imported to, and how its values are parsed
+type ColumnSpec struct {
+	Name     string
+	Parser   FieldParser
+	TypeName string
+}
+
+// FieldParser converts the string value of a column to the type of its field
+type FieldParser interface {
+	Parse(in string) (interface{}, error)
+}
+
+// ColumnNames returns the field names of the given columns
+func ColumnNames(colSpecs []ColumnSpec) []string {
+	names := make([]string, len(colSpecs))
+	for i, colSpec := range colSpecs {
+		names[i] = colSpec.Name
+	}
+	return names
+}
+
+// ParseAutoHeaders returns columns for the given field names whose
+// types are guessed from their values, as done without --columnsHaveTypes
+func ParseAutoHeaders(headers []string) []ColumnSpec {
+	colSpecs := make([]ColumnSpec, len(headers))
+	for i, header := range headers {
+		colSpecs[i] = ColumnSpec{
+			Name:     header,
+			Parser:   new(FieldAutoParser),
+			TypeName: "auto",
+		}
+	}
+	return colSpecs
+}
+
+// ParseTypedHeaders returns columns for the given typed field names
+func ParseTypedHeaders(headers []string) ([]ColumnSpec, error) {
+	colSpecs := make([]ColumnSpec, len(headers))
+	for i, header := range headers {
+		colSpec, err := ParseTypedHeader(header)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing type of column #%v ('%v'): %v", i+1, header, err)
+		}
+		colSpecs[i] = colSpec
+	}
+	return colSpecs, nil
+}
+
+// ParseTypedHeader parses a field name with a type, written as
+// "<field>.<type>(<argument>)", e.g. "zip.string()" or
+// "created.date(2006-01-02 15:04:05)". Date layouts use the
+// reference time of Go's time package.
+func ParseTypedHeader(header string) (ColumnSpec, error) {
+	openParen := strings.Index(header, "(")
+	if openParen == -1 || !strings.HasSuffix(header, ")") {
+		return ColumnSpec{}, fmt.Errorf("expected a type such as '.string()' at the end of the field name")
+	}
+	typeDot := strings.LastIndex(header[:openParen], ".")
+	if typeDot == -1 {
+		return ColumnSpec{}, fmt.Errorf("expected a type such as '.string()' at the end of the field name")
+	}
+	name := header[:typeDot]
+	typeName := header[typeDot+1 : openParen]
+	arg := header[openParen+1 : len(header)-1]
+	if name == "" {
+		return ColumnSpec{}, fmt.Errorf("field name is empty")
+	}
+	parser, err := NewFieldParser(typeName, arg)
+	if err != nil {
+		return ColumnSpec{}, err
+	}
+	return ColumnSpec{Name: name, Parser: parser, TypeName: typeName}, nil
+}
+
+// NewFieldParser returns the parser for a type and its argument
+func NewFieldParser(typeName, arg string) (FieldParser, error) {
+	noArg := func(parser FieldParser) (FieldParser, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("type %v does not take an argument", typeName)
+		}
+		return parser, nil
+	}
+	switch typeName {
+	case "auto":
+		return noArg(new(FieldAutoParser))
+	case "string":
+		return noArg(new(FieldStringParser))
+	case "int32":
+		return noArg(new(FieldInt32Parser))
+	case "int64":
+		return noArg(new(FieldInt64Parser))
+	case "double":
+		return noArg(new(FieldDoubleParser))
+	case "boolean":
+		return noArg(new(FieldBooleanParser))
+	case "objectId":
+		return noArg(new(FieldObjectIdParser))
+	case "date":
+		if arg == "" {
+			return nil, fmt.Errorf("type date requires a layout, e.g. date(2006-01-02)")
+		}
+		return &FieldDateParser{Layout: arg}, nil
+	case "binary":
+		switch arg {
+		case "base64", "base32", "hex":
+			return &FieldBinaryParser{Encoding: arg}, nil
+		}
+		return nil, fmt.Errorf("type binary requires an encoding of base64, base32 or hex, e.g. binary(base64)")
+	}
+	return nil, fmt.Errorf("unknown type '%v'", typeName)
+}
+
+// FieldAutoParser guesses the type of a value with getParsedValue
+type FieldAutoParser struct{}
+
+func (parser *FieldAutoParser) Parse(in string) (interface{}, error) {
+	return getParsedValue(in), nil
+}
+
+type FieldStringParser struct{}
+
+func (parser *FieldStringParser) Parse(in string) (interface{}, error) {
+	return in, nil
+}
+
+type FieldInt32Parser struct{}
+
+func (parser *FieldInt32Parser) Parse(in string) (interface{}, error) {
+	value, err := strconv.ParseInt(in, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not a 32-bit integer", in)
+	}
+	return int32(value), nil
+}
+
+type FieldInt64Parser struct{}
+
+func (parser *FieldInt64Parser) Parse(in string) (interface{}, error) {
+	value, err := strconv.ParseInt(in, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not a 64-bit integer", in)
+	}
+	return value, nil
+}
+
+type FieldDoubleParser struct{}
+
+func (parser *FieldDoubleParser) Parse(in string) (interface{}, error) {
+	value, err := strconv.ParseFloat(in, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not a number", in)
+	}
+	return value, nil
+}
+
+// FieldBooleanParser accepts true/false, t/f, yes/no and 1/0, ignoring case
+type FieldBooleanParser struct{}
+
+func (parser *FieldBooleanParser) Parse(in string) (interface{}, error) {
+	switch strings.ToLower(in) {
+	case "true", "t", "yes", "1":
+		return true, nil
+	case "false", "f", "no", "0":
+		return false, nil
+	}
+	return nil, fmt.Errorf("'%v' is not a boolean", in)
+}
+
+// FieldDateParser parses dates with a layout for Go's time.Parse
+type FieldDateParser struct {
+	Layout string
+}
+
+func (parser *FieldDateParser) Parse(in string) (interface{}, error) {
+	value, err := time.Parse(parser.Layout, in)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not a date of the form '%v'", in, parser.Layout)
+	}
+	return value, nil
+}
+
+// FieldBinaryParser decodes binary data encoded as base64, base32 or hex
+type FieldBinaryParser struct {
+	Encoding string
+}
+
+func (parser *FieldBinaryParser) Parse(in string) (interface{}, error) {
+	var value []byte
+	var err error
+	switch parser.Encoding {
+	case "base64":
+		value, err = base64.StdEncoding.DecodeString(in)
+	case "base32":
+		value, err = base32.StdEncoding.DecodeString(in)
+	case "hex":
+		value, err = hex.DecodeString(in)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not valid %v", in, parser.Encoding)
+	}
+	return value, nil
+}
+
+type FieldObjectIdParser struct{}
+
+func (parser *FieldObjectIdParser) Parse(in string) (interface{}, error) {
+	if !bson.IsObjectIdHex(in) {
+		return nil, fmt.Errorf("'%v' is not an ObjectId", in)
+	}
+	return bson.ObjectIdHex(in), nil
+}
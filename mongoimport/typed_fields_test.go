@@ -0,0 +1,100 @@
+package mongoimport
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestParseTypedHeader(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With a typed header field", t, func() {
+		Convey("the field name, type and argument should be parsed", func() {
+			colSpec, err := ParseTypedHeader("created.date(2006-01-02 15:04:05)")
+			So(err, ShouldBeNil)
+			So(colSpec.Name, ShouldEqual, "created")
+			So(colSpec.TypeName, ShouldEqual, "date")
+			So(colSpec.Parser, ShouldResemble, &FieldDateParser{Layout: "2006-01-02 15:04:05"})
+		})
+		Convey("nested field names should be kept whole", func() {
+			colSpec, err := ParseTypedHeader("address.zip.string()")
+			So(err, ShouldBeNil)
+			So(colSpec.Name, ShouldEqual, "address.zip")
+			So(colSpec.TypeName, ShouldEqual, "string")
+		})
+		Convey("fields without a type should return an error", func() {
+			_, err := ParseTypedHeader("zip")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("zip()")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader(".string()")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("unknown types and bad arguments should return an error", func() {
+			_, err := ParseTypedHeader("zip.zipcode()")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("zip.string(x)")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("created.date()")
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("raw.binary(base16)")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("errors from a list of fields should name the column", func() {
+			_, err := ParseTypedHeaders([]string{"a.string()", "b"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "column #2")
+		})
+	})
+}
+
+func TestFieldParsers(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With field parsers", t, func() {
+		Convey("valid values should be parsed to their types", func() {
+			tests := []struct {
+				parser   FieldParser
+				in       string
+				expected interface{}
+			}{
+				{new(FieldAutoParser), "12", 12},
+				{new(FieldStringParser), "12", "12"},
+				{new(FieldInt32Parser), "-12", int32(-12)},
+				{new(FieldInt64Parser), "8589934592", int64(8589934592)},
+				{new(FieldDoubleParser), "1.5", 1.5},
+				{new(FieldBooleanParser), "Yes", true},
+				{new(FieldBooleanParser), "0", false},
+				{&FieldDateParser{Layout: "2006-01-02"}, "2015-03-04", time.Date(2015, 3, 4, 0, 0, 0, 0, time.UTC)},
+				{&FieldBinaryParser{Encoding: "base64"}, "aGk=", []byte("hi")},
+				{&FieldBinaryParser{Encoding: "base32"}, "NBUQ====", []byte("hi")},
+				{&FieldBinaryParser{Encoding: "hex"}, "6869", []byte("hi")},
+				{new(FieldObjectIdParser), "55a7b7b0b7e4b4a0d0c0ffee", bson.ObjectIdHex("55a7b7b0b7e4b4a0d0c0ffee")},
+			}
+			for _, test := range tests {
+				value, err := test.parser.Parse(test.in)
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, test.expected)
+			}
+		})
+		Convey("invalid values should return an error", func() {
+			tests := []struct {
+				parser FieldParser
+				in     string
+			}{
+				{new(FieldInt32Parser), "8589934592"},
+				{new(FieldInt64Parser), "1.5"},
+				{new(FieldDoubleParser), "one"},
+				{new(FieldBooleanParser), "maybe"},
+				{&FieldDateParser{Layout: "2006-01-02"}, "03/04/2015"},
+				{&FieldBinaryParser{Encoding: "hex"}, "zz"},
+				{new(FieldObjectIdParser), "12345"},
+			}
+			for _, test := range tests {
+				_, err := test.parser.Parse(test.in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
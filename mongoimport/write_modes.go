@@ -0,0 +1,381 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// import mode constants, for values of --mode
+const (
+	ModeInsert = "insert"
+	ModeUpsert = "upsert"
+	ModeMerge  = "merge"
+	ModeDelete = "delete"
+)
+
+// write command constants
+const (
+	insertCommand = "insert"
+	updateCommand = "update"
+	deleteCommand = "delete"
+
+	// maxWriteBatchSize is the most statements the server accepts in one write command
+	maxWriteBatchSize = 1000
+	// maxWriteCommandSize leaves room in a write command for the fields around its statements
+	maxWriteCommandSize = maxBSONSize - 16*1024
+)
+
+// writeStatement is a single insert, update or delete in a write command
+type writeStatement struct {
+	// selector matches the documents to update or delete; nil for inserts
+	selector bson.D
+	// document is the document to insert, or the replacement or update
+	// for the matched documents; nil for deletes
+	document interface{}
+	// source is the input record the statement was made from, to reject if it fails
+	source ConvertibleDoc
+}
+
+// commandDocument returns the statement as it is sent in a write command
+func (statement writeStatement) commandDocument(command string) interface{} {
+	switch command {
+	case insertCommand:
+		return statement.document
+	case deleteCommand:
+		return bson.D{{"q", statement.selector}, {"limit", 0}}
+	}
+	return bson.D{{"q", statement.selector}, {"u", statement.document}, {"upsert", true}}
+}
+
+// writeCommandStatementsKey returns the field of a write command holding its statements
+func writeCommandStatementsKey(command string) string {
+	if command == insertCommand {
+		return "documents"
+	}
+	return command + "s"
+}
+
+// writeBatch buffers consecutive statements of the same kind, to be sent together
+type writeBatch struct {
+	command    string
+	statements []writeStatement
+	size       int
+}
+
+func (batch *writeBatch) reset() {
+	batch.command = ""
+	batch.statements = batch.statements[:0]
+	batch.size = 0
+}
+
+// writeCommandError is an error from the writeErrors or
+// writeConcernError fields of a write command's reply
+type writeCommandError struct {
+	Index  int    `bson:"index"`
+	Code   int    `bson:"code"`
+	ErrMsg string `bson:"errmsg"`
+}
+
+func (writeError *writeCommandError) Error() string {
+	return writeError.ErrMsg
+}
+
+// writeCommandResult holds the errors reported in a write command's reply
+type writeCommandResult struct {
+	WriteErrors       []writeCommandError `bson:"writeErrors"`
+	WriteConcernError *writeCommandError  `bson:"writeConcernError"`
+}
+
+// importMode returns the --mode to import with. If none is set, it
+// defaults to upsert if --upsert is set, and insert otherwise.
+func (mongoImport *MongoImport) importMode() string {
+	if mongoImport.IngestOptions.Mode != "" {
+		return mongoImport.IngestOptions.Mode
+	}
+	if mongoImport.IngestOptions.Upsert {
+		return ModeUpsert
+	}
+	return ModeInsert
+}
+
+// newWriteStatement returns the write command and statement for a document,
+// according to the import mode. Documents without any of the upsert fields
+// are inserted, or skipped if deleting, in which case the command is empty.
+func (mongoImport *MongoImport) newWriteStatement(document bson.D, rawDocument bson.Raw) (string, writeStatement) {
+	mode := mongoImport.importMode()
+	if mode == ModeInsert {
+		return insertCommand, writeStatement{document: rawDocument}
+	}
+	selector := constructUpsertDocument(mongoImport.upsertFields, document)
+	if selector == nil {
+		if mode == ModeDelete {
+			log.Logf(log.Info, "skipping document without any upsert fields to delete by: %v", document)
+			return "", writeStatement{}
+		}
+		return insertCommand, writeStatement{document: rawDocument}
+	}
+	switch mode {
+	case ModeMerge:
+		return updateCommand, writeStatement{selector: selector, document: mergeUpdate(document)}
+	case ModeDelete:
+		return deleteCommand, writeStatement{selector: selector}
+	}
+	return updateCommand, writeStatement{selector: selector, document: rawDocument}
+}
+
+// mergeUpdate returns an update that sets only the fields in the document.
+// Embedded documents are set field by field, so that fields already in the
+// matched document but missing from the import are kept. The _id is only
+// set when inserting, since it can't be changed.
+func mergeUpdate(document bson.D) bson.D {
+	set := bson.D{}
+	update := bson.D{}
+	for _, elem := range document {
+		if elem.Name == "_id" {
+			update = append(update, bson.DocElem{"$setOnInsert", bson.D{elem}})
+			continue
+		}
+		set = appendSetFields(set, elem.Name, elem.Value)
+	}
+	if len(set) != 0 {
+		update = append(bson.D{{"$set", set}}, update...)
+	}
+	return update
+}
+
+// appendSetFields appends the value to the $set document, with the fields
+// of embedded documents as dotted paths
+func appendSetFields(set bson.D, name string, value interface{}) bson.D {
+	subDocument, ok := value.(bson.D)
+	if !ok || len(subDocument) == 0 {
+		return append(set, bson.DocElem{name, value})
+	}
+	for _, elem := range subDocument {
+		set = appendSetFields(set, name+"."+elem.Name, elem.Value)
+	}
+	return set
+}
+
+// writeDocuments inserts, upserts, merges or deletes documents according to
+// the import mode. Consecutive statements of the same kind are batched into
+// single write commands, preserving the order of the documents. The sources
+// of the documents are the records that are rejected if their writes fail.
+func (mongoImport *MongoImport) writeDocuments(documents []bson.Raw, sources []ConvertibleDoc, collection *mgo.Collection) (numWritten int, err error) {
+	batch := &writeBatch{}
+	flush := func() error {
+		n, err := mongoImport.runWriteBatch(batch, collection)
+		numWritten += n
+		batch.reset()
+		return err
+	}
+	for index, rawDocument := range documents {
+		document := bson.D{}
+		if mongoImport.importMode() != ModeInsert {
+			if err = bson.Unmarshal(rawDocument.Data, &document); err != nil {
+				return numWritten, fmt.Errorf("error unmarshaling document: %v", err)
+			}
+		}
+		command, statement := mongoImport.newWriteStatement(document, rawDocument)
+		if command == "" {
+			continue
+		}
+		statement.source = sources[index]
+		size := len(rawDocument.Data)
+		if command != insertCommand {
+			commandBytes, err := bson.Marshal(statement.commandDocument(command))
+			if err != nil {
+				return numWritten, fmt.Errorf("error marshaling %v statement: %v", command, err)
+			}
+			size = len(commandBytes)
+		}
+		if batch.command != command || len(batch.statements) == maxWriteBatchSize ||
+			batch.size+size > maxWriteCommandSize {
+			if err = flush(); err != nil {
+				return numWritten, err
+			}
+		}
+		batch.command = command
+		batch.statements = append(batch.statements, statement)
+		batch.size += size
+	}
+	return numWritten, flush()
+}
+
+// runWriteBatch sends the batched statements to the server, returning the
+// number that succeeded. Inserts are sent in a single unordered command unless
+// --maintainInsertionOrder is set. Other statements are applied in order;
+// after an error that doesn't stop the import, the statements following it
+// are sent again. The sources of failed statements are rejected.
+func (mongoImport *MongoImport) runWriteBatch(batch *writeBatch, collection *mgo.Collection) (int, error) {
+	if len(batch.statements) == 0 {
+		return 0, nil
+	}
+	stopOnError := mongoImport.IngestOptions.StopOnError
+	ordered := mongoImport.IngestOptions.MaintainInsertionOrder
+	// without rejects, inserts don't need the errors of each document
+	if batch.command == insertCommand && mongoImport.rejects == nil {
+		bulk := collection.Bulk()
+		for _, statement := range batch.statements {
+			bulk.Insert(statement.document)
+		}
+		if !ordered {
+			bulk.Unordered()
+		}
+		if _, err := bulk.Run(); err != nil {
+			return 0, filterIngestError(stopOnError, err)
+		}
+		return len(batch.statements), nil
+	}
+	if !mongoImport.supportsWriteCommands {
+		return mongoImport.runLegacyWrites(batch, collection)
+	}
+	if batch.command == insertCommand && !ordered {
+		return mongoImport.runUnorderedInserts(batch, collection)
+	}
+
+	numWritten := 0
+	statements := batch.statements
+	for len(statements) != 0 {
+		commandDocuments := make([]interface{}, len(statements))
+		for i, statement := range statements {
+			commandDocuments[i] = statement.commandDocument(batch.command)
+		}
+		result := writeCommandResult{}
+		err := collection.Database.Run(bson.D{
+			{batch.command, collection.Name},
+			{writeCommandStatementsKey(batch.command), commandDocuments},
+			{"ordered", true},
+			{"writeConcern", writeConcernDocument(collection.Database.Session.Safe())},
+		}, &result)
+		if err != nil {
+			for _, statement := range statements {
+				if rejectErr := mongoImport.rejects.Reject(statement.source, err); rejectErr != nil {
+					return numWritten, rejectErr
+				}
+			}
+			return numWritten, filterIngestError(stopOnError, err)
+		}
+		if result.WriteConcernError != nil {
+			if err = filterIngestError(stopOnError, result.WriteConcernError); err != nil {
+				return numWritten, err
+			}
+		}
+		if len(result.WriteErrors) == 0 {
+			numWritten += len(statements)
+			break
+		}
+		writeError := result.WriteErrors[0]
+		numWritten += writeError.Index
+		if err = mongoImport.rejects.Reject(statements[writeError.Index].source, &writeError); err != nil {
+			return numWritten, err
+		}
+		if err = filterIngestError(stopOnError, &writeError); err != nil {
+			return numWritten, err
+		}
+		statements = statements[writeError.Index+1:]
+	}
+	return numWritten, nil
+}
+
+// runUnorderedInserts sends the batched inserts in a single unordered insert
+// command, so that the server applies all of them however many fail, and
+// rejects the source of every insert in its writeErrors
+func (mongoImport *MongoImport) runUnorderedInserts(batch *writeBatch, collection *mgo.Collection) (int, error) {
+	documents := make([]interface{}, len(batch.statements))
+	for i, statement := range batch.statements {
+		documents[i] = statement.document
+	}
+	result := writeCommandResult{}
+	err := collection.Database.Run(bson.D{
+		{insertCommand, collection.Name},
+		{writeCommandStatementsKey(insertCommand), documents},
+		{"ordered", false},
+		{"writeConcern", writeConcernDocument(collection.Database.Session.Safe())},
+	}, &result)
+	if err != nil {
+		for _, statement := range batch.statements {
+			if rejectErr := mongoImport.rejects.Reject(statement.source, err); rejectErr != nil {
+				return 0, rejectErr
+			}
+		}
+		return 0, filterIngestError(mongoImport.IngestOptions.StopOnError, err)
+	}
+	return mongoImport.rejectWriteErrors(batch.statements, result)
+}
+
+// rejectWriteErrors rejects the sources of the statements in the writeErrors
+// of an unordered write command's reply, returning the number of statements
+// that succeeded and the first error that stops the import, if any
+func (mongoImport *MongoImport) rejectWriteErrors(statements []writeStatement, result writeCommandResult) (int, error) {
+	stopOnError := mongoImport.IngestOptions.StopOnError
+	var stopErr error
+	if result.WriteConcernError != nil {
+		stopErr = filterIngestError(stopOnError, result.WriteConcernError)
+	}
+	numWritten := len(statements)
+	for i := range result.WriteErrors {
+		writeError := &result.WriteErrors[i]
+		if writeError.Index < 0 || writeError.Index >= len(statements) {
+			continue
+		}
+		numWritten--
+		if err := mongoImport.rejects.Reject(statements[writeError.Index].source, writeError); err != nil {
+			return numWritten, err
+		}
+		if err := filterIngestError(stopOnError, writeError); err != nil && stopErr == nil {
+			stopErr = err
+		}
+	}
+	return numWritten, stopErr
+}
+
+// runLegacyWrites applies the batched statements one at a time, for
+// servers that don't support write commands
+func (mongoImport *MongoImport) runLegacyWrites(batch *writeBatch, collection *mgo.Collection) (numWritten int, err error) {
+	stopOnError := mongoImport.IngestOptions.StopOnError
+	for _, statement := range batch.statements {
+		switch batch.command {
+		case insertCommand:
+			err = collection.Insert(statement.document)
+		case deleteCommand:
+			_, err = collection.RemoveAll(statement.selector)
+		default:
+			_, err = collection.Upsert(statement.selector, statement.document)
+		}
+		if err == nil {
+			numWritten++
+		} else if rejectErr := mongoImport.rejects.Reject(statement.source, err); rejectErr != nil {
+			return numWritten, rejectErr
+		}
+		if err = filterIngestError(stopOnError, err); err != nil {
+			return numWritten, err
+		}
+	}
+	return numWritten, nil
+}
+
+// writeConcernDocument returns the write concern of a write command
+// for the given session safety
+func writeConcernDocument(safe *mgo.Safe) bson.D {
+	if safe == nil {
+		return bson.D{{"w", 0}}
+	}
+	writeConcern := bson.D{}
+	if safe.WMode != "" {
+		writeConcern = append(writeConcern, bson.DocElem{"w", safe.WMode})
+	} else if safe.W > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{"w", safe.W})
+	}
+	if safe.WTimeout > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{"wtimeout", safe.WTimeout})
+	}
+	if safe.J {
+		writeConcern = append(writeConcern, bson.DocElem{"j", true})
+	}
+	if safe.FSync {
+		writeConcern = append(writeConcern, bson.DocElem{"fsync", true})
+	}
+	return writeConcern
+}
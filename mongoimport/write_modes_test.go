@@ -0,0 +1,145 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestNewWriteStatement(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("Given a document read from the import", t, func() {
+		documentBytes, err := bson.Marshal(bson.D{{"_id", 1}, {"a", bson.D{{"b", 2}, {"c", 3}}}, {"d", "x"}})
+		So(err, ShouldBeNil)
+		rawDocument := bson.Raw{3, documentBytes}
+		document := bson.D{}
+		So(bson.Unmarshal(documentBytes, &document), ShouldBeNil)
+		mongoImport := &MongoImport{
+			IngestOptions: &IngestOptions{},
+			upsertFields:  []string{"_id"},
+		}
+
+		Convey("upsert mode should replace the document matching the upsert fields", func() {
+			mongoImport.IngestOptions.Mode = ModeUpsert
+			command, statement := mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, updateCommand)
+			So(statement.selector, ShouldResemble, bson.D{{"_id", 1}})
+			So(statement.document, ShouldResemble, rawDocument)
+			So(statement.commandDocument(command), ShouldResemble, bson.D{
+				{"q", bson.D{{"_id", 1}}},
+				{"u", rawDocument},
+				{"upsert", true},
+			})
+		})
+		Convey("merge mode should set the fields of the document in order", func() {
+			mongoImport.IngestOptions.Mode = ModeMerge
+			command, statement := mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, updateCommand)
+			So(statement.document, ShouldResemble, bson.D{
+				{"$set", bson.D{{"a.b", 2}, {"a.c", 3}, {"d", "x"}}},
+				{"$setOnInsert", bson.D{{"_id", 1}}},
+			})
+		})
+		Convey("delete mode should remove the documents matching the upsert fields", func() {
+			mongoImport.IngestOptions.Mode = ModeDelete
+			command, statement := mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, deleteCommand)
+			So(statement.commandDocument(command), ShouldResemble, bson.D{
+				{"q", bson.D{{"_id", 1}}},
+				{"limit", 0},
+			})
+		})
+		Convey("--upsert without a mode should upsert", func() {
+			mongoImport.IngestOptions.Upsert = true
+			command, statement := mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, updateCommand)
+			So(statement.document, ShouldResemble, rawDocument)
+		})
+		Convey("documents without any upsert fields should be inserted, or skipped when deleting", func() {
+			mongoImport.upsertFields = []string{"e"}
+			mongoImport.IngestOptions.Mode = ModeMerge
+			command, statement := mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, insertCommand)
+			So(statement.document, ShouldResemble, rawDocument)
+
+			mongoImport.IngestOptions.Mode = ModeDelete
+			command, _ = mongoImport.newWriteStatement(document, rawDocument)
+			So(command, ShouldEqual, "")
+		})
+	})
+}
+
+func TestMergeUpdate(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With documents to merge", t, func() {
+		Convey("empty embedded documents should be set as values", func() {
+			So(mergeUpdate(bson.D{{"a", bson.D{}}}), ShouldResemble, bson.D{
+				{"$set", bson.D{{"a", bson.D{}}}},
+			})
+		})
+		Convey("a document with only an _id should only set it on insert", func() {
+			So(mergeUpdate(bson.D{{"_id", 1}}), ShouldResemble, bson.D{
+				{"$setOnInsert", bson.D{{"_id", 1}}},
+			})
+		})
+	})
+}
+
+func TestWriteConcernDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With session safety settings", t, func() {
+		Convey("unacknowledged writes should have w of 0", func() {
+			So(writeConcernDocument(nil), ShouldResemble, bson.D{{"w", 0}})
+		})
+		Convey("the write concern should include the set options", func() {
+			So(writeConcernDocument(&mgo.Safe{WMode: "majority", WTimeout: 500, J: true}), ShouldResemble, bson.D{
+				{"w", "majority"},
+				{"wtimeout", 500},
+				{"j", true},
+			})
+			So(writeConcernDocument(&mgo.Safe{W: 2, FSync: true}), ShouldResemble, bson.D{
+				{"w", 2},
+				{"fsync", true},
+			})
+		})
+	})
+}
+
+func TestRejectWriteErrors(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+	Convey("With the reply to an unordered insert with some failed writes", t, func() {
+		statements := make([]writeStatement, 4)
+		for i := range statements {
+			statements[i].source = TSVConvertibleDoc{data: fmt.Sprintf("%v", i+1), numProcessed: uint64(i + 1)}
+		}
+		result := writeCommandResult{WriteErrors: []writeCommandError{
+			{Index: 1, Code: 11000, ErrMsg: "duplicate key"},
+			{Index: 3, Code: 11000, ErrMsg: "duplicate key"},
+		}}
+		buffer := &bytes.Buffer{}
+		mongoImport := &MongoImport{IngestOptions: &IngestOptions{}, rejects: NewRejectsWriter(buffer)}
+
+		Convey("every failed insert should be rejected from the one reply", func() {
+			numWritten, err := mongoImport.rejectWriteErrors(statements, result)
+			So(err, ShouldBeNil)
+			So(numWritten, ShouldEqual, 2)
+			So(mongoImport.rejects.Count(), ShouldEqual, 2)
+			So(buffer.String(), ShouldContainSubstring, `"record":2`)
+			So(buffer.String(), ShouldContainSubstring, `"record":4`)
+		})
+		Convey("with --stopOnError, the failed inserts should still all be rejected", func() {
+			mongoImport.IngestOptions.StopOnError = true
+			numWritten, err := mongoImport.rejectWriteErrors(statements, result)
+			So(err, ShouldNotBeNil)
+			So(numWritten, ShouldEqual, 2)
+			So(mongoImport.rejects.Count(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,284 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxReportedProblems is the most problems listed for each namespace;
+// beyond it, problems are only counted, so that a dump with a bad document
+// in every position doesn't hold every error in memory
+const maxReportedProblems = 20
+
+// NamespaceReport describes what a restore would do to one namespace,
+// and any problems found in the dump files that it would be restored from.
+type NamespaceReport struct {
+	Namespace string
+
+	// Exists is true if the collection is already on the target server
+	Exists bool
+	// Drop is true if the existing collection would be dropped first
+	Drop bool
+	// Create is true if the collection would be created from metadata options
+	Create bool
+	// Replay is true for the oplog, whose entries would be replayed
+	Replay bool
+
+	Documents int64
+	Bytes     int64
+	Indexes   []string
+
+	Problems []string
+	// OmittedProblems counts the problems beyond maxReportedProblems
+	OmittedProblems int
+}
+
+func (report *NamespaceReport) addProblem(format string, a ...interface{}) {
+	if len(report.Problems) >= maxReportedProblems {
+		report.OmittedProblems++
+		return
+	}
+	report.Problems = append(report.Problems, fmt.Sprintf(format, a...))
+}
+
+// ProblemCount returns the number of problems found, including omitted ones
+func (report *NamespaceReport) ProblemCount() int {
+	return len(report.Problems) + report.OmittedProblems
+}
+
+// Action summarizes how the collection would be affected
+func (report *NamespaceReport) Action() string {
+	switch {
+	case report.Replay:
+		return "replay"
+	case report.Drop && report.Create:
+		return "drop and create"
+	case report.Drop:
+		return "drop and insert"
+	case report.Create:
+		return "create"
+	case report.Exists:
+		return "insert into existing"
+	default:
+		return "insert"
+	}
+}
+
+// DryRun reads and validates every file that a restore would use without
+// writing anything to the server, then prints a report of what would be
+// created, dropped and inserted for each namespace. It returns an error
+// if any problems were found.
+func (restore *MongoRestore) DryRun() error {
+	log.Log(log.Always, "dry run: validating dump without writing to the server")
+	reports := []*NamespaceReport{}
+	for intent := restore.manager.Pop(); intent != nil; intent = restore.manager.Pop() {
+		reports = append(reports, restore.DryRunIntent(intent))
+		restore.manager.Finish(intent)
+	}
+
+	if restore.ShouldRestoreUsersAndRoles() {
+		for _, intent := range []*intents.Intent{restore.manager.Users(), restore.manager.Roles()} {
+			if intent != nil {
+				reports = append(reports, restore.dryRunAuthIntent(intent))
+			}
+		}
+	}
+
+	if restore.InputOptions.OplogReplay && restore.manager.Oplog() != nil {
+		reports = append(reports, restore.dryRunOplog(restore.manager.Oplog()))
+	}
+
+	WriteNamespaceReports(os.Stdout, reports)
+
+	problemCount := 0
+	for _, report := range reports {
+		if report.ProblemCount() > 0 {
+			problemCount++
+		}
+	}
+	if problemCount > 0 {
+		return fmt.Errorf("dry run found problems with %v namespaces", problemCount)
+	}
+	log.Log(log.Always, "dry run found no problems; no changes were made")
+	return nil
+}
+
+// DryRunIntent validates everything that RestoreIntent would
+// read for the given intent and reports what it would do.
+func (restore *MongoRestore) DryRunIntent(intent *intents.Intent) *NamespaceReport {
+	report := &NamespaceReport{Namespace: intent.Key()}
+
+	if err := util.ValidateFullNamespace(intent.Key()); err != nil {
+		report.addProblem("%v", err)
+	}
+
+	exists, err := restore.CollectionExists(intent)
+	if err != nil {
+		report.addProblem("error reading database: %v", err)
+	}
+	report.Exists = exists
+	if restore.OutputOptions.Drop && exists && !strings.HasPrefix(intent.C, "system.") {
+		report.Drop = true
+		exists = false
+	}
+
+	options, indexes, err := restore.ReadIntentMetadata(intent)
+	if err != nil {
+		report.addProblem("%v", err)
+	}
+	if intent.MetadataPath != "" && !restore.OutputOptions.NoOptionsRestore &&
+		options != nil && !exists {
+		report.Create = true
+	}
+	if _, err := restore.ReadIntentSharding(intent); err != nil {
+		report.addProblem("%v", err)
+	}
+	if !restore.OutputOptions.NoIndexRestore {
+		for _, index := range indexes {
+			if err := ValidateIndex(intent, index); err != nil {
+				report.addProblem("%v", err)
+				continue
+			}
+			report.Indexes = append(report.Indexes, index.Options["name"].(string))
+		}
+	}
+
+	if intent.BSONPath != "" {
+		var rawSource db.RawDocSource
+		if restore.useStdin {
+			rawSource = db.NewBSONSource(os.Stdin)
+		} else {
+			rawSource, err = restore.OpenDataFile(intent.BSONPath)
+			if err != nil {
+				report.addProblem("error reading file %v: %v", intent.BSONPath, err)
+				return report
+			}
+		}
+		restore.dryRunBSON(report, rawSource)
+	}
+	return report
+}
+
+// dryRunBSON reads every document in the source, counting them
+// and, if --objcheck is enabled, validating them. Any transforms
+// for the namespace are applied to make sure they succeed.
+func (restore *MongoRestore) dryRunBSON(report *NamespaceReport, rawSource db.RawDocSource) {
+	bsonSource := db.NewDecodedBSONSource(rawSource)
+	defer bsonSource.Close()
+
+	transforms, err := restore.TransformsForNamespace(report.Namespace)
+	if err != nil {
+		report.addProblem("%v", err)
+	}
+
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		report.Documents++
+		report.Bytes += int64(len(doc.Data))
+		if restore.objCheck {
+			if err := bsonutil.ValidateBSON(doc.Data, bsonutil.DefaultValidationOptions); err != nil {
+				report.addProblem("invalid object at document %v: %v", report.Documents, err)
+			}
+		}
+		if len(transforms) > 0 {
+			if _, err := TransformDocument(transforms, doc); err != nil {
+				report.addProblem("document %v: %v", report.Documents, err)
+			}
+		}
+	}
+	if err := bsonSource.Err(); err != nil {
+		report.addProblem("error reading BSON after document %v: %v", report.Documents, err)
+	}
+}
+
+// dryRunAuthIntent reads the users or roles file that would be merged into the server
+func (restore *MongoRestore) dryRunAuthIntent(intent *intents.Intent) *NamespaceReport {
+	report := &NamespaceReport{Namespace: intent.Key()}
+	rawSource, err := restore.OpenDataFile(intent.BSONPath)
+	if err != nil {
+		report.addProblem("error reading file %v: %v", intent.BSONPath, err)
+		return report
+	}
+	restore.dryRunBSON(report, rawSource)
+	return report
+}
+
+// dryRunOplog counts the oplog entries that would be replayed
+func (restore *MongoRestore) dryRunOplog(intent *intents.Intent) *NamespaceReport {
+	report := &NamespaceReport{Namespace: "oplog", Replay: true}
+	if err := restore.ResolveOplogLimit(intent.BSONPath); err != nil {
+		report.addProblem("%v", err)
+		return report
+	}
+
+	oplogFile, err := os.Open(intent.BSONPath)
+	if err != nil {
+		report.addProblem("error reading oplog file: %v", err)
+		return report
+	}
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(oplogFile))
+	defer bsonSource.Close()
+
+	rawOplogEntry := &bson.Raw{}
+	for bsonSource.Next(rawOplogEntry) {
+		entry := Oplog{}
+		if err = bson.Unmarshal(rawOplogEntry.Data, &entry); err != nil {
+			report.addProblem("error reading oplog: %v", err)
+			return report
+		}
+		if entry.Operation == "n" {
+			continue
+		}
+		if !restore.TimestampBeforeLimit(entry.Timestamp) {
+			break
+		}
+		if restore.TimestampAfterStart(entry.Timestamp) && restore.OplogNamespaceIncluded(entry) {
+			report.Documents++
+			report.Bytes += int64(len(rawOplogEntry.Data))
+		}
+	}
+	if err = bsonSource.Err(); err != nil {
+		report.addProblem("error reading oplog bson input: %v", err)
+	}
+	return report
+}
+
+// WriteNamespaceReports writes a table of the reports, followed by any problems
+func WriteNamespaceReports(w io.Writer, reports []*NamespaceReport) {
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("namespace", "action", "documents", "bytes", "indexes", "status")
+	out.EndRow()
+	for _, report := range reports {
+		status := "ok"
+		if report.ProblemCount() > 0 {
+			status = fmt.Sprintf("%v problem(s)", report.ProblemCount())
+		}
+		out.WriteCells(report.Namespace, report.Action(),
+			fmt.Sprintf("%v", report.Documents),
+			fmt.Sprintf("%v", report.Bytes),
+			fmt.Sprintf("%v", len(report.Indexes)),
+			status)
+		out.EndRow()
+	}
+	buf := &bytes.Buffer{}
+	out.Flush(buf)
+	for _, report := range reports {
+		for _, problem := range report.Problems {
+			fmt.Fprintf(buf, "%v: %v\n", report.Namespace, problem)
+		}
+		if report.OmittedProblems > 0 {
+			fmt.Fprintf(buf, "%v: ...and %v more problem(s)\n", report.Namespace, report.OmittedProblems)
+		}
+	}
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidateIndex(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With an intent for a short namespace", t, func() {
+		intent := &intents.Intent{DB: "test", C: "orders"}
+
+		Convey("a normal index should be valid", func() {
+			index := IndexDocument{
+				Key:     bson.D{{"customer", 1}, {"loc", "2dsphere"}},
+				Options: bson.M{"name": "customer_1_loc_2dsphere"},
+			}
+			So(ValidateIndex(intent, index), ShouldBeNil)
+		})
+
+		Convey("an index without a name should be invalid", func() {
+			index := IndexDocument{Key: bson.D{{"customer", 1}}, Options: bson.M{}}
+			So(ValidateIndex(intent, index), ShouldNotBeNil)
+		})
+
+		Convey("an index with an empty key should be invalid", func() {
+			index := IndexDocument{Key: bson.D{}, Options: bson.M{"name": "empty"}}
+			So(ValidateIndex(intent, index), ShouldNotBeNil)
+		})
+
+		Convey("an index with a boolean key value should be invalid", func() {
+			index := IndexDocument{Key: bson.D{{"customer", true}}, Options: bson.M{"name": "bad"}}
+			So(ValidateIndex(intent, index), ShouldNotBeNil)
+		})
+
+		Convey("an index with a name too long for the namespace should be invalid", func() {
+			index := IndexDocument{
+				Key:     bson.D{{"customer", 1}},
+				Options: bson.M{"name": strings.Repeat("x", 120)},
+			}
+			So(ValidateIndex(intent, index), ShouldNotBeNil)
+			_, err := (&MongoRestore{OutputOptions: &OutputOptions{}}).sanitizeIndexes(intent, []IndexDocument{index})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a restore should leave legacy key values to the server", func() {
+			index := IndexDocument{Key: bson.D{{"customer", true}}, Options: bson.M{"name": "legacy"}}
+			sanitized, err := (&MongoRestore{OutputOptions: &OutputOptions{}}).sanitizeIndexes(intent, []IndexDocument{index})
+			So(err, ShouldBeNil)
+			So(sanitized[0].Options["ns"], ShouldEqual, "test.orders")
+		})
+	})
+}
+
+func TestDryRunReports(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("When reading BSON in a dry run", t, func() {
+		restore := &MongoRestore{objCheck: true}
+		report := &NamespaceReport{Namespace: "test.orders"}
+
+		Convey("documents and bytes should be counted", func() {
+			var data []byte
+			for i := 0; i < 3; i++ {
+				doc, err := bson.Marshal(bson.M{"_id": i})
+				So(err, ShouldBeNil)
+				data = append(data, doc...)
+			}
+			restore.dryRunBSON(report, db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(data))))
+			So(report.Documents, ShouldEqual, 3)
+			So(report.Bytes, ShouldEqual, len(data))
+			So(report.Problems, ShouldBeEmpty)
+		})
+
+		Convey("a truncated file should be reported as a problem", func() {
+			doc, err := bson.Marshal(bson.M{"_id": 1})
+			So(err, ShouldBeNil)
+			data := append(doc, doc[:len(doc)-2]...)
+			restore.dryRunBSON(report, db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(data))))
+			So(report.Documents, ShouldEqual, 1)
+			So(len(report.Problems), ShouldEqual, 1)
+		})
+	})
+
+	Convey("When describing reports", t, func() {
+		Convey("actions should reflect drops and creates", func() {
+			So((&NamespaceReport{}).Action(), ShouldEqual, "insert")
+			So((&NamespaceReport{Exists: true}).Action(), ShouldEqual, "insert into existing")
+			So((&NamespaceReport{Exists: true, Drop: true}).Action(), ShouldEqual, "drop and insert")
+			So((&NamespaceReport{Drop: true, Create: true}).Action(), ShouldEqual, "drop and create")
+			So((&NamespaceReport{Create: true}).Action(), ShouldEqual, "create")
+			So((&NamespaceReport{Replay: true}).Action(), ShouldEqual, "replay")
+		})
+
+		Convey("the written report should list every namespace and problem", func() {
+			reports := []*NamespaceReport{
+				{Namespace: "test.orders", Documents: 10, Indexes: []string{"_id_"}},
+				{Namespace: "test.carts", Problems: []string{"bad index"}},
+			}
+			out := &bytes.Buffer{}
+			WriteNamespaceReports(out, reports)
+			So(out.String(), ShouldContainSubstring, "test.orders")
+			So(out.String(), ShouldContainSubstring, "1 problem(s)")
+			So(out.String(), ShouldContainSubstring, "test.carts: bad index")
+		})
+
+		Convey("only the first problems of a namespace should be listed", func() {
+			report := &NamespaceReport{Namespace: "test.orders"}
+			for i := 0; i < maxReportedProblems+5; i++ {
+				report.addProblem("bad document %v", i+1)
+			}
+			So(len(report.Problems), ShouldEqual, maxReportedProblems)
+			So(report.ProblemCount(), ShouldEqual, maxReportedProblems+5)
+			out := &bytes.Buffer{}
+			WriteNamespaceReports(out, []*NamespaceReport{report})
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("%v problem(s)", maxReportedProblems+5))
+			So(out.String(), ShouldContainSubstring, "test.orders: ...and 5 more problem(s)")
+			So(out.String(), ShouldNotContainSubstring, fmt.Sprintf("bad document %v\n", maxReportedProblems+1))
+		})
+	})
+}
@@ -19,10 +19,11 @@ const (
 	UnknownFileType FileType = iota
 	BSONFileType
 	MetadataFileType
+	JSONFileType
 )
 
-// GetInfoFromFilename pulls the base collection name and
-// type of file from a .bson/.metadata.json file
+// GetInfoFromFilename pulls the base collection name and type
+// of file from a .bson/.metadata.json/.json/.json.gz file
 func GetInfoFromFilename(filename string) (string, FileType) {
 	baseFileName := filepath.Base(filename)
 	switch {
@@ -39,11 +40,26 @@ func GetInfoFromFilename(filename string) (string, FileType) {
 	case strings.HasSuffix(baseFileName, ".bson"):
 		baseName := strings.TrimSuffix(baseFileName, ".bson")
 		return baseName, BSONFileType
+	case strings.HasSuffix(baseFileName, ".json"):
+		baseName := strings.TrimSuffix(baseFileName, ".json")
+		return baseName, JSONFileType
+	case strings.HasSuffix(baseFileName, ".json.gz"):
+		baseName := strings.TrimSuffix(baseFileName, ".json.gz")
+		return baseName, JSONFileType
 	default:
 		return "", UnknownFileType
 	}
 }
 
+// dataFileType returns the type of the files holding collection data:
+// BSON files, or JSON files with --inputFormat=json
+func (restore *MongoRestore) dataFileType() FileType {
+	if restore.useJSONInput {
+		return JSONFileType
+	}
+	return BSONFileType
+}
+
 func (restore *MongoRestore) CreateAllIntents(fullpath string) error {
 	log.Logf(log.DebugHigh, "using %v as dump root directory", fullpath)
 	foundOplog := false
@@ -56,6 +72,10 @@ func (restore *MongoRestore) CreateAllIntents(fullpath string) error {
 			if err = util.ValidateDBName(entry.Name()); err != nil {
 				return fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
 			}
+			if entry.Name() == "config" && restore.isMongos {
+				log.Logf(log.Always, "not restoring the config database through mongos")
+				continue
+			}
 			err = restore.CreateIntentsForDB(entry.Name(), filepath.Join(fullpath, entry.Name()))
 			if err != nil {
 				return err
@@ -77,7 +97,7 @@ func (restore *MongoRestore) CreateAllIntents(fullpath string) error {
 			}
 		}
 	}
-	if restore.InputOptions.OplogReplay && !foundOplog {
+	if restore.InputOptions.OplogReplay && !foundOplog && restore.InputOptions.OplogFile == "" {
 		return fmt.Errorf(
 			"no %v/oplog.bson file to replay; make sure you run mongodump with --oplog.",
 			fullpath)
@@ -103,8 +123,8 @@ func (restore *MongoRestore) CreateIntentsForDB(db, fullpath string) error {
 		} else {
 			//TODO handle user/roles?
 			collection, fileType := GetInfoFromFilename(entry.Name())
-			switch fileType {
-			case BSONFileType:
+			switch {
+			case fileType == restore.dataFileType():
 				// skip restoring the indexes collection if we are using metadata
 				// files to store index information, to eliminate redundancy
 				if collection == "system.indexes" && usesMetadataFiles {
@@ -119,9 +139,9 @@ func (restore *MongoRestore) CreateIntentsForDB(db, fullpath string) error {
 					Size:     entry.Size(),
 					BSONPath: filepath.Join(fullpath, entry.Name()),
 				}
-				log.Logf(log.Info, "found collection %v bson to restore", intent.Key())
+				log.Logf(log.Info, "found collection %v data to restore", intent.Key())
 				restore.manager.Put(intent)
-			case MetadataFileType:
+			case fileType == MetadataFileType:
 				usesMetadataFiles = true
 				intent := &intents.Intent{
 					DB:           db,
@@ -181,7 +201,15 @@ func (restore *MongoRestore) CreateIntentForCollection(
 	}
 
 	baseName, fileType := GetInfoFromFilename(file.Name())
-	if fileType != BSONFileType {
+	if fileType == MetadataFileType && restore.useJSONInput {
+		// a collection named like x.metadata is exported to x.metadata.json,
+		// and since the file was named explicitly it must be the data file
+		baseName, fileType = strings.TrimSuffix(file.Name(), ".json"), JSONFileType
+	}
+	if fileType != restore.dataFileType() {
+		if restore.dataFileType() == JSONFileType {
+			return fmt.Errorf("file %v does not have .json or .json.gz extension", fullpath)
+		}
 		return fmt.Errorf("file %v does not have .bson extension", fullpath)
 	}
 
@@ -222,6 +250,29 @@ func (restore *MongoRestore) CreateIntentForCollection(
 	return nil
 }
 
+// CreateIntentForOplogFile builds the oplog intent from a user-supplied
+// --oplogFile, replacing any oplog.bson found in the dump directory.
+func (restore *MongoRestore) CreateIntentForOplogFile(fullpath string) error {
+	file, err := os.Stat(fullpath)
+	if err != nil {
+		return err
+	}
+	if file.IsDir() {
+		return fmt.Errorf("file %v is a directory, not a bson file", fullpath)
+	}
+	if restore.manager.Oplog() != nil {
+		log.Logf(log.Info, "using oplog file %v instead of %v",
+			fullpath, restore.manager.Oplog().BSONPath)
+	}
+	log.Logf(log.DebugLow, "found oplog file %v to replay", fullpath)
+	restore.manager.Put(&intents.Intent{
+		C:        "oplog",
+		BSONPath: fullpath,
+		Size:     file.Size(),
+	})
+	return nil
+}
+
 // readDirWithSymlinks acts like ioutil.ReadDir, except symlinks are treated
 // as directories instead of regular files
 func readDirWithSymlinks(fullpath string) ([]os.FileInfo, error) {
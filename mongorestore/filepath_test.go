@@ -90,6 +90,59 @@ func TestCreateAllIntents(t *testing.T) {
 	})
 }
 
+func TestCreateAllIntentsFromJSON(t *testing.T) {
+	// This tests creates intents based on the test file tree:
+	//   jsondirs/db1
+	//   jsondirs/db1/c1.json
+	//   jsondirs/db1/c1.metadata.json
+	//   jsondirs/db2
+	//   jsondirs/db2/c2.json.gz
+	//   jsondirs/db2/c3.bson
+
+	var mr *MongoRestore
+	var buff bytes.Buffer
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a test MongoRestore reading JSON files", t, func() {
+		mr = &MongoRestore{
+			manager:      intents.NewCategorizingIntentManager(),
+			InputOptions: &InputOptions{},
+			useJSONInput: true,
+		}
+		log.SetWriter(&buff)
+
+		Convey("running CreateAllIntents should succeed", func() {
+			So(mr.CreateAllIntents("testdata/jsondirs/"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			Convey("and intents should be created for the JSON files", func() {
+				i0 := mr.manager.Pop()
+				So(i0.Key(), ShouldEqual, "db1.c1")
+				So(i0.BSONPath, ShouldEqual, "testdata/jsondirs/db1/c1.json")
+				So(i0.MetadataPath, ShouldEqual, "testdata/jsondirs/db1/c1.metadata.json")
+				i1 := mr.manager.Pop()
+				So(i1.Key(), ShouldEqual, "db2.c2")
+				So(i1.BSONPath, ShouldEqual, "testdata/jsondirs/db2/c2.json.gz")
+				So(mr.manager.Pop(), ShouldBeNil)
+
+				Convey("and BSON files should be skipped", func() {
+					So(buff.String(), ShouldContainSubstring, "c3.bson")
+				})
+			})
+		})
+
+		Convey("a collection named like a metadata file should be restored from its JSON file", func() {
+			So(mr.CreateIntentForCollection("db1", "c1.metadata", "testdata/jsondirs/db1/c1.metadata.json"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+			intent := mr.manager.Pop()
+			So(intent.Key(), ShouldEqual, "db1.c1.metadata")
+			So(intent.BSONPath, ShouldEqual, "testdata/jsondirs/db1/c1.metadata.json")
+			So(intent.MetadataPath, ShouldEqual, "")
+		})
+	})
+}
+
 func TestCreateIntentsForDB(t *testing.T) {
 	// This tests creates intents based on the test file tree:
 	//   db1
@@ -0,0 +1,168 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexBuildProgressInterval is how often the progress of
+// deferred index builds is read from currentOp and logged
+const IndexBuildProgressInterval = time.Second * 10
+
+// deferredIndexes are the indexes of a collection whose
+// builds were put off until all data had been restored
+type deferredIndexes struct {
+	intent  *intents.Intent
+	indexes []IndexDocument
+}
+
+// indexBuild is a single deferred index to build
+type indexBuild struct {
+	intent *intents.Intent
+	index  IndexDocument
+}
+
+// DeferIndexes saves a collection's indexes to be built by BuildDeferredIndexes
+func (restore *MongoRestore) DeferIndexes(intent *intents.Intent, indexes []IndexDocument) {
+	log.Logf(log.Always, "deferring %v index builds for collection %v", len(indexes), intent.Key())
+	restore.deferredIndexesMutex.Lock()
+	defer restore.deferredIndexesMutex.Unlock()
+	restore.deferredIndexes = append(restore.deferredIndexes, deferredIndexes{intent, indexes})
+}
+
+// BuildDeferredIndexes builds every deferred index, running up to
+// --numParallelIndexBuilds builds at a time. A failed build does not stop the
+// others; all failures are logged and returned together at the end.
+func (restore *MongoRestore) BuildDeferredIndexes() error {
+	builds := []indexBuild{}
+	for _, deferred := range restore.deferredIndexes {
+		for _, index := range deferred.indexes {
+			builds = append(builds, indexBuild{deferred.intent, index})
+		}
+	}
+	if len(builds) == 0 {
+		return nil
+	}
+	log.Logf(log.Always, "building %v deferred indexes, %v at a time",
+		len(builds), restore.OutputOptions.NumParallelIndexBuilds)
+
+	stopProgress := make(chan struct{})
+	defer close(stopProgress)
+	go restore.logIndexBuildProgress(IndexBuildProgressInterval, stopProgress)
+
+	buildChan := make(chan indexBuild)
+	go func() {
+		for _, build := range builds {
+			buildChan <- build
+		}
+		close(buildChan)
+	}()
+
+	// the namespaces with failed builds, and the failures
+	failed := map[string]bool{}
+	failures := []string{}
+	failuresMutex := sync.Mutex{}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < restore.OutputOptions.NumParallelIndexBuilds; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for build := range buildChan {
+				name := build.index.Options["name"]
+				log.Logf(log.Info, "building index %v on %v", name, build.intent.Key())
+				start := time.Now()
+				err := restore.CreateIndexes(build.intent, []IndexDocument{build.index})
+				if err != nil {
+					log.Logf(log.Always, "error building index %v on %v: %v", name, build.intent.Key(), err)
+					failuresMutex.Lock()
+					failed[build.intent.Key()] = true
+					failures = append(failures, fmt.Sprintf("%v on %v: %v", name, build.intent.Key(), err))
+					failuresMutex.Unlock()
+					continue
+				}
+				log.Logf(log.Always, "built index %v on %v in %v",
+					name, build.intent.Key(), roundToMillisecond(time.Since(start)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if restore.OutputOptions.Verify {
+		for _, deferred := range restore.deferredIndexes {
+			restore.addVerifyReport(restore.VerifyIntent(deferred.intent, deferred.indexes))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%v of %v index builds failed on %v collections: %v",
+			len(failures), len(builds), len(failed), strings.Join(failures, "; "))
+	}
+	log.Logf(log.Always, "finished building %v deferred indexes", len(builds))
+	return nil
+}
+
+// currentOpEntry is the part of a currentOp entry used to report index build progress
+type currentOpEntry struct {
+	Namespace string `bson:"ns"`
+	Message   string `bson:"msg"`
+}
+
+// IndexBuildProgress returns a description of each index build among the
+// operations reported by currentOp, whose messages look like
+// "Index Build (background): 1200/10000 12%"
+func IndexBuildProgress(ops []currentOpEntry) []string {
+	progress := []string{}
+	for _, op := range ops {
+		if strings.HasPrefix(op.Message, "Index Build") {
+			progress = append(progress, fmt.Sprintf("%v: %v", op.Namespace, op.Message))
+		}
+	}
+	return progress
+}
+
+// logIndexBuildProgress logs the progress of running index builds
+// at every interval until done is closed
+func (restore *MongoRestore) logIndexBuildProgress(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ops, err := restore.currentOp()
+		if err != nil {
+			log.Logf(log.DebugLow, "error reading index build progress: %v", err)
+			continue
+		}
+		for _, progress := range IndexBuildProgress(ops) {
+			log.Logf(log.Always, "index build progress for %v", progress)
+		}
+	}
+}
+
+// currentOp returns the operations running on the server, using the currentOp
+// command if available or by falling back to querying $cmd.sys.inprog
+func (restore *MongoRestore) currentOp() ([]currentOpEntry, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	result := struct {
+		InProg []currentOpEntry `bson:"inprog"`
+	}{}
+	err = session.DB("admin").Run(bson.D{{"currentOp", 1}}, &result)
+	if err != nil {
+		err = session.DB("admin").C("$cmd.sys.inprog").Find(nil).One(&result)
+	}
+	return result.InProg, err
+}
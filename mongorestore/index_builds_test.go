@@ -0,0 +1,68 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDeferIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a mongorestore deferring index builds", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{DeferIndexBuilds: true, NumParallelIndexBuilds: 2},
+		}
+
+		Convey("there should be nothing to build before any indexes are deferred", func() {
+			So(restore.BuildDeferredIndexes(), ShouldBeNil)
+		})
+
+		Convey("deferred indexes should be saved for each collection", func() {
+			_, indexes, err := restore.MetadataFromJSON([]byte(testMetadata))
+			So(err, ShouldBeNil)
+			restore.DeferIndexes(&intents.Intent{DB: "test", C: "events"}, indexes)
+			restore.DeferIndexes(&intents.Intent{DB: "test", C: "other"}, indexes[:1])
+			So(len(restore.deferredIndexes), ShouldEqual, 2)
+			So(len(restore.deferredIndexes[0].indexes), ShouldEqual, 4)
+			So(restore.deferredIndexes[1].intent.Key(), ShouldEqual, "test.other")
+		})
+
+		Convey("building indexes should leave the options of the deferred indexes as they are", func() {
+			restore.OutputOptions.ForceBackgroundIndexBuilds = true
+			_, indexes, err := restore.MetadataFromJSON([]byte(testMetadata))
+			So(err, ShouldBeNil)
+			sanitized, err := restore.sanitizeIndexes(&intents.Intent{DB: "restored", C: "events"}, indexes)
+			So(err, ShouldBeNil)
+			So(sanitized[1].Options["ns"], ShouldEqual, "restored.events")
+			So(sanitized[1].Options["background"], ShouldEqual, true)
+			So(sanitized[1].Options["v"], ShouldBeNil)
+			So(indexes[1].Options["ns"], ShouldEqual, "test.events")
+			So(indexes[1].Options["background"], ShouldBeNil)
+			So(indexes[1].Options["v"], ShouldNotBeNil)
+		})
+	})
+}
+
+func TestIndexBuildProgress(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With operations from currentOp", t, func() {
+		ops := []currentOpEntry{
+			{Namespace: "test.events", Message: "Index Build (background): 1200/10000 12%"},
+			{Namespace: "test.events", Message: ""},
+			{Namespace: "test.users", Message: "Index Build: 5/10 50%"},
+			{Namespace: "test.other", Message: "m/r: (1/3) emit phase"},
+		}
+
+		Convey("only index builds should be reported", func() {
+			So(IndexBuildProgress(ops), ShouldResemble, []string{
+				"test.events: Index Build (background): 1200/10000 12%",
+				"test.users: Index Build: 5/10 50%",
+			})
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package mongorestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// JSONSource is a db.RawDocSource that reads extended JSON documents, as
+// written by mongoexport with one document per line, and converts them to BSON
+type JSONSource struct {
+	decoder *json.Decoder
+	closers []io.Closer
+	numRead int64
+	err     error
+
+	// bytesRead counts the bytes read from the data file, before they are
+	// decompressed, so that progress is measured against the size of the file
+	bytesRead int64
+}
+
+// NewJSONSource returns a JSONSource reading from the given stream.
+// Closing the source closes the given closers, in order.
+func NewJSONSource(in io.Reader, closers ...io.Closer) *JSONSource {
+	return &JSONSource{
+		decoder: json.NewDecoder(in),
+		closers: closers,
+	}
+}
+
+// LoadNextInto reads the next JSON document into the buffer as BSON,
+// returning false at the end of the stream or on an error
+func (jsonSource *JSONSource) LoadNextInto(into []byte) (bool, int32) {
+	rawJSON, err := jsonSource.decoder.ScanObject()
+	if err != nil {
+		if err == io.EOF {
+			jsonSource.err = nil
+		} else {
+			jsonSource.err = fmt.Errorf("error reading JSON document #%v: %v", jsonSource.numRead+1, err)
+		}
+		return false, 0
+	}
+	jsonSource.numRead++
+
+	if bytes.HasPrefix(bytes.TrimSpace(rawJSON), []byte("[")) {
+		jsonSource.err = fmt.Errorf("JSON arrays are not supported; export collections with one document per line")
+		return false, 0
+	}
+	doc, err := json.UnmarshalBsonD(rawJSON)
+	if err != nil {
+		jsonSource.err = fmt.Errorf("error parsing JSON document #%v: %v", jsonSource.numRead, err)
+		return false, 0
+	}
+	extendedDoc, err := bsonutil.GetExtendedBsonD(doc)
+	if err != nil {
+		jsonSource.err = fmt.Errorf("error converting JSON document #%v: %v", jsonSource.numRead, err)
+		return false, 0
+	}
+	data, err := bson.Marshal(extendedDoc)
+	if err != nil {
+		jsonSource.err = fmt.Errorf("error converting JSON document #%v to BSON: %v", jsonSource.numRead, err)
+		return false, 0
+	}
+	if len(data) > len(into) {
+		jsonSource.err = fmt.Errorf("JSON document #%v is %v bytes as BSON, larger than the maximum of %v bytes",
+			jsonSource.numRead, len(data), len(into))
+		return false, 0
+	}
+	copy(into, data)
+	return true, int32(len(data))
+}
+
+func (jsonSource *JSONSource) Close() error {
+	var firstErr error
+	for _, closer := range jsonSource.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (jsonSource *JSONSource) Err() error {
+	return jsonSource.err
+}
+
+// BytesRead returns a pointer to the count of bytes read from the data file,
+// for progress bars; it must be read with atomic.LoadInt64
+func (jsonSource *JSONSource) BytesRead() *int64 {
+	return &jsonSource.bytesRead
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	count *int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	atomic.AddInt64(reader.count, int64(n))
+	return n, err
+}
+
+// OpenDataFile opens a collection's data file, returning a source of raw
+// BSON documents. With --inputFormat=json the file is read as, possibly
+// gzipped, extended JSON whatever its name, since collection names can
+// themselves end in something like .json or .metadata.
+func (restore *MongoRestore) OpenDataFile(path string) (db.RawDocSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !restore.useJSONInput {
+		return db.NewBSONSource(file), nil
+	}
+	source := &JSONSource{}
+	in := io.Reader(&countingReader{Reader: file, count: &source.bytesRead})
+	source.closers = []io.Closer{file}
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(in)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error decompressing %v: %v", path, err)
+		}
+		in = gzipReader
+		source.closers = []io.Closer{gzipReader, file}
+	}
+	source.decoder = json.NewDecoder(in)
+	return source, nil
+}
@@ -0,0 +1,96 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONSource(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	readAll := func(source db.RawDocSource) ([]bson.D, error) {
+		bsonSource := db.NewDecodedBSONSource(source)
+		defer bsonSource.Close()
+		docs := []bson.D{}
+		doc := bson.D{}
+		for bsonSource.Next(&doc) {
+			docs = append(docs, doc)
+			doc = bson.D{}
+		}
+		return docs, bsonSource.Err()
+	}
+
+	Convey("With JSON data files", t, func() {
+		restore := &MongoRestore{useJSONInput: true}
+
+		Convey("extended JSON documents should be converted to BSON", func() {
+			source, err := restore.OpenDataFile("testdata/jsondirs/db1/c1.json")
+			So(err, ShouldBeNil)
+			docs, err := readAll(source)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 2)
+			So(docs[0], ShouldResemble, bson.D{
+				{"_id", bson.ObjectIdHex("5519c5a2b9ab6d8e0c7c4d11")},
+				{"name", "first"},
+				{"count", int64(12)},
+			})
+			when, ok := docs[1][2].Value.(time.Time)
+			So(ok, ShouldBeTrue)
+			So(when.Unix(), ShouldEqual, 1427752322)
+		})
+
+		Convey("gzipped JSON files should be decompressed", func() {
+			source, err := restore.OpenDataFile("testdata/jsondirs/db2/c2.json.gz")
+			So(err, ShouldBeNil)
+			docs, err := readAll(source)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 3)
+			So(docs[0][1].Value, ShouldResemble, []interface{}{"a", "b"})
+		})
+
+		Convey("invalid JSON should be an error with the document number", func() {
+			source := NewJSONSource(strings.NewReader("{\"a\": 1}\n{\"b\": }\n"))
+			docs, err := readAll(source)
+			So(len(docs), ShouldEqual, 1)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "#2")
+		})
+
+		Convey("JSON arrays should be an error", func() {
+			source := NewJSONSource(strings.NewReader("[{\"a\": 1}]"))
+			_, err := readAll(source)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Data files should be read in the --inputFormat whatever their name", t, func() {
+		tempDir, err := ioutil.TempDir("", "json-source")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tempDir)
+		path := filepath.Join(tempDir, "x.metadata.json")
+		contents := "{\"a\": 1}\n{\"a\": 2}\n"
+		So(ioutil.WriteFile(path, []byte(contents), 0644), ShouldBeNil)
+
+		source, err := (&MongoRestore{useJSONInput: true}).OpenDataFile(path)
+		So(err, ShouldBeNil)
+		docs, err := readAll(source)
+		So(err, ShouldBeNil)
+		So(len(docs), ShouldEqual, 2)
+		So(*source.(*JSONSource).BytesRead(), ShouldEqual, len(contents))
+
+		source, err = (&MongoRestore{}).OpenDataFile(path)
+		So(err, ShouldBeNil)
+		_, ok := source.(*db.BSONSource)
+		So(ok, ShouldBeTrue)
+		source.Close()
+	})
+}
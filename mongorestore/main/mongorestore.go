@@ -35,7 +35,7 @@ func main() {
 
 	log.SetVerbosity(opts.Verbosity)
 
-	targetDir, err := getTargetDirFromArgs(extraArgs, inputOpts.Directory)
+	targetDir, err := getTargetDirFromArgs(extraArgs, inputOpts.Directory, inputOpts.OplogFile != "")
 	if err != nil {
 		fmt.Printf("error parsing command line options: %v\n", err)
 		os.Exit(util.ExitBadOptions)
@@ -67,8 +67,9 @@ func main() {
 }
 
 // getTargetDirFromArgs handles the logic and error cases of figuring out
-// the target restore directory.
-func getTargetDirFromArgs(extraArgs []string, dirFlag string) (string, error) {
+// the target restore directory. With an --oplogFile and no directory given,
+// there is no dump directory and only the oplog file is replayed.
+func getTargetDirFromArgs(extraArgs []string, dirFlag string, hasOplogFile bool) (string, error) {
 	// This logic is in a switch statement so that the rules are understandable.
 	// We start by handling error cases, and then handle the different ways the target
 	// directory can be legally set.
@@ -91,6 +92,10 @@ func getTargetDirFromArgs(extraArgs []string, dirFlag string) (string, error) {
 		log.Log(log.Info, "using --dir flag instead of arguments")
 		return dirFlag, nil
 
+	case hasOplogFile:
+		log.Log(log.Info, "no dump directory given; only replaying the --oplogFile")
+		return "", nil
+
 	default:
 		log.Log(log.Info, "using default 'dump' directory")
 		return "dump", nil
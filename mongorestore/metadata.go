@@ -10,13 +10,23 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"os"
+	"io/ioutil"
 	"strings"
 )
 
 const Users = "users"
 const Roles = "roles"
 
+// modes for restoring users and roles, set by --usersAndRolesMode
+const (
+	// keep users and roles already on the server, adding any that are missing
+	UsersAndRolesMerge = "merge"
+	// drop users and roles already on the server before restoring
+	UsersAndRolesReplace = "replace"
+	// don't restore users and roles
+	UsersAndRolesSkip = "skip"
+)
+
 // struct for working with auth versions
 type authVersionPair struct {
 	// Dump is the auth version of the users/roles collection files in the target dump directory
@@ -65,16 +75,97 @@ func (restore *MongoRestore) MetadataFromJSON(jsonBytes []byte) (bson.D, []Index
 	return meta.Options, meta.Indexes, nil
 }
 
+// ReadIntentMetadata returns the collection options and indexes to restore for
+// the given intent. They are read from the intent's .metadata.json file or,
+// for older dumps without metadata files, from the database's system.indexes dump,
+// and then edited by any matching --metadataOverrides.
+func (restore *MongoRestore) ReadIntentMetadata(intent *intents.Intent) (bson.D, []IndexDocument, error) {
+	var options bson.D
+	var indexes []IndexDocument
+	var err error
+
+	// get indexes from system.indexes dump if we have it but don't have metadata files
+	if intent.MetadataPath == "" && restore.manager.SystemIndexes(intent.DB) != nil {
+		systemIndexesFile := restore.manager.SystemIndexes(intent.DB).BSONPath
+		log.Logf(log.Always, "no metadata file; reading indexes from %v", systemIndexesFile)
+		indexes, err = restore.IndexesFromBSON(intent, systemIndexesFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading indexes from %v: %v", systemIndexesFile, err)
+		}
+	}
+
+	if intent.MetadataPath != "" {
+		log.Logf(log.Always, "reading metadata file from %v", intent.MetadataPath)
+		jsonBytes, err := ioutil.ReadFile(intent.MetadataPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
+		}
+		options, indexes, err = restore.MetadataFromJSON(jsonBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+		}
+	}
+	return restore.ApplyMetadataOverrides(intent, options, indexes)
+}
+
+// validateIndexNamespace checks that the namespace of the index, once it is
+// restored to the intent's namespace, is within the server's length limit
+func validateIndexNamespace(intent *intents.Intent, index IndexDocument) error {
+	fullIndexName := fmt.Sprintf("%v.$%v", intent.Key(), index.Options["name"])
+	if len(fullIndexName) > 127 {
+		return fmt.Errorf(
+			"cannot restore index with namespace '%v': "+
+				"namespace is too long (max size is 127 bytes)", fullIndexName)
+	}
+	return nil
+}
+
+// ValidateIndex checks an index spec for problems that would keep
+// the server from building it once it is restored to the intent's namespace.
+// It is stricter than a restore, which leaves legacy key values and
+// unnamed indexes to the server, so it is only used to report problems
+// in a dry run.
+func ValidateIndex(intent *intents.Intent, index IndexDocument) error {
+	name, ok := index.Options["name"].(string)
+	if !ok || name == "" {
+		return fmt.Errorf("index with key %v has no name", index.Key)
+	}
+
+	if err := validateIndexNamespace(intent, index); err != nil {
+		return err
+	}
+
+	if len(index.Key) == 0 {
+		return fmt.Errorf("index '%v' has an empty key", name)
+	}
+	for _, field := range index.Key {
+		// key values are either a direction or the name of
+		// an index type, like "2dsphere" or "hashed"
+		invalid := false
+		switch value := field.Value.(type) {
+		case nil, bool, []interface{}:
+			invalid = true
+		case string:
+			invalid = value == ""
+		}
+		if invalid {
+			return fmt.Errorf("index '%v' has an invalid value %v for key field '%v'",
+				name, field.Value, field.Name)
+		}
+	}
+	return nil
+}
+
 //TODO test this
 func (restore *MongoRestore) IndexesFromBSON(intent *intents.Intent, bsonFile string) ([]IndexDocument, error) {
 	log.Logf(log.DebugLow, "scanning %v for indexes on %v collections", bsonFile, intent.C)
 
-	rawFile, err := os.Open(bsonFile)
+	rawSource, err := restore.OpenDataFile(bsonFile)
 	if err != nil {
-		return nil, fmt.Errorf("error reading index bson file %v: %v", bsonFile, err)
+		return nil, fmt.Errorf("error reading index file %v: %v", bsonFile, err)
 	}
 
-	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(rawFile))
+	bsonSource := db.NewDecodedBSONSource(rawSource)
 	defer bsonSource.Close()
 
 	// iterate over stored indexes, saving all that match the collection
@@ -141,23 +232,9 @@ func (restore *MongoRestore) CollectionExists(intent *intents.Intent) (bool, err
 // fails, we fall back to individual index creation.
 func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []IndexDocument) error {
 	// first, sanitize the indexes
-	for _, index := range indexes {
-		// update the namespace of the index before inserting
-		index.Options["ns"] = intent.Key()
-
-		// check for length violations before building the command
-		fullIndexName := fmt.Sprintf("%v.$%v", index.Options["ns"], index.Options["name"])
-		if len(fullIndexName) > 127 {
-			return fmt.Errorf(
-				"cannot restore index with namespace '%v': "+
-					"namespace is too long (max size is 127 bytes)", fullIndexName)
-		}
-
-		// remove the index version, forcing an update,
-		// unless we specifically want to keep it
-		if !restore.OutputOptions.KeepIndexVersion {
-			delete(index.Options, "v")
-		}
+	indexes, err := restore.sanitizeIndexes(intent, indexes)
+	if err != nil {
+		return err
 	}
 
 	session, err := restore.SessionProvider.GetSession()
@@ -194,6 +271,40 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 	return nil
 }
 
+// sanitizeIndexes checks the namespace length of indexes and returns copies of them updated for
+// the namespace they're restored to. The options of the given indexes are left
+// as they are, since they may be shared, e.g. with the verification of
+// deferred index builds.
+func (restore *MongoRestore) sanitizeIndexes(intent *intents.Intent, indexes []IndexDocument) ([]IndexDocument, error) {
+	sanitized := make([]IndexDocument, 0, len(indexes))
+	for _, index := range indexes {
+		// check for length violations before building the command
+		if err := validateIndexNamespace(intent, index); err != nil {
+			return nil, err
+		}
+
+		options := bson.M{}
+		for name, value := range index.Options {
+			options[name] = value
+		}
+
+		// update the namespace of the index before inserting
+		options["ns"] = intent.Key()
+
+		// remove the index version, forcing an update,
+		// unless we specifically want to keep it
+		if !restore.OutputOptions.KeepIndexVersion {
+			delete(options, "v")
+		}
+
+		if restore.OutputOptions.ForceBackgroundIndexBuilds {
+			options["background"] = true
+		}
+		sanitized = append(sanitized, IndexDocument{Options: options, Key: index.Key})
+	}
+	return sanitized, nil
+}
+
 func (restore *MongoRestore) LegacyInsertIndex(intent *intents.Intent, index IndexDocument) error {
 	session, err := restore.SessionProvider.GetSession()
 	if err != nil {
@@ -255,11 +366,11 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 		return fmt.Errorf("cannot use %v as a collection type in RestoreUsersOrRoles", collectionType)
 	}
 
-	rawFile, err := os.Open(intent.BSONPath)
+	rawSource, err := restore.OpenDataFile(intent.BSONPath)
 	if err != nil {
-		return fmt.Errorf("error reading index bson file %v: %v", intent.BSONPath, err)
+		return fmt.Errorf("error reading %v file %v: %v", collectionType, intent.BSONPath, err)
 	}
-	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(rawFile))
+	bsonSource := db.NewDecodedBSONSource(rawSource)
 	defer bsonSource.Close()
 
 	tempColExists, err := restore.CollectionExists(&intents.Intent{DB: "admin", C: tempCol})
@@ -303,6 +414,24 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 		userTargetDB = ""
 	}
 
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	err = restore.remapAuthDatabases(session.DB("admin").C(tempCol), userTargetDB)
+	if err != nil {
+		return fmt.Errorf("error remapping databases of %v: %v", collectionType, err)
+	}
+	if restore.usersAndRolesMode == UsersAndRolesMerge {
+		err = keepExistingAuthDocuments(session.DB("admin"), collectionType, tempCol)
+		if err != nil {
+			return fmt.Errorf("error merging %v: %v", collectionType, err)
+		}
+	}
+
 	// we have to manually convert mgo's safety to a writeconcern object
 	writeConcern := bson.M{}
 	if restore.safety == nil {
@@ -318,18 +447,11 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	command := bsonutil.MarshalD{
 		{"_mergeAuthzCollections", 1},
 		{tempColCommandField, "admin." + tempCol},
-		{"drop", restore.OutputOptions.Drop},
+		{"drop", restore.usersAndRolesMode == UsersAndRolesReplace},
 		{"writeConcern", writeConcern},
 		{"db", userTargetDB},
 	}
 
-	session, err := restore.SessionProvider.GetSession()
-	if err != nil {
-		return fmt.Errorf("error establishing connection: %v", err)
-	}
-	defer session.Close()
-	session.SetSocketTimeout(0)
-
 	log.Logf(log.DebugLow, "merging %v from temp collection", collectionType)
 	res := bson.M{}
 	err = session.Run(command, &res)
@@ -342,6 +464,194 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	return nil
 }
 
+// ResolveUsersAndRolesMode validates a --usersAndRolesMode, returning the
+// default mode if none was given: replace when dropping collections, merge otherwise
+func ResolveUsersAndRolesMode(mode string, drop bool) (string, error) {
+	switch mode {
+	case "":
+		if drop {
+			return UsersAndRolesReplace, nil
+		}
+		return UsersAndRolesMerge, nil
+	case UsersAndRolesMerge, UsersAndRolesReplace, UsersAndRolesSkip:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid --usersAndRolesMode '%v', must be one of '%v', '%v' or '%v'",
+		mode, UsersAndRolesMerge, UsersAndRolesReplace, UsersAndRolesSkip)
+}
+
+// ParseAuthDBRemaps parses arguments of the form "olddb=newdb"
+// into a map of old database names to new ones
+func ParseAuthDBRemaps(args []string) (map[string]string, error) {
+	remaps := map[string]string{}
+	for _, arg := range args {
+		split := strings.SplitN(arg, "=", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return nil, fmt.Errorf("'%v' is not of the form olddb=newdb", arg)
+		}
+		for _, dbName := range split {
+			if err := util.ValidateDBName(dbName); err != nil {
+				return nil, fmt.Errorf("invalid database name in '%v': %v", arg, err)
+			}
+		}
+		if _, ok := remaps[split[0]]; ok {
+			return nil, fmt.Errorf("database '%v' is remapped more than once", split[0])
+		}
+		remaps[split[0]] = split[1]
+	}
+	return remaps, nil
+}
+
+// remapAuthDatabases moves the users or roles in the temporary collection
+// to the databases they are remapped to by --usersAndRolesDbRemap. When
+// restoring the users and roles of a single database, they are always moved to
+// the target database, in case it has a different name than the dumped one.
+func (restore *MongoRestore) remapAuthDatabases(tempCollection *mgo.Collection, targetDB string) error {
+	if len(restore.authDBRemaps) == 0 && targetDB == "" {
+		return nil
+	}
+	// read every document first, so remapped documents aren't seen again
+	docs := []bson.D{}
+	if err := tempCollection.Find(nil).All(&docs); err != nil {
+		return err
+	}
+	remapped := 0
+	for _, doc := range docs {
+		remaps := restore.authDBRemaps
+		if dumpDB, ok := authDocumentDB(doc); ok && targetDB != "" && dumpDB != targetDB {
+			remaps = map[string]string{dumpDB: targetDB}
+		}
+		newDoc, changed := RemapAuthDocument(doc, remaps)
+		if !changed {
+			continue
+		}
+		id, _ := bsonutil.FindValueByKey("_id", &doc)
+		if err := tempCollection.RemoveId(id); err != nil {
+			return err
+		}
+		if err := tempCollection.Insert(newDoc); err != nil {
+			return err
+		}
+		remapped++
+	}
+	if remapped > 0 {
+		log.Logf(log.Info, "moved %v users or roles to remapped databases", remapped)
+	}
+	return nil
+}
+
+// authDocumentDB returns the database of a user or role document
+func authDocumentDB(doc bson.D) (string, bool) {
+	value, err := bsonutil.FindValueByKey("db", &doc)
+	if err != nil {
+		return "", false
+	}
+	db, ok := value.(string)
+	return db, ok
+}
+
+// RemapAuthDocument returns a copy of a user or role document with its
+// databases changed according to remaps: its own database and _id, and the
+// databases of the roles it is granted and the resources of its privileges.
+// It also returns whether anything was changed.
+func RemapAuthDocument(doc bson.D, remaps map[string]string) (bson.D, bool) {
+	changed := false
+	remap := func(db string) string {
+		if newDB, ok := remaps[db]; ok && newDB != db {
+			changed = true
+			return newDB
+		}
+		return db
+	}
+
+	newDoc := bson.D{}
+	for _, elem := range doc {
+		switch elem.Name {
+		case "_id":
+			// _ids of users and roles are "<db>.<name>"
+			if id, ok := elem.Value.(string); ok {
+				if i := strings.Index(id, "."); i > 0 {
+					elem.Value = remap(id[:i]) + id[i:]
+				}
+			}
+		case "db":
+			if db, ok := elem.Value.(string); ok {
+				elem.Value = remap(db)
+			}
+		case "roles":
+			elem.Value = remapAuthSubdocuments(elem.Value, func(role bson.D) bson.D {
+				return remapAuthField(role, "db", remap)
+			})
+		case "privileges":
+			elem.Value = remapAuthSubdocuments(elem.Value, func(privilege bson.D) bson.D {
+				for i := range privilege {
+					if resource, ok := privilege[i].Value.(bson.D); ok && privilege[i].Name == "resource" {
+						privilege[i].Value = remapAuthField(resource, "db", remap)
+					}
+				}
+				return privilege
+			})
+		}
+		newDoc = append(newDoc, elem)
+	}
+	return newDoc, changed
+}
+
+// remapAuthSubdocuments applies a remapping to each document in an array
+func remapAuthSubdocuments(value interface{}, remap func(bson.D) bson.D) interface{} {
+	array, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	newArray := make([]interface{}, len(array))
+	for i, elem := range array {
+		if subdoc, ok := elem.(bson.D); ok {
+			elem = remap(append(bson.D{}, subdoc...))
+		}
+		newArray[i] = elem
+	}
+	return newArray
+}
+
+// remapAuthField remaps the string value of a field holding a database name.
+// Empty database names, which match any database, are left as they are.
+func remapAuthField(doc bson.D, field string, remap func(string) string) bson.D {
+	for i := range doc {
+		if db, ok := doc[i].Value.(string); ok && doc[i].Name == field && db != "" {
+			doc[i].Value = remap(db)
+		}
+	}
+	return doc
+}
+
+// keepExistingAuthDocuments removes users or roles that already exist
+// on the server from the temporary collection, so that merging it keeps
+// the existing ones unchanged and only adds those that are missing
+func keepExistingAuthDocuments(admin *mgo.Database, collectionType, tempCol string) error {
+	existing := []interface{}{}
+	iter := admin.C("system." + collectionType).Find(nil).Select(bson.M{"_id": 1}).Iter()
+	idDoc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	for iter.Next(&idDoc) {
+		existing = append(existing, idDoc.ID)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	info, err := admin.C(tempCol).RemoveAll(bson.M{"_id": bson.M{"$in": existing}})
+	if err != nil {
+		return err
+	}
+	if info.Removed > 0 {
+		log.Logf(log.Always, "keeping %v %v that already exist on the server", info.Removed, collectionType)
+	}
+	return nil
+}
+
 // GetDumpAuthVersion reads the admin.system.version collection in the dump directory
 // to determine the auth version of the files in the dump. If that collection is not
 // present in the dump, we try to infer the auth version based on its absence.
@@ -364,11 +674,11 @@ func (restore *MongoRestore) GetDumpAuthVersion() (int, error) {
 		log.Log(log.Always, "assuming users in the dump directory are from <= 2.4 (auth version 1)")
 		return 1, nil
 	}
-	rawFile, err := os.Open(intent.BSONPath)
+	rawSource, err := restore.OpenDataFile(intent.BSONPath)
 	if err != nil {
-		return 0, fmt.Errorf("error reading version bson file %v: %v", intent.BSONPath, err)
+		return 0, fmt.Errorf("error reading version file %v: %v", intent.BSONPath, err)
 	}
-	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(rawFile))
+	bsonSource := db.NewDecodedBSONSource(rawSource)
 	defer bsonSource.Close()
 
 	versionDoc := struct {
@@ -438,6 +748,9 @@ func (restore *MongoRestore) ValidateAuthVersions() error {
 // ShouldRestoreUsersAndRoles returns whether or not MongoRestore should
 // go through the process of handling auth collections.
 func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
+	if restore.usersAndRolesMode == UsersAndRolesSkip {
+		return false
+	}
 	// If the user has done anything that would indicate the restoration
 	// of users and roles (i.e. used --restoreDbUsersAndRoles, -d admin, or
 	// is doing a full restore), then we check if users or roles BSON files
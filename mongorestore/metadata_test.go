@@ -166,3 +166,120 @@ func TestGetDumpAuthVersion(t *testing.T) {
 	})
 
 }
+
+func TestUsersAndRolesOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With --usersAndRolesMode", t, func() {
+
+		Convey("the default should depend on --drop", func() {
+			mode, err := ResolveUsersAndRolesMode("", true)
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, UsersAndRolesReplace)
+			mode, err = ResolveUsersAndRolesMode("", false)
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, UsersAndRolesMerge)
+		})
+
+		Convey("a given mode should override the default", func() {
+			mode, err := ResolveUsersAndRolesMode(UsersAndRolesSkip, true)
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, UsersAndRolesSkip)
+		})
+
+		Convey("unknown modes should be an error", func() {
+			_, err := ResolveUsersAndRolesMode("overwrite", false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("users and roles should not be restored when skipped", func() {
+			restore := &MongoRestore{
+				InputOptions:      &InputOptions{RestoreDBUsersAndRoles: true},
+				ToolOptions:       &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+				manager:           intents.NewCategorizingIntentManager(),
+				usersAndRolesMode: UsersAndRolesSkip,
+			}
+			restore.manager.Put(&intents.Intent{DB: "admin", C: "system.users", BSONPath: "users.bson"})
+			So(restore.ShouldRestoreUsersAndRoles(), ShouldBeFalse)
+			restore.usersAndRolesMode = UsersAndRolesMerge
+			So(restore.ShouldRestoreUsersAndRoles(), ShouldBeTrue)
+		})
+	})
+
+	Convey("With --usersAndRolesDbRemap", t, func() {
+
+		Convey("remaps should be parsed", func() {
+			remaps, err := ParseAuthDBRemaps([]string{"a=b", "c=d"})
+			So(err, ShouldBeNil)
+			So(remaps, ShouldResemble, map[string]string{"a": "b", "c": "d"})
+		})
+
+		Convey("invalid remaps should be an error", func() {
+			for _, arg := range []string{"a", "a=", "a=b/c", "=b"} {
+				_, err := ParseAuthDBRemaps([]string{arg})
+				So(err, ShouldNotBeNil)
+			}
+			_, err := ParseAuthDBRemaps([]string{"a=b", "a=c"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRemapAuthDocument(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a user and a role", t, func() {
+		user := bson.D{
+			{"_id", "old.alice"},
+			{"user", "alice"},
+			{"db", "old"},
+			{"roles", []interface{}{
+				bson.D{{"role", "readWrite"}, {"db", "old"}},
+				bson.D{{"role", "read"}, {"db", "other"}},
+			}},
+		}
+		role := bson.D{
+			{"_id", "old.reporting"},
+			{"role", "reporting"},
+			{"db", "old"},
+			{"privileges", []interface{}{
+				bson.D{{"resource", bson.D{{"db", "old"}, {"collection", "reports"}}}, {"actions", []interface{}{"find"}}},
+				bson.D{{"resource", bson.D{{"db", ""}, {"collection", ""}}}, {"actions", []interface{}{"listCollections"}}},
+			}},
+			{"roles", []interface{}{}},
+		}
+		remaps := map[string]string{"old": "new"}
+
+		Convey("a user's database, _id and roles should be remapped", func() {
+			remapped, changed := RemapAuthDocument(user, remaps)
+			So(changed, ShouldBeTrue)
+			So(remapped, ShouldResemble, bson.D{
+				{"_id", "new.alice"},
+				{"user", "alice"},
+				{"db", "new"},
+				{"roles", []interface{}{
+					bson.D{{"role", "readWrite"}, {"db", "new"}},
+					bson.D{{"role", "read"}, {"db", "other"}},
+				}},
+			})
+			// the original should be unchanged
+			So(user[0].Value, ShouldEqual, "old.alice")
+		})
+
+		Convey("a role's privileges should be remapped, except those on any database", func() {
+			remapped, changed := RemapAuthDocument(role, remaps)
+			So(changed, ShouldBeTrue)
+			So(remapped[0].Value, ShouldEqual, "new.reporting")
+			privileges := remapped[3].Value.([]interface{})
+			So(privileges[0].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", "new"}, {"collection", "reports"}})
+			So(privileges[1].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", ""}, {"collection", ""}})
+		})
+
+		Convey("documents in other databases should be unchanged", func() {
+			_, changed := RemapAuthDocument(user, map[string]string{"another": "new"})
+			So(changed, ShouldBeFalse)
+		})
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"os"
 	"sync"
 )
 
@@ -31,11 +32,40 @@ type MongoRestore struct {
 	safety          *mgo.Safe
 	progressManager *progress.Manager
 
-	objCheck     bool
-	oplogLimit   bson.MongoTimestamp
-	useStdin     bool
-	isMongos     bool
-	authVersions authVersionPair
+	objCheck   bool
+	oplogLimit bson.MongoTimestamp
+	oplogStart bson.MongoTimestamp
+	// set by --oplogLimitMatch; resolved to an oplogLimit before replay
+	oplogLimitFilter oplogFilter
+	// replay the oplog with regular writes instead of applyOps
+	useCRUDOplogReplay bool
+	useStdin           bool
+	isMongos           bool
+	authVersions       authVersionPair
+	// restore collections from extended JSON files, set by --inputFormat
+	useJSONInput bool
+	// set by --shardKey
+	shardKeyOverrides []shardKeyOverride
+	// set by --usersAndRolesMode and --usersAndRolesDbRemap
+	usersAndRolesMode string
+	authDBRemaps      map[string]string
+	// read from --metadataOverrides
+	metadataOverrides []MetadataOverride
+	// read from --transformFile
+	documentTransforms []DocumentTransform
+	// read from --priorityFile
+	priorityRules []intents.PriorityRule
+
+	// set by --maxInsertsPerSecond and --maxReplicationLag; nil if inserts aren't throttled
+	throttle *InsertThrottle
+
+	// indexes saved by --deferIndexBuilds
+	deferredIndexes      []deferredIndexes
+	deferredIndexesMutex sync.Mutex
+
+	// results of --verify, one per restored namespace
+	verifyReports      []*VerifyReport
+	verifyReportsMutex sync.Mutex
 
 	// a map of database names to a list of collection names
 	knownCollections      map[string][]string
@@ -82,11 +112,71 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 	if restore.isMongos {
 		log.Log(log.DebugLow, "restoring to a sharded system")
-		if restore.ToolOptions.DB == "" {
-			return fmt.Errorf("cannot do a full restore on a sharded system")
+	}
+
+	if restore.OutputOptions.Verify && restore.OutputOptions.DryRun {
+		return fmt.Errorf("cannot use --verify with --dryRun")
+	}
+
+	if restore.OutputOptions.DeferIndexBuilds {
+		if restore.OutputOptions.NoIndexRestore {
+			return fmt.Errorf("cannot use --deferIndexBuilds with --noIndexRestore")
+		}
+		if restore.OutputOptions.NumParallelIndexBuilds < 1 {
+			return fmt.Errorf("--numParallelIndexBuilds must be at least 1")
+		}
+	}
+
+	if restore.OutputOptions.MetadataOverrides != "" {
+		restore.metadataOverrides, err = ReadMetadataOverrides(restore.OutputOptions.MetadataOverrides)
+		if err != nil {
+			return fmt.Errorf("error reading --metadataOverrides: %v", err)
 		}
 	}
 
+	if restore.OutputOptions.TransformFile != "" {
+		restore.documentTransforms, err = ReadDocumentTransforms(restore.OutputOptions.TransformFile)
+		if err != nil {
+			return fmt.Errorf("error reading --transformFile: %v", err)
+		}
+	}
+
+	if restore.OutputOptions.PriorityFile != "" {
+		if restore.OutputOptions.AdaptiveScheduling {
+			return fmt.Errorf("cannot use --adaptiveScheduling with --priorityFile")
+		}
+		restore.priorityRules, err = intents.ReadPriorityRules(restore.OutputOptions.PriorityFile)
+		if err != nil {
+			return fmt.Errorf("error reading --priorityFile: %v", err)
+		}
+	}
+
+	if restore.OutputOptions.ShardCollections && !restore.isMongos {
+		return fmt.Errorf("cannot use --shardCollections without connecting to mongos")
+	}
+	if len(restore.OutputOptions.ShardKeys) > 0 {
+		if !restore.isMongos {
+			return fmt.Errorf("cannot use --shardKey without connecting to mongos")
+		}
+		for _, arg := range restore.OutputOptions.ShardKeys {
+			override, err := parseShardKeyOverride(arg)
+			if err != nil {
+				return fmt.Errorf("error parsing --shardKey: %v", err)
+			}
+			restore.shardKeyOverrides = append(restore.shardKeyOverrides, override)
+		}
+	}
+
+	restore.usersAndRolesMode, err = ResolveUsersAndRolesMode(
+		restore.OutputOptions.UsersAndRolesMode, restore.OutputOptions.Drop)
+	if err != nil {
+		return err
+	}
+	restore.authDBRemaps, err = ParseAuthDBRemaps(restore.OutputOptions.UsersAndRolesDBRemaps)
+	if err != nil {
+		return fmt.Errorf("error parsing --usersAndRolesDbRemap: %v", err)
+	}
+
 	if restore.InputOptions.OplogLimit != "" {
 		if !restore.InputOptions.OplogReplay {
 			return fmt.Errorf("cannot use --oplogLimit without --oplogReplay enabled")
@@ -95,6 +185,68 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		if err != nil {
 			return fmt.Errorf("error parsing timestamp argument to --oplogLimit: %v", err)
 		}
+		log.Logf(log.Always, "--oplogLimit resolved to %v", FormatTimestamp(restore.oplogLimit))
+	}
+	if restore.InputOptions.OplogLimitMatch != "" {
+		if !restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogLimitMatch without --oplogReplay enabled")
+		}
+		restore.oplogLimitFilter, err = ParseOplogFilter(restore.InputOptions.OplogLimitMatch)
+		if err != nil {
+			return fmt.Errorf("error parsing --oplogLimitMatch: %v", err)
+		}
+	}
+	if restore.InputOptions.OplogStart != "" {
+		if !restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogStart without --oplogReplay enabled")
+		}
+		restore.oplogStart, err = ParseTimestampFlag(restore.InputOptions.OplogStart)
+		if err != nil {
+			return fmt.Errorf("error parsing timestamp argument to --oplogStart: %v", err)
+		}
+		log.Logf(log.Always, "--oplogStart resolved to %v", FormatTimestamp(restore.oplogStart))
+		if restore.oplogLimit != 0 && restore.oplogStart >= restore.oplogLimit {
+			return fmt.Errorf("--oplogStart must be before --oplogLimit")
+		}
+	}
+	if len(restore.InputOptions.OplogNsInclude) > 0 || len(restore.InputOptions.OplogNsExclude) > 0 {
+		if !restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogNsInclude or --oplogNsExclude without --oplogReplay enabled")
+		}
+		for _, pattern := range restore.InputOptions.OplogNsInclude {
+			if err = util.ValidateNamespacePattern(pattern); err != nil {
+				return fmt.Errorf("error parsing --oplogNsInclude: %v", err)
+			}
+		}
+		for _, pattern := range restore.InputOptions.OplogNsExclude {
+			if err = util.ValidateNamespacePattern(pattern); err != nil {
+				return fmt.Errorf("error parsing --oplogNsExclude: %v", err)
+			}
+		}
+	}
+	if restore.InputOptions.OplogFile != "" && !restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --oplogFile without --oplogReplay enabled")
+	}
+
+	switch restore.InputOptions.OplogApplyMode {
+	case "":
+		// applyOps cannot be run through mongos
+		restore.useCRUDOplogReplay = restore.isMongos
+	case "applyOps":
+		restore.useCRUDOplogReplay = false
+	case "crud":
+		restore.useCRUDOplogReplay = true
+	default:
+		return fmt.Errorf("invalid --oplogApplyMode '%v'; must be 'applyOps' or 'crud'",
+			restore.InputOptions.OplogApplyMode)
+	}
+	if restore.InputOptions.OplogApplyMode != "" && !restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --oplogApplyMode without --oplogReplay enabled")
+	}
+	if restore.isMongos {
+		if err = restore.validateShardedRestore(); err != nil {
+			return err
+		}
 	}
 
 	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
@@ -107,6 +259,19 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf("error parsing write concern: %v", err)
 	}
 
+	if restore.OutputOptions.MaxInsertsPerSecond < 0 {
+		return fmt.Errorf("--maxInsertsPerSecond must be at least 0")
+	}
+	if restore.OutputOptions.MaxReplicationLag < 0 {
+		return fmt.Errorf("--maxReplicationLag must be at least 0")
+	}
+	if restore.OutputOptions.MaxReplicationLag > 0 && !isRepl {
+		return fmt.Errorf("cannot use --maxReplicationLag without connecting to a replica set")
+	}
+	if restore.OutputOptions.MaxInsertsPerSecond > 0 || restore.OutputOptions.MaxReplicationLag > 0 {
+		restore.throttle = NewInsertThrottle(restore.OutputOptions.MaxInsertsPerSecond)
+	}
+
 	if restore.tempUsersCol == "" {
 		restore.tempUsersCol = "tempusers"
 	}
@@ -127,6 +292,20 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		}
 	}
 
+	switch restore.InputOptions.InputFormat {
+	case "", "bson":
+	case "json":
+		if restore.useStdin {
+			return fmt.Errorf("cannot restore JSON from stdin")
+		}
+		if restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogReplay with --inputFormat=json")
+		}
+		restore.useJSONInput = true
+	default:
+		return fmt.Errorf("invalid --inputFormat '%v', must be 'bson' or 'json'", restore.InputOptions.InputFormat)
+	}
+
 	return nil
 }
 
@@ -139,8 +318,13 @@ func (restore *MongoRestore) Restore() error {
 
 	// Build up all intents to be restored
 	restore.manager = intents.NewCategorizingIntentManager()
+	restore.manager.SetPriorityRules(restore.priorityRules)
 
 	switch {
+	case restore.onlyReplayingOplogFile():
+		log.Logf(log.Always,
+			"no dump directory given, only replaying oplog file %v",
+			restore.InputOptions.OplogFile)
 	case restore.ToolOptions.DB == "" && restore.ToolOptions.Collection == "":
 		log.Logf(log.Always,
 			"building a list of dbs and collections to restore from %v dir",
@@ -163,6 +347,12 @@ func (restore *MongoRestore) Restore() error {
 	if err != nil {
 		return fmt.Errorf("error scanning filesystem: %v", err)
 	}
+	if restore.InputOptions.OplogFile != "" {
+		err = restore.CreateIntentForOplogFile(restore.InputOptions.OplogFile)
+		if err != nil {
+			return fmt.Errorf("error reading oplog file: %v", err)
+		}
+	}
 
 	// If restoring users and roles, make sure we validate auth versions
 	if restore.ShouldRestoreUsersAndRoles() {
@@ -183,8 +373,31 @@ func (restore *MongoRestore) Restore() error {
 		}
 	}
 
+	if restore.OutputOptions.DryRun {
+		if len(restore.priorityRules) > 0 {
+			// report collections in the order they would be restored
+			restore.manager.Finalize(intents.UserPriority)
+		} else {
+			restore.manager.Finalize(intents.Legacy)
+		}
+		return restore.DryRun()
+	}
+
+	// resolve --oplogLimitMatch and preview the skipped entries before
+	// anything is written, so that a filter matching nothing fails early
+	if restore.InputOptions.OplogReplay && restore.manager.Oplog() != nil {
+		err = restore.ResolveOplogLimit(restore.manager.Oplog().BSONPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Restore the regular collections
-	if restore.OutputOptions.NumParallelCollections > 0 {
+	if len(restore.priorityRules) > 0 {
+		restore.manager.Finalize(intents.UserPriority)
+	} else if restore.OutputOptions.AdaptiveScheduling {
+		restore.manager.Finalize(intents.AdaptiveThroughput)
+	} else if restore.OutputOptions.NumParallelCollections > 0 {
 		restore.manager.Finalize(intents.MultiDatabaseLTF)
 	} else {
 		// use legacy restoration order if we are single-threaded
@@ -195,6 +408,13 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("restore error: %v", err)
 	}
 
+	// failed index builds don't stop the rest of the restore;
+	// they're reported once it's done
+	var indexErr error
+	if restore.OutputOptions.DeferIndexBuilds {
+		indexErr = restore.BuildDeferredIndexes()
+	}
+
 	// Restore users/roles
 	if restore.ShouldRestoreUsersAndRoles() {
 		if restore.manager.Users() != nil {
@@ -219,6 +439,25 @@ func (restore *MongoRestore) Restore() error {
 		}
 	}
 
+	if restore.OutputOptions.Verify {
+		err = restore.WriteVerifyReports(os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+
+	if indexErr != nil {
+		return fmt.Errorf("restore error: %v", indexErr)
+	}
+
 	log.Log(log.Always, "done")
 	return nil
 }
+
+// onlyReplayingOplogFile returns true if the user supplied an --oplogFile
+// to apply on top of an already restored database without naming a dump
+// directory to restore from, such as when replaying incremental oplog segments.
+// A named directory that doesn't exist is still an error.
+func (restore *MongoRestore) onlyReplayingOplogFile() bool {
+	return restore.InputOptions.OplogFile != "" && restore.TargetDirectory == ""
+}
@@ -2,13 +2,16 @@ package mongorestore
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -22,7 +25,7 @@ type Oplog struct {
 	Version   int                 `bson:"v,omitempty"`
 	Operation string              `bson:"op,omitempty"`
 	Namespace string              `bson:"ns,omitempty"`
-	Object    bson.M              `bson:"o,omitempty"`
+	Object    bson.D              `bson:"o,omitempty"`
 	Query     bson.M              `bson:"o2,omitempty"`
 }
 
@@ -50,11 +53,10 @@ func (restore *MongoRestore) RestoreOplog() error {
 	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(oplogFile))
 	defer bsonSource.Close()
 
-	entryArray := make([]interface{}, 0, 1024)
 	rawOplogEntry := &bson.Raw{}
 
-	var totalBytes, totalOps int64
-	var entrySize, bufferedBytes int
+	var totalBytes, totalOps, skippedOps int64
+	var entrySize int
 
 	bar := progress.ProgressBar{
 		Name:       "oplog",
@@ -74,19 +76,19 @@ func (restore *MongoRestore) RestoreOplog() error {
 	session.SetSocketTimeout(0)
 	defer session.Close()
 
+	var applier oplogApplier
+	if restore.useCRUDOplogReplay {
+		log.Log(log.Info, "replaying oplog entries as individual writes and commands")
+		applier = newCRUDOplogApplier(session, restore.ToolOptions.BulkBufferSize)
+	} else {
+		applier = &applyOpsApplier{restore: restore, session: session}
+	}
+
 	// To restore the oplog, we iterate over the oplog entries,
-	// filling up a buffer. Once the buffer reaches max document size,
-	// apply the current buffered ops and reset the buffer.
+	// handing each one that passes our filters to the applier,
+	// which buffers them and writes them in batches.
 	for bsonSource.Next(rawOplogEntry) {
 		entrySize = len(rawOplogEntry.Data)
-		if bufferedBytes+entrySize > OplogMaxCommandSize {
-			err = restore.ApplyOps(session, entryArray)
-			if err != nil {
-				return fmt.Errorf("error applying oplog: %v", err)
-			}
-			entryArray = make([]interface{}, 0, 1024)
-			bufferedBytes = 0
-		}
 
 		entryAsOplog := Oplog{}
 		err = bson.Unmarshal(rawOplogEntry.Data, &entryAsOplog)
@@ -106,25 +108,250 @@ func (restore *MongoRestore) RestoreOplog() error {
 			)
 			break
 		}
+		if !restore.TimestampAfterStart(entryAsOplog.Timestamp) ||
+			!restore.OplogNamespaceIncluded(entryAsOplog) {
+			skippedOps++
+			totalBytes += int64(entrySize)
+			continue
+		}
 
 		totalOps++
-		bufferedBytes += entrySize
 		totalBytes += int64(entrySize)
-		entryArray = append(entryArray, entryAsOplog)
-	}
-	// finally, flush the remaining entries
-	if len(entryArray) > 0 {
-		err = restore.ApplyOps(session, entryArray)
+		err = applier.Apply(entryAsOplog, entrySize)
 		if err != nil {
 			return fmt.Errorf("error applying oplog: %v", err)
 		}
 	}
+	// finally, flush the remaining entries
+	err = applier.Flush()
+	if err != nil {
+		return fmt.Errorf("error applying oplog: %v", err)
+	}
+
+	if err = bsonSource.Err(); err != nil {
+		return fmt.Errorf("error reading oplog bson input: %v", err)
+	}
 
 	log.Logf(log.Info, "applied %v ops", totalOps)
+	if skippedOps > 0 {
+		log.Logf(log.Info, "skipped %v ops outside of the requested range or namespaces", skippedOps)
+	}
 	return nil
 
 }
 
+// maxPreviewedOplogEntries bounds how many excluded oplog entries are printed
+const maxPreviewedOplogEntries = 10
+
+// ResolveOplogLimit scans the oplog file before any of it is applied. If
+// --oplogLimitMatch was given, the limit is set to the timestamp of the first
+// matching entry. The resolved limit and the entries that will be skipped
+// because of it are then printed, so the user can see exactly where replay stops.
+func (restore *MongoRestore) ResolveOplogLimit(oplogPath string) error {
+	if restore.oplogLimit == 0 && restore.oplogLimitFilter == nil {
+		return nil
+	}
+
+	oplogFile, err := os.Open(oplogPath)
+	if err != nil {
+		return fmt.Errorf("error reading oplog file: %v", err)
+	}
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(oplogFile))
+	defer bsonSource.Close()
+
+	rawOplogEntry := &bson.Raw{}
+	matched := false
+	var skippedOps int64
+	for bsonSource.Next(rawOplogEntry) {
+		entry := Oplog{}
+		err = bson.Unmarshal(rawOplogEntry.Data, &entry)
+		if err != nil {
+			return fmt.Errorf("error reading oplog: %v", err)
+		}
+		if entry.Operation == "n" {
+			continue
+		}
+		// entries that aren't replayed anyway can neither match nor be skipped
+		if !restore.TimestampAfterStart(entry.Timestamp) || !restore.OplogNamespaceIncluded(entry) {
+			continue
+		}
+		if restore.oplogLimitFilter != nil && !matched &&
+			restore.TimestampBeforeLimit(entry.Timestamp) {
+			entryAsMap := bson.M{}
+			err = bson.Unmarshal(rawOplogEntry.Data, &entryAsMap)
+			if err != nil {
+				return fmt.Errorf("error reading oplog: %v", err)
+			}
+			if restore.oplogLimitFilter.Matches(entryAsMap) {
+				matched = true
+				restore.oplogLimit = entry.Timestamp
+				log.Logf(log.Always, "found oplog entry matching --oplogLimitMatch at %v",
+					FormatTimestamp(entry.Timestamp))
+			}
+		}
+		if restore.TimestampBeforeLimit(entry.Timestamp) {
+			continue
+		}
+		skippedOps++
+		if skippedOps <= maxPreviewedOplogEntries {
+			log.Logf(log.Always, "\twill skip %v", DescribeOplogEntry(entry))
+		}
+	}
+	if err = bsonSource.Err(); err != nil {
+		return fmt.Errorf("error reading oplog bson input: %v", err)
+	}
+
+	if restore.oplogLimitFilter != nil && !matched {
+		if restore.oplogLimit == 0 {
+			return fmt.Errorf("no oplog entry matches the --oplogLimitMatch filter")
+		}
+		log.Log(log.Always, "no oplog entry before --oplogLimit matches the --oplogLimitMatch filter")
+	}
+	if skippedOps > maxPreviewedOplogEntries {
+		log.Logf(log.Always, "\t...and %v more", skippedOps-maxPreviewedOplogEntries)
+	}
+	log.Logf(log.Always, "replaying oplog up to but excluding %v; %v entries will be skipped",
+		FormatTimestamp(restore.oplogLimit), skippedOps)
+	return nil
+}
+
+// DescribeOplogEntry returns a short, human-readable summary of an oplog entry
+func DescribeOplogEntry(entry Oplog) string {
+	var operation string
+	switch entry.Operation {
+	case "i":
+		operation = "insert"
+	case "u":
+		operation = "update"
+	case "d":
+		operation = "delete"
+	case "c":
+		operation = "command"
+		if len(entry.Object) > 0 {
+			operation = entry.Object[0].Name
+		}
+	default:
+		operation = fmt.Sprintf("op '%v'", entry.Operation)
+	}
+	return fmt.Sprintf("%v %v on %v", FormatTimestamp(entry.Timestamp),
+		operation, OplogEntryNamespace(entry))
+}
+
+// oplogFilter holds dotted field paths and the values an oplog entry must
+// have at those paths. It is used by --oplogLimitMatch to find the first entry
+// that should not be replayed, such as an accidental drop.
+type oplogFilter map[string]interface{}
+
+// ParseOplogFilter parses an extended JSON document into an oplogFilter
+func ParseOplogFilter(raw string) (oplogFilter, error) {
+	filter := map[string]interface{}{}
+	err := json.Unmarshal([]byte(raw), &filter)
+	if err != nil {
+		return nil, fmt.Errorf("filter '%v' is not valid JSON: %v", raw, err)
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("filter must have at least one field")
+	}
+	err = bsonutil.ConvertJSONDocumentToBSON(filter)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing filter '%v': %v", raw, err)
+	}
+	return oplogFilter(filter), nil
+}
+
+// Matches returns true if every path in the filter is present
+// in the entry and holds an equal value.
+func (filter oplogFilter) Matches(entry bson.M) bool {
+	for path, expected := range filter {
+		actual, ok := lookupDottedPath(entry, path)
+		if !ok || !filterValuesEqual(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupDottedPath finds the value at a path like "o.drop" in a document
+func lookupDottedPath(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, field := range strings.Split(path, ".") {
+		subdoc, ok := current.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = subdoc[field]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// filterValuesEqual compares values, treating all numeric types as equal
+// when they hold the same number, since JSON only has doubles.
+func filterValuesEqual(actual, expected interface{}) bool {
+	actualNumber, actualIsNumber := filterNumber(actual)
+	expectedNumber, expectedIsNumber := filterNumber(expected)
+	if actualIsNumber && expectedIsNumber {
+		return actualNumber == expectedNumber
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+func filterNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// oplogApplier replays oplog entries against the target server.
+// Implementations may buffer entries, so Flush must be called
+// after the last entry is applied.
+type oplogApplier interface {
+	Apply(entry Oplog, size int) error
+	Flush() error
+}
+
+// applyOpsApplier buffers oplog entries until they reach the max
+// command size and then applies them with a single applyOps command.
+type applyOpsApplier struct {
+	restore       *MongoRestore
+	session       *mgo.Session
+	entries       []interface{}
+	bufferedBytes int
+}
+
+func (applier *applyOpsApplier) Apply(entry Oplog, size int) error {
+	if applier.bufferedBytes+size > OplogMaxCommandSize {
+		if err := applier.Flush(); err != nil {
+			return err
+		}
+	}
+	applier.bufferedBytes += size
+	applier.entries = append(applier.entries, entry)
+	return nil
+}
+
+func (applier *applyOpsApplier) Flush() error {
+	if len(applier.entries) == 0 {
+		return nil
+	}
+	err := applier.restore.ApplyOps(applier.session, applier.entries)
+	if err != nil {
+		return err
+	}
+	applier.entries = make([]interface{}, 0, 1024)
+	applier.bufferedBytes = 0
+	return nil
+}
+
 // ApplyOps is a wrapper for the applyOps database command, we pass in
 // a session to avoid opening a new connection for a few inserts at a time
 func (restore *MongoRestore) ApplyOps(session *mgo.Session, entries []interface{}) error {
@@ -150,11 +377,235 @@ func (restore *MongoRestore) TimestampBeforeLimit(ts bson.MongoTimestamp) bool {
 	return ts < restore.oplogLimit
 }
 
-// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
+// TimestampAfterStart returns whether the given timestamp is at or after
+// the --oplogStart bound, and is therefore allowed to be applied.
+func (restore *MongoRestore) TimestampAfterStart(ts bson.MongoTimestamp) bool {
+	// oplogStart is zero when --oplogStart is not set, so everything passes
+	return ts >= restore.oplogStart
+}
+
+// OplogNamespaceIncluded returns whether the given oplog entry passes the
+// --oplogNsInclude and --oplogNsExclude filters.
+func (restore *MongoRestore) OplogNamespaceIncluded(entry Oplog) bool {
+	if restore.InputOptions == nil {
+		return true
+	}
+	ns := OplogEntryNamespace(entry)
+	if len(restore.InputOptions.OplogNsInclude) > 0 &&
+		!matchesAnyNamespace(restore.InputOptions.OplogNsInclude, ns) {
+		return false
+	}
+	return !matchesAnyNamespace(restore.InputOptions.OplogNsExclude, ns)
+}
+
+// OplogEntryNamespace returns the namespace that an oplog entry acts on.
+// Commands are logged against "<db>.$cmd", so for commands that target
+// a single collection (e.g. create or drop) the named collection is used.
+func OplogEntryNamespace(entry Oplog) string {
+	if entry.Operation != "c" || len(entry.Object) == 0 {
+		return entry.Namespace
+	}
+	target, ok := entry.Object[0].Value.(string)
+	if !ok {
+		// database-wide commands like dropDatabase
+		return entry.Namespace
+	}
+	if entry.Object[0].Name == "renameCollection" {
+		// renameCollection already holds a full namespace
+		return target
+	}
+	dbName := entry.Namespace
+	if i := strings.Index(dbName, "."); i >= 0 {
+		dbName = dbName[:i]
+	}
+	return dbName + "." + target
+}
+
+// matchesAnyNamespace returns true if the namespace matches
+// at least one of the given patterns.
+func matchesAnyNamespace(patterns []string, ns string) bool {
+	for _, pattern := range patterns {
+		// patterns are validated when the options are parsed
+		if match, _ := util.MatchNamespace(pattern, ns); match {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTimestampFlag takes in a string describing a point in the oplog
+// and returns it as a bson.MongoTimestamp. The accepted forms are
+//
+//	<time_t>[:<ordinal>]   seconds since the UNIX epoch and an optional counter
+//	                       of operations that occurred in that second
+//	2015-03-01T14:05:00Z   an ISO-8601 datetime, which must include a timezone
+//	90m ago                a duration before the current time
+//	14:05 UTC today        a time of day in the given timezone, today or yesterday
+//
+// Any form may be prefixed with "before", which reads naturally for --oplogLimit.
+func ParseTimestampFlag(ts string) (bson.MongoTimestamp, error) {
+	return parseTimestampFlagAt(ts, time.Now())
+}
+
+// parseTimestampFlagAt implements ParseTimestampFlag, resolving
+// relative times against the given current time.
+func parseTimestampFlagAt(ts string, now time.Time) (bson.MongoTimestamp, error) {
+	trimmed := strings.TrimSpace(ts)
+	if fields := strings.Fields(trimmed); len(fields) > 1 && strings.EqualFold(fields[0], "before") {
+		trimmed = strings.Join(fields[1:], " ")
+	}
+
+	// anything made of only digits and colons has to be <time_t>:<ordinal>,
+	// unless it looks like a time of day, which is more likely what was meant
+	if strings.Trim(trimmed, "0123456789:") == "" {
+		if looksLikeTimeOfDay(trimmed) {
+			return 0, fmt.Errorf("'%v' looks like a time of day rather than <seconds>:<ordinal>; "+
+				"include a timezone, e.g. '%v UTC today', or give the seconds since the UNIX epoch", ts, trimmed)
+		}
+		return parseOrdinalTimestamp(trimmed)
+	}
+
+	for _, layout := range acceptedOplogTimeFormats {
+		if t, err := time.Parse(layout, trimmed); err == nil {
+			return timeToTimestamp(t), nil
+		}
+	}
+
+	fields := strings.Fields(trimmed)
+	if len(fields) == 2 && strings.EqualFold(fields[1], "ago") {
+		duration, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return 0, fmt.Errorf("error parsing duration '%v': %v", fields[0], err)
+		}
+		if duration < 0 {
+			return 0, fmt.Errorf("duration '%v' must be positive", fields[0])
+		}
+		return timeToTimestamp(now.Add(-duration)), nil
+	}
+
+	if strings.Contains(trimmed, ":") {
+		t, err := parseTimeOfDay(fields, now)
+		if err != nil {
+			return 0, err
+		}
+		return timeToTimestamp(t), nil
+	}
+
+	return 0, fmt.Errorf("unrecognized timestamp '%v'; use <seconds>[:<ordinal>], "+
+		"an ISO-8601 datetime with a timezone, '<duration> ago', or '<HH:MM> <timezone> today'", ts)
+}
+
+// ISO-8601 layouts accepted by ParseTimestampFlag; all of them require a timezone
+var acceptedOplogTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04Z0700",
+	"2006-01-02 15:04:05Z07:00",
+}
+
+// looksLikeTimeOfDay returns true for values of the form HH:MM, such as
+// "14:05", which as <seconds>:<ordinal> would be seconds after the UNIX
+// epoch, long before any oplog entry
+func looksLikeTimeOfDay(ts string) bool {
+	fields := strings.Split(ts, ":")
+	if len(fields) != 2 || len(fields[0]) == 0 || len(fields[0]) > 2 || len(fields[1]) != 2 {
+		return false
+	}
+	hours, _ := strconv.Atoi(fields[0])
+	minutes, _ := strconv.Atoi(fields[1])
+	return hours < 24 && minutes < 60
+}
+
+// parseTimeOfDay handles times of the form "14:05[:30] <timezone> [today|yesterday]",
+// where the day may also come first. The timezone is required so that there is no
+// ambiguity about which local time the user meant.
+func parseTimeOfDay(fields []string, now time.Time) (time.Time, error) {
+	var clock, zone string
+	daysBack := 0
+	for _, field := range fields {
+		switch {
+		case strings.EqualFold(field, "today"):
+			daysBack = 0
+		case strings.EqualFold(field, "yesterday"):
+			daysBack = 1
+		case clock == "" && strings.Contains(field, ":") &&
+			strings.Trim(field, "0123456789:") == "":
+			clock = field
+		case zone == "":
+			zone = field
+		default:
+			return time.Time{}, fmt.Errorf("unexpected '%v' in time of day", field)
+		}
+	}
+	if clock == "" {
+		return time.Time{}, fmt.Errorf("no time of day found in '%v'", strings.Join(fields, " "))
+	}
+	if zone == "" {
+		return time.Time{}, fmt.Errorf(
+			"time of day '%v' must include a timezone, e.g. '%v UTC today'", clock, clock)
+	}
+	location, err := parseTimezone(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var parsed time.Time
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if parsed, err = time.Parse(layout, clock); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing time of day '%v': %v", clock, err)
+	}
+
+	day := now.In(location).AddDate(0, 0, -daysBack)
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		parsed.Hour(), parsed.Minute(), parsed.Second(), 0, location), nil
+}
+
+// parseTimezone accepts UTC, a numeric offset like +05:30, or an IANA zone name
+func parseTimezone(zone string) (*time.Location, error) {
+	switch strings.ToUpper(zone) {
+	case "UTC", "GMT", "Z":
+		return time.UTC, nil
+	}
+	if zone[0] == '+' || zone[0] == '-' {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, zone); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(zone, offset), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timezone offset '%v'", zone)
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone '%v': %v", zone, err)
+	}
+	return location, nil
+}
+
+// timeToTimestamp converts a time to the first oplog timestamp of its second
+func timeToTimestamp(t time.Time) bson.MongoTimestamp {
+	return bson.MongoTimestamp(t.Unix() << 32)
+}
+
+// FormatTimestamp renders an oplog timestamp as <time_t>:<ordinal>
+// along with the UTC datetime it represents.
+func FormatTimestamp(ts bson.MongoTimestamp) string {
+	seconds := int64(ts) >> 32
+	increment := int64(ts) & 0xFFFFFFFF
+	return fmt.Sprintf("%v:%v (%v)", seconds, increment,
+		time.Unix(seconds, 0).UTC().Format(time.RFC3339))
+}
+
+// parseOrdinalTimestamp takes in a string the form of <time_t>:<ordinal>,
 // where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
 // a counter of operations in the oplog that occurred in the specified second.
 // It parses this timestamp string and returns a bson.MongoTimestamp type.
-func ParseTimestampFlag(ts string) (bson.MongoTimestamp, error) {
+func parseOrdinalTimestamp(ts string) (bson.MongoTimestamp, error) {
 	var seconds, increment int
 	timestampFields := strings.Split(ts, ":")
 	if len(timestampFields) > 2 {
@@ -0,0 +1,227 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// crudOplogApplier replays oplog entries as regular inserts, updates, removes
+// and commands instead of through applyOps, which is not available through
+// mongos and is restricted for many roles. Consecutive inserts into the same
+// namespace are buffered and sent as a single bulk insert.
+//
+// Like applyOps, replay is idempotent: writes whose effects are already present
+// on the server (duplicate inserts, drops of missing collections, etc.) are
+// not treated as errors, since an oplog usually overlaps with the restored data.
+type crudOplogApplier struct {
+	session        *mgo.Session
+	bulkBufferSize int
+
+	// the documents of the current run of inserts and the namespace they go to
+	inserts     []interface{}
+	insertBytes int
+	insertNS    string
+}
+
+func newCRUDOplogApplier(session *mgo.Session, bulkBufferSize int) *crudOplogApplier {
+	return &crudOplogApplier{
+		session:        session,
+		bulkBufferSize: bulkBufferSize,
+	}
+}
+
+// Apply buffers inserts and applies all other entries immediately,
+// after flushing any inserts that came before them.
+func (applier *crudOplogApplier) Apply(entry Oplog, size int) error {
+	dbName, collectionName := splitOplogNamespace(entry.Namespace)
+	if entry.Operation == "i" && collectionName != "system.indexes" {
+		return applier.bufferInsert(entry, size)
+	}
+
+	// everything else has to happen after the inserts that preceded it
+	if err := applier.Flush(); err != nil {
+		return err
+	}
+
+	var err error
+	switch entry.Operation {
+	case "i":
+		// a legacy index build, which was logged as an insert into system.indexes
+		err = applier.createIndex(entry, dbName)
+	case "u":
+		err = applier.update(entry, dbName, collectionName)
+	case "d":
+		_, err = applier.session.DB(dbName).C(collectionName).RemoveAll(entry.Object)
+	case "c":
+		err = applier.runCommand(entry, dbName)
+	default:
+		return fmt.Errorf("unknown oplog operation '%v' at %v",
+			entry.Operation, FormatTimestamp(entry.Timestamp))
+	}
+	if err != nil {
+		if isIdempotentReplayError(err) {
+			log.Logf(log.DebugLow, "ignoring error replaying %v: %v", DescribeOplogEntry(entry), err)
+			return nil
+		}
+		return fmt.Errorf("error replaying %v: %v", DescribeOplogEntry(entry), err)
+	}
+	return nil
+}
+
+// Flush writes any buffered inserts, as an unordered bulk insert so that
+// documents already present don't stop the rest of the batch. The error of a
+// bulk insert only describes one of the writes that failed, so when it fails
+// the documents are inserted again one at a time to tell the duplicates from
+// any real failure.
+func (applier *crudOplogApplier) Flush() error {
+	if len(applier.inserts) == 0 {
+		return nil
+	}
+	inserts, insertNS := applier.inserts, applier.insertNS
+	applier.inserts, applier.insertBytes, applier.insertNS = nil, 0, ""
+
+	dbName, collectionName := splitOplogNamespace(insertNS)
+	collection := applier.session.DB(dbName).C(collectionName)
+	bulk := collection.Bulk()
+	bulk.Unordered()
+	bulk.Insert(inserts...)
+	if _, err := bulk.Run(); err == nil {
+		return nil
+	}
+	for _, document := range inserts {
+		if err := collection.Insert(document); err != nil && !isIdempotentReplayError(err) {
+			return fmt.Errorf("error inserting into %v: %v", insertNS, err)
+		}
+	}
+	return nil
+}
+
+func (applier *crudOplogApplier) bufferInsert(entry Oplog, size int) error {
+	if len(applier.inserts) > 0 && (applier.insertNS != entry.Namespace ||
+		len(applier.inserts) >= applier.bulkBufferSize ||
+		applier.insertBytes+size > db.MaxMessageSize) {
+		if err := applier.Flush(); err != nil {
+			return err
+		}
+	}
+	applier.inserts = append(applier.inserts, entry.Object)
+	applier.insertBytes += size
+	applier.insertNS = entry.Namespace
+	return nil
+}
+
+// update applies an update entry. Replacement-style updates are emulated as
+// upserts by inserting the document when no match exists, since mongos
+// cannot route a true upsert that does not contain the shard key.
+func (applier *crudOplogApplier) update(entry Oplog, dbName, collectionName string) error {
+	collection := applier.session.DB(dbName).C(collectionName)
+	err := collection.Update(entry.Query, entry.Object)
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	if !isReplacementUpdate(entry.Object) {
+		log.Logf(log.DebugLow, "no document matched %v", DescribeOplogEntry(entry))
+		return nil
+	}
+	replacement := entry.Object
+	if _, err := bsonutil.FindValueByKey("_id", &replacement); err != nil {
+		replacement = append(bson.D{{"_id", entry.Query["_id"]}}, replacement...)
+	}
+	return collection.Insert(replacement)
+}
+
+// createIndex turns a legacy insert into system.indexes into a createIndexes command
+func (applier *crudOplogApplier) createIndex(entry Oplog, dbName string) error {
+	index := bson.D{}
+	collectionName := ""
+	for _, elem := range entry.Object {
+		if elem.Name == "ns" {
+			if ns, ok := elem.Value.(string); ok {
+				_, collectionName = splitOplogNamespace(ns)
+			}
+			continue
+		}
+		index = append(index, elem)
+	}
+	if collectionName == "" {
+		return fmt.Errorf("index entry has no target namespace")
+	}
+	return runOplogCommand(applier.session, dbName,
+		bson.D{{"createIndexes", collectionName}, {"indexes", []bson.D{index}}})
+}
+
+func (applier *crudOplogApplier) runCommand(entry Oplog, dbName string) error {
+	if len(entry.Object) > 0 && entry.Object[0].Name == "applyOps" {
+		return fmt.Errorf("nested applyOps entries cannot be replayed without applyOps")
+	}
+	return runOplogCommand(applier.session, dbName, entry.Object)
+}
+
+func runOplogCommand(session *mgo.Session, dbName string, command bson.D) error {
+	res := bson.M{}
+	err := session.DB(dbName).Run(command, &res)
+	if err != nil {
+		return err
+	}
+	if util.IsFalsy(res["ok"]) {
+		// keep the code, so that the error can be classified
+		code, _ := util.ToInt(res["code"])
+		return &mgo.QueryError{Code: code, Message: fmt.Sprintf("%v", res["errmsg"])}
+	}
+	return nil
+}
+
+// splitOplogNamespace splits an oplog namespace into its database and collection
+func splitOplogNamespace(ns string) (string, string) {
+	i := strings.Index(ns, ".")
+	if i < 0 {
+		return ns, ""
+	}
+	return ns[:i], ns[i+1:]
+}
+
+// isReplacementUpdate returns true if the update object is a full document
+// rather than a set of update operators like $set.
+func isReplacementUpdate(update bson.D) bool {
+	return len(update) == 0 || !strings.HasPrefix(update[0].Name, "$")
+}
+
+// server error codes for writes whose effect is already present
+const (
+	errCodeNamespaceNotFound = 26
+	errCodeNamespaceExists   = 48
+)
+
+// isIdempotentReplayError returns true for the error of a single write or
+// command meaning that the effect of an oplog entry is already present on the
+// server: a duplicate key, a missing namespace or a namespace that already
+// exists. Errors from servers too old to send a code are matched on their
+// whole message.
+func isIdempotentReplayError(err error) bool {
+	if mgo.IsDup(err) {
+		return true
+	}
+	var code int
+	var msg string
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		code, msg = e.Code, e.Message
+	case *mgo.LastError:
+		code, msg = e.Code, e.Err
+	default:
+		return false
+	}
+	switch code {
+	case errCodeNamespaceNotFound, errCodeNamespaceExists:
+		return true
+	case 0:
+		return msg == db.ErrNsNotFound.Error() || msg == "collection already exists"
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCRUDOplogReplayHelpers(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("When splitting oplog namespaces", t, func() {
+		Convey("the database and collection should be separated at the first dot", func() {
+			dbName, collection := splitOplogNamespace("shop.system.indexes")
+			So(dbName, ShouldEqual, "shop")
+			So(collection, ShouldEqual, "system.indexes")
+		})
+
+		Convey("a namespace with no collection should return only the database", func() {
+			dbName, collection := splitOplogNamespace("shop")
+			So(dbName, ShouldEqual, "shop")
+			So(collection, ShouldEqual, "")
+		})
+	})
+
+	Convey("When classifying update entries", t, func() {
+		Convey("full documents should be replacements", func() {
+			So(isReplacementUpdate(bson.D{{"_id", 1}, {"qty", 2}}), ShouldBeTrue)
+		})
+
+		Convey("operator documents should not be replacements", func() {
+			So(isReplacementUpdate(bson.D{{"$set", bson.D{{"qty", 2}}}}), ShouldBeFalse)
+		})
+	})
+
+	Convey("When checking replay errors", t, func() {
+		Convey("duplicate keys and missing or existing namespaces should be ignorable", func() {
+			So(isIdempotentReplayError(&mgo.LastError{Code: 11000,
+				Err: "E11000 duplicate key error index: shop.orders.$_id_ dup key: { : 1 }"}), ShouldBeTrue)
+			So(isIdempotentReplayError(&mgo.QueryError{Code: 26, Message: "ns does not exist"}), ShouldBeTrue)
+			So(isIdempotentReplayError(&mgo.QueryError{Code: 48, Message: "collection already exists"}), ShouldBeTrue)
+		})
+
+		Convey("errors without a code should only be ignorable for their exact messages", func() {
+			So(isIdempotentReplayError(&mgo.QueryError{Message: "ns not found"}), ShouldBeTrue)
+			So(isIdempotentReplayError(&mgo.QueryError{Message: "collection already exists"}), ShouldBeTrue)
+			So(isIdempotentReplayError(&mgo.QueryError{Message: "ns not found; not authorized on shop"}), ShouldBeFalse)
+		})
+
+		Convey("other errors should not be ignorable, even if they mention a duplicate key", func() {
+			So(isIdempotentReplayError(&mgo.QueryError{Code: 13, Message: "not authorized on shop"}), ShouldBeFalse)
+			So(isIdempotentReplayError(&mgo.LastError{Code: 2,
+				Err: "E11000 duplicate key error index: shop.orders.$_id_; Document can't have $ prefixed field names"}),
+				ShouldBeFalse)
+			So(isIdempotentReplayError(fmt.Errorf("E11000 duplicate key error; ns not found")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCRUDOplogInsertBuffering(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a CRUD oplog applier", t, func() {
+		applier := newCRUDOplogApplier(nil, 3)
+
+		Convey("consecutive inserts into a namespace should be buffered together", func() {
+			for i := 0; i < 3; i++ {
+				So(applier.Apply(Oplog{Operation: "i", Namespace: "shop.orders",
+					Object: bson.D{{"_id", i}}}, 10), ShouldBeNil)
+			}
+			So(len(applier.inserts), ShouldEqual, 3)
+			So(applier.insertBytes, ShouldEqual, 30)
+			So(applier.insertNS, ShouldEqual, "shop.orders")
+		})
+	})
+}
+
+func TestCRUDOplogApplier(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.INTEGRATION_TEST_TYPE)
+
+	Convey("With a CRUD oplog applier connected to a server", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		sessionProvider, err := db.NewSessionProvider(commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: "27017",
+			},
+			Auth: &auth,
+			SSL:  &ssl,
+		})
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		collection := session.DB("restore_crud_oplog").C("orders")
+		collection.DropCollection()
+		So(collection.Insert(bson.D{{"_id", 1}}), ShouldBeNil)
+		applier := newCRUDOplogApplier(session, 100)
+		insert := func(document bson.D) Oplog {
+			return Oplog{Operation: "i", Namespace: "restore_crud_oplog.orders", Object: document}
+		}
+
+		Convey("inserts of documents already present should be ignored", func() {
+			So(applier.Apply(insert(bson.D{{"_id", 1}}), 0), ShouldBeNil)
+			So(applier.Apply(insert(bson.D{{"_id", 2}}), 0), ShouldBeNil)
+			So(applier.Flush(), ShouldBeNil)
+			count, err := collection.Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+		Convey("a failed insert should be reported, even in a batch with a duplicate", func() {
+			So(applier.Apply(insert(bson.D{{"_id", 1}}), 0), ShouldBeNil)
+			So(applier.Apply(insert(bson.D{{"_id", 3}, {"$bad", 1}}), 0), ShouldBeNil)
+			So(applier.Flush(), ShouldNotBeNil)
+		})
+		Convey("dropping a missing collection should be ignored", func() {
+			So(applier.Apply(Oplog{Operation: "c", Namespace: "restore_crud_oplog.$cmd",
+				Object: bson.D{{"drop", "missing"}}}, 0), ShouldBeNil)
+		})
+	})
+}
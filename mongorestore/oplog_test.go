@@ -4,7 +4,11 @@ import (
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestTimestampStringParsing(t *testing.T) {
@@ -113,3 +117,334 @@ func TestValidOplogLimitChecking(t *testing.T) {
 	})
 
 }
+
+func TestValidOplogStartChecking(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a MongoRestore instance with oplogStart of 5:0", t, func() {
+		mr := &MongoRestore{
+			oplogStart: bson.MongoTimestamp(int64(5) << 32),
+		}
+
+		Convey("an oplog entry with ts=4:9 should be skipped", func() {
+			So(mr.TimestampAfterStart(bson.MongoTimestamp(int64(4)<<32|9)), ShouldBeFalse)
+		})
+
+		Convey("an oplog entry with ts=5:0 should be applied", func() {
+			So(mr.TimestampAfterStart(bson.MongoTimestamp(int64(5)<<32)), ShouldBeTrue)
+		})
+
+		Convey("an oplog entry with ts=1000:0 should be applied", func() {
+			So(mr.TimestampAfterStart(bson.MongoTimestamp(int64(1000)<<32)), ShouldBeTrue)
+		})
+	})
+
+	Convey("With a MongoRestore instance with no oplogStart", t, func() {
+		mr := &MongoRestore{}
+
+		Convey("an oplog entry with ts=0:1 should be applied", func() {
+			So(mr.TimestampAfterStart(bson.MongoTimestamp(1)), ShouldBeTrue)
+		})
+	})
+}
+
+func TestOplogNamespaceFiltering(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	insert := Oplog{Operation: "i", Namespace: "shop.orders"}
+	otherInsert := Oplog{Operation: "i", Namespace: "shop.carts"}
+	drop := Oplog{
+		Operation: "c",
+		Namespace: "shop.$cmd",
+		Object:    bson.D{{"drop", "orders"}},
+	}
+	dropDatabase := Oplog{
+		Operation: "c",
+		Namespace: "shop.$cmd",
+		Object:    bson.D{{"dropDatabase", 1}},
+	}
+
+	Convey("When computing the namespace of oplog entries", t, func() {
+
+		Convey("CRUD entries should use their own namespace", func() {
+			So(OplogEntryNamespace(insert), ShouldEqual, "shop.orders")
+		})
+
+		Convey("collection commands should use the target collection", func() {
+			So(OplogEntryNamespace(drop), ShouldEqual, "shop.orders")
+		})
+
+		Convey("renameCollection should use the source namespace", func() {
+			rename := Oplog{
+				Operation: "c",
+				Namespace: "admin.$cmd",
+				Object:    bson.D{{"renameCollection", "shop.orders"}, {"to", "shop.old"}},
+			}
+			So(OplogEntryNamespace(rename), ShouldEqual, "shop.orders")
+		})
+
+		Convey("database commands should keep the $cmd namespace", func() {
+			So(OplogEntryNamespace(dropDatabase), ShouldEqual, "shop.$cmd")
+		})
+	})
+
+	Convey("With a MongoRestore instance including shop.orders", t, func() {
+		mr := &MongoRestore{
+			InputOptions: &InputOptions{OplogNsInclude: []string{"shop.orders"}},
+		}
+
+		Convey("entries for shop.orders should be applied", func() {
+			So(mr.OplogNamespaceIncluded(insert), ShouldBeTrue)
+			So(mr.OplogNamespaceIncluded(drop), ShouldBeTrue)
+		})
+
+		Convey("entries for other namespaces should be skipped", func() {
+			So(mr.OplogNamespaceIncluded(otherInsert), ShouldBeFalse)
+			So(mr.OplogNamespaceIncluded(dropDatabase), ShouldBeFalse)
+		})
+	})
+
+	Convey("With a MongoRestore instance including shop.* but excluding shop.orders", t, func() {
+		mr := &MongoRestore{
+			InputOptions: &InputOptions{
+				OplogNsInclude: []string{"shop.*"},
+				OplogNsExclude: []string{"shop.orders"},
+			},
+		}
+
+		Convey("entries for shop.orders should be skipped", func() {
+			So(mr.OplogNamespaceIncluded(insert), ShouldBeFalse)
+			So(mr.OplogNamespaceIncluded(drop), ShouldBeFalse)
+		})
+
+		Convey("entries for the rest of shop should be applied", func() {
+			So(mr.OplogNamespaceIncluded(otherInsert), ShouldBeTrue)
+			So(mr.OplogNamespaceIncluded(dropDatabase), ShouldBeTrue)
+		})
+	})
+
+	Convey("With a MongoRestore instance with no namespace filters", t, func() {
+		mr := &MongoRestore{InputOptions: &InputOptions{}}
+
+		Convey("all entries should be applied", func() {
+			So(mr.OplogNamespaceIncluded(insert), ShouldBeTrue)
+			So(mr.OplogNamespaceIncluded(dropDatabase), ShouldBeTrue)
+		})
+	})
+}
+
+func TestHumanFriendlyTimestampParsing(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	// 2015-03-01T16:30:00Z
+	now := time.Date(2015, 3, 1, 16, 30, 0, 0, time.UTC)
+	secondsOf := func(t time.Time) bson.MongoTimestamp {
+		return bson.MongoTimestamp(t.Unix() << 32)
+	}
+
+	Convey("Testing human-friendly timestamp strings:", t, func() {
+		Convey("2015-03-01T14:05:00Z [should pass]", func() {
+			ts, err := parseTimestampFlagAt("2015-03-01T14:05:00Z", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, secondsOf(time.Date(2015, 3, 1, 14, 5, 0, 0, time.UTC)))
+		})
+
+		Convey("2015-03-01T09:05:00-05:00 [should pass]", func() {
+			ts, err := parseTimestampFlagAt("2015-03-01T09:05:00-05:00", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, secondsOf(time.Date(2015, 3, 1, 14, 5, 0, 0, time.UTC)))
+		})
+
+		Convey("2015-03-01T14:05:00 [should fail without a timezone]", func() {
+			_, err := parseTimestampFlagAt("2015-03-01T14:05:00", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("90m ago [should pass]", func() {
+			ts, err := parseTimestampFlagAt("90m ago", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, secondsOf(time.Date(2015, 3, 1, 15, 0, 0, 0, time.UTC)))
+		})
+
+		Convey("-90m ago [should fail]", func() {
+			_, err := parseTimestampFlagAt("-90m ago", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("before 14:05 UTC today [should pass]", func() {
+			ts, err := parseTimestampFlagAt("before 14:05 UTC today", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, secondsOf(time.Date(2015, 3, 1, 14, 5, 0, 0, time.UTC)))
+		})
+
+		Convey("yesterday 23:59:30 +01:00 [should pass]", func() {
+			ts, err := parseTimestampFlagAt("yesterday 23:59:30 +01:00", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, secondsOf(time.Date(2015, 2, 28, 22, 59, 30, 0, time.UTC)))
+		})
+
+		Convey("14:05 today [should fail without a timezone]", func() {
+			_, err := parseTimestampFlagAt("14:05 today", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("14:05 Mars/Olympus today [should fail]", func() {
+			_, err := parseTimestampFlagAt("14:05 Mars/Olympus today", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("14:05 [should fail as a time of day]", func() {
+			_, err := parseTimestampFlagAt("14:05", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("before 9:30 [should fail as a time of day]", func() {
+			_, err := parseTimestampFlagAt("before 9:30", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("before 123:456 [should pass]", func() {
+			ts, err := parseTimestampFlagAt("before 123:456", now)
+			So(err, ShouldBeNil)
+			So(ts, ShouldEqual, (int64(123)<<32 | int64(456)))
+		})
+	})
+
+	Convey("Formatting a timestamp should show both forms", t, func() {
+		ts := bson.MongoTimestamp(int64(1425218700)<<32 | 3)
+		So(FormatTimestamp(ts), ShouldEqual, "1425218700:3 (2015-03-01T14:05:00Z)")
+	})
+}
+
+func TestOplogFilterMatching(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	dropOrders := bson.M{
+		"ts": bson.MongoTimestamp(int64(10) << 32),
+		"op": "c",
+		"ns": "shop.$cmd",
+		"o":  bson.M{"drop": "orders"},
+	}
+	insertOrder := bson.M{
+		"ts": bson.MongoTimestamp(int64(9) << 32),
+		"op": "i",
+		"ns": "shop.orders",
+		"o":  bson.M{"_id": 1, "qty": int32(3)},
+	}
+
+	Convey("With a filter matching the drop of shop.orders", t, func() {
+		filter, err := ParseOplogFilter(`{"op": "c", "ns": "shop.$cmd", "o.drop": "orders"}`)
+		So(err, ShouldBeNil)
+
+		Convey("the drop entry should match", func() {
+			So(filter.Matches(dropOrders), ShouldBeTrue)
+		})
+
+		Convey("other entries should not match", func() {
+			So(filter.Matches(insertOrder), ShouldBeFalse)
+		})
+	})
+
+	Convey("With a filter on a numeric field", t, func() {
+		filter, err := ParseOplogFilter(`{"o.qty": 3}`)
+		So(err, ShouldBeNil)
+
+		Convey("values of any numeric type should match", func() {
+			So(filter.Matches(insertOrder), ShouldBeTrue)
+		})
+	})
+
+	Convey("Invalid filters should be rejected", t, func() {
+		_, err := ParseOplogFilter(`{"op": `)
+		So(err, ShouldNotBeNil)
+		_, err = ParseOplogFilter(`{}`)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Oplog entries should be described by operation and namespace", t, func() {
+		entry := Oplog{
+			Timestamp: bson.MongoTimestamp(int64(1425218700) << 32),
+			Operation: "c",
+			Namespace: "shop.$cmd",
+			Object:    bson.D{{"drop", "orders"}},
+		}
+		So(DescribeOplogEntry(entry), ShouldEqual,
+			"1425218700:0 (2015-03-01T14:05:00Z) drop on shop.orders")
+	})
+}
+
+func TestResolveOplogLimitFilters(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	tempDir, err := ioutil.TempDir("", "oplog-limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the same drop of shop.orders is logged twice: once before --oplogStart
+	// and once in another namespace, and only the last one will be replayed
+	entries := []Oplog{
+		{Timestamp: bson.MongoTimestamp(int64(5) << 32), Operation: "c", Namespace: "shop.$cmd",
+			Object: bson.D{{"drop", "orders"}}},
+		{Timestamp: bson.MongoTimestamp(int64(10) << 32), Operation: "c", Namespace: "test.$cmd",
+			Object: bson.D{{"drop", "orders"}}},
+		{Timestamp: bson.MongoTimestamp(int64(15) << 32), Operation: "c", Namespace: "shop.$cmd",
+			Object: bson.D{{"drop", "orders"}}},
+	}
+	oplogPath := filepath.Join(tempDir, "oplog.bson")
+	var data []byte
+	for _, entry := range entries {
+		raw, err := bson.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, raw...)
+	}
+	if err = ioutil.WriteFile(oplogPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With --oplogStart and --oplogNsInclude set", t, func() {
+		filter, err := ParseOplogFilter(`{"op": "c", "o.drop": "orders"}`)
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{
+			InputOptions:     &InputOptions{OplogNsInclude: []string{"shop.*"}},
+			oplogStart:       bson.MongoTimestamp(int64(8) << 32),
+			oplogLimitFilter: filter,
+		}
+
+		Convey("--oplogLimitMatch should only match entries that would be replayed", func() {
+			So(restore.ResolveOplogLimit(oplogPath), ShouldBeNil)
+			So(restore.oplogLimit, ShouldEqual, bson.MongoTimestamp(int64(15)<<32))
+		})
+	})
+}
+
+func TestOnlyReplayingOplogFile(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With an --oplogFile", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{OplogFile: "oplog.bson"}}
+
+		Convey("only the oplog file should be replayed without a dump directory", func() {
+			So(restore.onlyReplayingOplogFile(), ShouldBeTrue)
+		})
+
+		Convey("a named dump directory should be restored even if it doesn't exist", func() {
+			restore.TargetDirectory = "testdata/no-such-dump"
+			So(restore.onlyReplayingOplogFile(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Without an --oplogFile, the dump directory should always be restored", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{}}
+		So(restore.onlyReplayingOplogFile(), ShouldBeFalse)
+	})
+}
@@ -1,11 +1,18 @@
 package mongorestore
 
 type InputOptions struct {
-	Objcheck               bool   `long:"objcheck" description:"Validate object before inserting"`
-	OplogReplay            bool   `long:"oplogReplay" description:"Replay oplog for point-in-time restore"`
-	OplogLimit             string `long:"oplogLimit" description:"Include oplog entries before the provided Timestamp (seconds[:ordinal])"`
-	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"Restore user and role definitions for the given database"`
-	Directory              string `long:"dir" description:"alternative flag for entering the dump directory"`
+	Objcheck               bool     `long:"objcheck" description:"Validate object before inserting"`
+	OplogReplay            bool     `long:"oplogReplay" description:"Replay oplog for point-in-time restore"`
+	OplogLimit             string   `long:"oplogLimit" description:"Include oplog entries before the provided Timestamp (seconds[:ordinal], ISO-8601 datetime, '<duration> ago', or '<HH:MM> <timezone> today')"`
+	OplogLimitMatch        string   `long:"oplogLimitMatch" description:"Include oplog entries before the first entry matching the given JSON filter, e.g. '{\"op\": \"c\", \"o.drop\": \"orders\"}'"`
+	OplogStart             string   `long:"oplogStart" description:"Skip oplog entries before the provided Timestamp (seconds[:ordinal], ISO-8601 datetime, '<duration> ago', or '<HH:MM> <timezone> today')"`
+	OplogNsInclude         []string `long:"oplogNsInclude" description:"Only replay oplog entries for namespaces matching the given pattern, e.g. 'test.*' (may be repeated)"`
+	OplogNsExclude         []string `long:"oplogNsExclude" description:"Skip oplog entries for namespaces matching the given pattern, e.g. 'test.*' (may be repeated)"`
+	OplogFile              string   `long:"oplogFile" description:"Replay the oplog from the given BSON file instead of <dump>/oplog.bson; with no dump directory given, only this file is replayed"`
+	OplogApplyMode         string   `long:"oplogApplyMode" description:"How to replay the oplog: 'applyOps', or 'crud' to use regular writes and commands (defaults to 'crud' against mongos and 'applyOps' otherwise)"`
+	RestoreDBUsersAndRoles bool     `long:"restoreDbUsersAndRoles" description:"Restore user and role definitions for the given database"`
+	Directory              string   `long:"dir" description:"alternative flag for entering the dump directory"`
+	InputFormat            string   `long:"inputFormat" description:"Format of the collection files to restore: 'bson', or 'json' for a directory of <db>/<collection>.json or .json.gz files of extended JSON documents, as written by mongoexport" default:"bson"`
 }
 
 func (self *InputOptions) Name() string {
@@ -13,14 +20,29 @@ func (self *InputOptions) Name() string {
 }
 
 type OutputOptions struct {
-	Drop                   bool   `long:"drop" description:"Drop each collection before import"`
-	WriteConcern           string `long:"writeConcern" default:"majority" description:"Write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
-	NoIndexRestore         bool   `long:"noIndexRestore" description:"Don't restore indexes"`
-	NoOptionsRestore       bool   `long:"noOptionsRestore" description:"Don't restore options"`
-	KeepIndexVersion       bool   `long:"keepIndexVersion" description:"Don't update index version"`
-	MaintainInsertionOrder bool   `long:"maintainInsertionOrder" description:"Preserve order of documents during restoration"`
-	NumParallelCollections int    `long:"numParallelCollections" short:"j" description:"Number of collections to restore in parallel" default:"4"`
-	StopOnError            bool   `long:"stopOnError" description:"Stop restoring if an error is encountered on insert (off by default)" default:"false"`
+	Drop                       bool     `long:"drop" description:"Drop each collection before import"`
+	WriteConcern               string   `long:"writeConcern" default:"majority" description:"Write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
+	NoIndexRestore             bool     `long:"noIndexRestore" description:"Don't restore indexes"`
+	NoOptionsRestore           bool     `long:"noOptionsRestore" description:"Don't restore options"`
+	MetadataOverrides          string   `long:"metadataOverrides" description:"Edit collection options and indexes of matching namespaces before restoring them, using the given JSON file"`
+	TransformFile              string   `long:"transformFile" description:"Rename, unset, set and convert fields of documents in matching namespaces as they are restored, using the given JSON file"`
+	DeferIndexBuilds           bool     `long:"deferIndexBuilds" description:"Build indexes after the data of every collection has been restored, instead of after each collection"`
+	NumParallelIndexBuilds     int      `long:"numParallelIndexBuilds" description:"Number of deferred indexes to build in parallel" default:"4"`
+	ForceBackgroundIndexBuilds bool     `long:"forceBackgroundIndexBuilds" description:"Build all indexes in the background"`
+	KeepIndexVersion           bool     `long:"keepIndexVersion" description:"Don't update index version"`
+	MaintainInsertionOrder     bool     `long:"maintainInsertionOrder" description:"Preserve order of documents during restoration"`
+	NumParallelCollections     int      `long:"numParallelCollections" short:"j" description:"Number of collections to restore in parallel" default:"4"`
+	PriorityFile               string   `long:"priorityFile" description:"Restore collections in order of the priorities given to namespace patterns in the given JSON file, and then by size"`
+	AdaptiveScheduling         bool     `long:"adaptiveScheduling" description:"Choose the next collection to restore using the throughput observed for each database, instead of only collection sizes"`
+	StopOnError                bool     `long:"stopOnError" description:"Stop restoring if an error is encountered on insert (off by default)" default:"false"`
+	MaxInsertsPerSecond        int      `long:"maxInsertsPerSecond" description:"Limit the rate of inserts across all collections being restored (0 for no limit)" default:"0"`
+	MaxReplicationLag          int      `long:"maxReplicationLag" description:"Pause inserts while any secondary is more than the given number of seconds behind the primary (0 to never pause)" default:"0"`
+	DryRun                     bool     `long:"dryRun" description:"Validate the dump and report what would be restored, without writing to the server"`
+	Verify                     bool     `long:"verify" description:"After restoring each collection, verify its document count, documents and indexes against the dump and report the results"`
+	ShardCollections           bool     `long:"shardCollections" description:"Shard and pre-split collections that were sharded when dumped, before inserting into them (requires mongos)"`
+	ShardKeys                  []string `long:"shardKey" description:"Shard collections matching a namespace pattern with the given key, e.g. 'test.*={\"_id\":\"hashed\"}' (may be repeated; requires mongos)"`
+	UsersAndRolesMode          string   `long:"usersAndRolesMode" description:"How to restore users and roles: 'merge' to keep existing ones and add those missing, 'replace' to drop existing ones first, or 'skip' (defaults to 'replace' with --drop, 'merge' otherwise)"`
+	UsersAndRolesDBRemaps      []string `long:"usersAndRolesDbRemap" description:"Restore users and roles of a database to another one, e.g. 'olddb=newdb' (may be repeated)"`
 }
 
 func (self *OutputOptions) Name() string {
@@ -0,0 +1,213 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+)
+
+// MetadataOverride is a set of edits to the collection options and indexes
+// of every namespace matching a pattern. An overrides file holds a list of them,
+// which are applied in order, e.g.
+//
+//	{"overrides": [{
+//		"ns": "test.*",
+//		"options": {"set": {"size": 1048576}, "unset": ["max"]},
+//		"indexes": {
+//			"drop": ["unwanted_1"],
+//			"rewrite": [{"name": "email_1", "key": {"email": 1}, "unique": false}],
+//			"expireAfterSeconds": {"createdAt_1": 31536000}
+//		}
+//	}]}
+type MetadataOverride struct {
+	Namespace string          `json:"ns"`
+	Options   OptionOverrides `json:"options"`
+	Indexes   IndexOverrides  `json:"indexes"`
+}
+
+// OptionOverrides edits a collection's options. Replace replaces all of the
+// options; then each option in Set is added or has its value replaced, and
+// each option in Unset is removed.
+type OptionOverrides struct {
+	Replace bson.D   `json:"replace"`
+	Set     bson.D   `json:"set"`
+	Unset   []string `json:"unset"`
+}
+
+// IndexOverrides edits a collection's indexes, which are identified by name.
+// Indexes in Drop are not restored, indexes in Rewrite replace the dumped index
+// with the same name, and ExpireAfterSeconds changes the TTL of an index or,
+// for a null value, removes it.
+type IndexOverrides struct {
+	Drop               []string               `json:"drop"`
+	Rewrite            []IndexDocument        `json:"rewrite"`
+	ExpireAfterSeconds map[string]interface{} `json:"expireAfterSeconds"`
+}
+
+type metadataOverridesFile struct {
+	Overrides []MetadataOverride `json:"overrides"`
+}
+
+// this struct is used to read in the options of rewritten indexes
+type metadataOverridesMapIndex struct {
+	Overrides []struct {
+		Indexes struct {
+			Rewrite []bson.M `json:"rewrite"`
+		} `json:"indexes"`
+	} `json:"overrides"`
+}
+
+// MetadataOverridesFromJSON parses and validates the contents of an overrides file
+func MetadataOverridesFromJSON(jsonBytes []byte) ([]MetadataOverride, error) {
+	file := metadataOverridesFile{}
+	err := json.Unmarshal(jsonBytes, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	// as with metadata files, read rewritten indexes a second time
+	// to get their options, and merge them with the ordered keys
+	fileAsMap := metadataOverridesMapIndex{}
+	err = json.Unmarshal(jsonBytes, &fileAsMap)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling overrides as map: %v", err)
+	}
+
+	for i := range file.Overrides {
+		override := &file.Overrides[i]
+		if err = util.ValidateNamespacePattern(override.Namespace); err != nil {
+			return nil, fmt.Errorf("override %v: %v", i, err)
+		}
+		for j := range override.Indexes.Rewrite {
+			options := fileAsMap.Overrides[i].Indexes.Rewrite[j]
+			delete(options, "key")
+			override.Indexes.Rewrite[j].Options = options
+			if _, ok := options["name"].(string); !ok {
+				return nil, fmt.Errorf("override %v: rewritten index %v has no name", i, j)
+			}
+			if len(override.Indexes.Rewrite[j].Key) == 0 {
+				return nil, fmt.Errorf("override %v: rewritten index %v has no key", i, options["name"])
+			}
+		}
+		for name, value := range override.Indexes.ExpireAfterSeconds {
+			if value == nil {
+				continue
+			}
+			if _, err = util.ToInt(value); err != nil {
+				return nil, fmt.Errorf("override %v: expireAfterSeconds for index %v must be a number or null", i, name)
+			}
+		}
+	}
+	return file.Overrides, nil
+}
+
+// ReadMetadataOverrides reads the overrides file given to --metadataOverrides
+func ReadMetadataOverrides(filename string) ([]MetadataOverride, error) {
+	jsonBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filename, err)
+	}
+	overrides, err := MetadataOverridesFromJSON(jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", filename, err)
+	}
+	return overrides, nil
+}
+
+// ApplyMetadataOverrides applies every override matching the intent's
+// namespace to its collection options and indexes, in order
+func (restore *MongoRestore) ApplyMetadataOverrides(intent *intents.Intent,
+	options bson.D, indexes []IndexDocument) (bson.D, []IndexDocument, error) {
+	for _, override := range restore.metadataOverrides {
+		matches, err := util.MatchNamespace(override.Namespace, intent.Key())
+		if err != nil {
+			return nil, nil, err
+		}
+		if !matches {
+			continue
+		}
+		log.Logf(log.Info, "applying metadata overrides for '%v' to %v", override.Namespace, intent.Key())
+		options = override.Options.apply(options)
+		indexes = override.Indexes.apply(intent, indexes)
+	}
+	return options, indexes, nil
+}
+
+func (overrides OptionOverrides) apply(options bson.D) bson.D {
+	if overrides.Replace != nil {
+		options = append(bson.D{}, overrides.Replace...)
+	}
+	for _, elem := range overrides.Set {
+		options = setOption(options, elem)
+	}
+	for _, name := range overrides.Unset {
+		options = unsetOption(options, name)
+	}
+	return options
+}
+
+func setOption(options bson.D, option bson.DocElem) bson.D {
+	for i := range options {
+		if options[i].Name == option.Name {
+			updated := append(bson.D{}, options...)
+			updated[i].Value = option.Value
+			return updated
+		}
+	}
+	return append(append(bson.D{}, options...), option)
+}
+
+func unsetOption(options bson.D, name string) bson.D {
+	updated := bson.D{}
+	for _, elem := range options {
+		if elem.Name != name {
+			updated = append(updated, elem)
+		}
+	}
+	return updated
+}
+
+func (overrides IndexOverrides) apply(intent *intents.Intent, indexes []IndexDocument) []IndexDocument {
+	updated := []IndexDocument{}
+	for _, index := range indexes {
+		name, _ := index.Options["name"].(string)
+		if util.StringSliceContains(overrides.Drop, name) {
+			log.Logf(log.Info, "\tnot restoring index %v of %v", name, intent.Key())
+			continue
+		}
+		for _, rewrite := range overrides.Rewrite {
+			if rewrite.Options["name"] == name {
+				log.Logf(log.Info, "\trewriting index %v of %v", name, intent.Key())
+				index = IndexDocument{Key: rewrite.Key, Options: copyIndexOptions(rewrite.Options)}
+				break
+			}
+		}
+		if ttl, ok := overrides.ExpireAfterSeconds[name]; ok {
+			options := copyIndexOptions(index.Options)
+			if ttl == nil {
+				log.Logf(log.Info, "\tremoving expireAfterSeconds from index %v of %v", name, intent.Key())
+				delete(options, "expireAfterSeconds")
+			} else {
+				log.Logf(log.Info, "\tsetting expireAfterSeconds of index %v of %v to %v", name, intent.Key(), ttl)
+				options["expireAfterSeconds"] = ttl
+			}
+			index.Options = options
+		}
+		updated = append(updated, index)
+	}
+	return updated
+}
+
+// copyIndexOptions copies an index's options, since the options of rewritten
+// indexes are shared between intents and CreateIndexes modifies them
+func copyIndexOptions(options bson.M) bson.M {
+	copied := bson.M{}
+	for key, value := range options {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,121 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+const testMetadata = `{"options":{"capped":true,"size":1073741824,"max":5000},"indexes":[
+	{"v":1,"key":{"_id":1},"name":"_id_","ns":"test.events"},
+	{"v":1,"key":{"createdAt":1},"name":"createdAt_1","ns":"test.events","expireAfterSeconds":3600},
+	{"v":1,"key":{"email":1},"name":"email_1","ns":"test.events","unique":true},
+	{"v":1,"key":{"debug":1},"name":"debug_1","ns":"test.events"}]}`
+
+func TestMetadataOverridesFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With an overrides file", t, func() {
+
+		Convey("rewritten indexes should keep their key order and options", func() {
+			overrides, err := MetadataOverridesFromJSON([]byte(`{"overrides":[{"ns":"test.*",
+				"indexes":{"rewrite":[{"name":"a_1_b_1","key":{"a":1,"b":1},"sparse":true}]}}]}`))
+			So(err, ShouldBeNil)
+			So(len(overrides), ShouldEqual, 1)
+			rewrite := overrides[0].Indexes.Rewrite[0]
+			So(rewrite.Key[0].Name, ShouldEqual, "a")
+			So(rewrite.Key[1].Name, ShouldEqual, "b")
+			So(rewrite.Options["sparse"], ShouldEqual, true)
+			_, hasKey := rewrite.Options["key"]
+			So(hasKey, ShouldBeFalse)
+		})
+
+		Convey("invalid overrides should be errors", func() {
+			_, err := MetadataOverridesFromJSON([]byte(`{"overrides":[{"ns":""}]}`))
+			So(err, ShouldNotBeNil)
+			_, err = MetadataOverridesFromJSON([]byte(`{"overrides":[{"ns":"test.*",
+				"indexes":{"rewrite":[{"key":{"a":1}}]}}]}`))
+			So(err, ShouldNotBeNil)
+			_, err = MetadataOverridesFromJSON([]byte(`{"overrides":[{"ns":"test.*",
+				"indexes":{"rewrite":[{"name":"a_1"}]}}]}`))
+			So(err, ShouldNotBeNil)
+			_, err = MetadataOverridesFromJSON([]byte(`{"overrides":[{"ns":"test.*",
+				"indexes":{"expireAfterSeconds":{"a_1":"soon"}}}]}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestApplyMetadataOverrides(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With dumped metadata", t, func() {
+		restore := &MongoRestore{}
+		options, indexes, err := restore.MetadataFromJSON([]byte(testMetadata))
+		So(err, ShouldBeNil)
+		intent := &intents.Intent{DB: "test", C: "events"}
+
+		indexNames := func(indexes []IndexDocument) []string {
+			names := []string{}
+			for _, index := range indexes {
+				names = append(names, index.Options["name"].(string))
+			}
+			return names
+		}
+
+		Convey("overrides for other namespaces should not apply", func() {
+			restore.metadataOverrides, err = MetadataOverridesFromJSON([]byte(`{"overrides":[
+				{"ns":"other.*","options":{"unset":["capped"]},"indexes":{"drop":["email_1"]}}]}`))
+			So(err, ShouldBeNil)
+			newOptions, newIndexes, err := restore.ApplyMetadataOverrides(intent, options, indexes)
+			So(err, ShouldBeNil)
+			So(newOptions, ShouldResemble, options)
+			So(len(newIndexes), ShouldEqual, 4)
+		})
+
+		Convey("collection options should be set, unset and replaced in order", func() {
+			restore.metadataOverrides, err = MetadataOverridesFromJSON([]byte(`{"overrides":[
+				{"ns":"test.*","options":{"set":{"size":1048576,"autoIndexId":true},"unset":["max"]}}]}`))
+			So(err, ShouldBeNil)
+			newOptions, _, err := restore.ApplyMetadataOverrides(intent, options, indexes)
+			So(err, ShouldBeNil)
+			So(newOptions, ShouldResemble, bson.D{{"capped", true}, {"size", 1048576.0}, {"autoIndexId", true}})
+			// the original options are left unchanged
+			So(len(options), ShouldEqual, 3)
+
+			restore.metadataOverrides, err = MetadataOverridesFromJSON([]byte(`{"overrides":[
+				{"ns":"test.events","options":{"replace":{"collation":{"locale":"fr"}}}}]}`))
+			So(err, ShouldBeNil)
+			newOptions, _, err = restore.ApplyMetadataOverrides(intent, options, indexes)
+			So(err, ShouldBeNil)
+			So(len(newOptions), ShouldEqual, 1)
+			So(newOptions[0].Name, ShouldEqual, "collation")
+		})
+
+		Convey("indexes should be dropped, rewritten and have their TTL changed", func() {
+			restore.metadataOverrides, err = MetadataOverridesFromJSON([]byte(`{"overrides":[
+				{"ns":"test.*","indexes":{"drop":["debug_1"],
+					"rewrite":[{"name":"email_1","key":{"email":1,"tenant":1}}],
+					"expireAfterSeconds":{"createdAt_1":null}}},
+				{"ns":"test.events","indexes":{"expireAfterSeconds":{"email_1":60}}}]}`))
+			So(err, ShouldBeNil)
+			_, newIndexes, err := restore.ApplyMetadataOverrides(intent, options, indexes)
+			So(err, ShouldBeNil)
+			So(indexNames(newIndexes), ShouldResemble, []string{"_id_", "createdAt_1", "email_1"})
+
+			_, hasTTL := newIndexes[1].Options["expireAfterSeconds"]
+			So(hasTTL, ShouldBeFalse)
+			So(newIndexes[2].Key, ShouldResemble, bson.D{{"email", 1.0}, {"tenant", 1.0}})
+			So(newIndexes[2].Options["unique"], ShouldBeNil)
+			So(newIndexes[2].Options["expireAfterSeconds"], ShouldEqual, 60)
+
+			// the dumped indexes and the overrides are left unchanged
+			So(indexes[1].Options["expireAfterSeconds"], ShouldEqual, 3600)
+			So(restore.metadataOverrides[0].Indexes.Rewrite[0].Options["expireAfterSeconds"], ShouldBeNil)
+		})
+	})
+}
@@ -2,15 +2,15 @@ package mongorestore
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"gopkg.in/mgo.v2/bson"
-	"io"
-	"io/ioutil"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +30,16 @@ func (restore *MongoRestore) RestoreIntents() error {
 	restore.progressManager.Start()
 	defer restore.progressManager.Stop()
 
+	if restore.throttle != nil {
+		defer restore.throttle.LogSummary()
+		if restore.OutputOptions.MaxReplicationLag > 0 {
+			stopMonitor := make(chan struct{})
+			defer close(stopMonitor)
+			maxLag := time.Duration(restore.OutputOptions.MaxReplicationLag) * time.Second
+			go restore.MonitorReplicationLag(restore.throttle, maxLag, ReplicationLagCheckInterval, stopMonitor)
+		}
+	}
+
 	if restore.OutputOptions.NumParallelCollections > 0 {
 		resultChan := make(chan error)
 
@@ -116,30 +126,12 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
-	var options bson.D
-	var indexes []IndexDocument
-
-	// get indexes from system.indexes dump if we have it but don't have metadata files
-	if intent.MetadataPath == "" && restore.manager.SystemIndexes(intent.DB) != nil {
-		systemIndexesFile := restore.manager.SystemIndexes(intent.DB).BSONPath
-		log.Logf(log.Always, "no metadata file; reading indexes from %v", systemIndexesFile)
-		indexes, err = restore.IndexesFromBSON(intent, systemIndexesFile)
-		if err != nil {
-			return fmt.Errorf("error reading indexes from %v: %v", systemIndexesFile, err)
-		}
-	}
-
 	// first create collection with options
+	options, indexes, err := restore.ReadIntentMetadata(intent)
+	if err != nil {
+		return err
+	}
 	if intent.MetadataPath != "" {
-		log.Logf(log.Always, "reading metadata file from %v", intent.MetadataPath)
-		jsonBytes, err := ioutil.ReadFile(intent.MetadataPath)
-		if err != nil {
-			return fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
-		}
-		options, indexes, err = restore.MetadataFromJSON(jsonBytes)
-		if err != nil {
-			return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
-		}
 		if !restore.OutputOptions.NoOptionsRestore {
 			if options != nil {
 				if !collectionExists {
@@ -159,30 +151,42 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
+	// shard the collection before inserting, so that documents go straight to their shards
+	sharding, err := restore.ReadIntentSharding(intent)
+	if err != nil {
+		return err
+	}
+	if sharding != nil {
+		err = restore.ShardCollection(intent, sharding)
+		if err != nil {
+			return err
+		}
+	}
+
 	// then do bson
 	if intent.BSONPath != "" {
 		log.Logf(log.Always, "restoring %v from file %v", intent.Key(), intent.BSONPath)
-		var rawBSONSource io.ReadCloser
+		var rawSource db.RawDocSource
 		var size int64
 
 		if restore.useStdin {
-			rawBSONSource = os.Stdin
+			rawSource = db.NewBSONSource(os.Stdin)
 			log.Log(log.Always, "restoring from stdin")
 		} else {
 			fileInfo, err := os.Lstat(intent.BSONPath)
 			if err != nil {
-				return fmt.Errorf("error reading BSON file %v: %v", intent.BSONPath, err)
+				return fmt.Errorf("error reading file %v: %v", intent.BSONPath, err)
 			}
+			log.Logf(log.Info, "\tfile %v is %v bytes", intent.BSONPath, fileInfo.Size())
 			size = fileInfo.Size()
-			log.Logf(log.Info, "\tfile %v is %v bytes", intent.BSONPath, size)
 
-			rawBSONSource, err = os.Open(intent.BSONPath)
+			rawSource, err = restore.OpenDataFile(intent.BSONPath)
 			if err != nil {
-				return fmt.Errorf("error reading BSON file %v: %v", intent.BSONPath, err)
+				return fmt.Errorf("error reading file %v: %v", intent.BSONPath, err)
 			}
 		}
 
-		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(rawBSONSource))
+		bsonSource := db.NewDecodedBSONSource(rawSource)
 		defer bsonSource.Close()
 
 		err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, size)
@@ -191,17 +195,28 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
-	// finally, add indexes
+	// finally, add indexes, or save them to build once all data is restored
+	deferred := false
 	if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
-		log.Logf(log.Always, "restoring indexes for collection %v from metadata", intent.Key())
-		err = restore.CreateIndexes(intent, indexes)
-		if err != nil {
-			return fmt.Errorf("error creating indexes for %v: %v", intent.Key(), err)
+		if restore.OutputOptions.DeferIndexBuilds {
+			restore.DeferIndexes(intent, indexes)
+			deferred = true
+		} else {
+			log.Logf(log.Always, "restoring indexes for collection %v from metadata", intent.Key())
+			err = restore.CreateIndexes(intent, indexes)
+			if err != nil {
+				return fmt.Errorf("error creating indexes for %v: %v", intent.Key(), err)
+			}
 		}
 	} else {
 		log.Log(log.Always, "no indexes to restore")
 	}
 
+	// collections with deferred indexes are verified after they are built
+	if restore.OutputOptions.Verify && !deferred {
+		restore.addVerifyReport(restore.VerifyIntent(intent, indexes))
+	}
+
 	log.Logf(log.Always, "finished restoring %v", intent.Key())
 	return nil
 }
@@ -220,8 +235,19 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 
 	collection := session.DB(dbName).C(colName)
 
+	transforms, err := restore.TransformsForNamespace(dbName + "." + colName)
+	if err != nil {
+		return err
+	}
+
 	// progress bar handlers
 	var bytesRead int64
+	// the progress of JSON files is the bytes read from the file, since
+	// the size of the BSON documents can't be compared to the file size
+	progressPtr := &bytesRead
+	if jsonSource, ok := bsonSource.RawDocSource.(*JSONSource); ok {
+		progressPtr = jsonSource.BytesRead()
+	}
 
 	// only print progress bar if we know the bounds
 	// TODO have useful progress meters when max=0
@@ -229,12 +255,13 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		bar := &progress.ProgressBar{
 			Name:       fmt.Sprintf("%v.%v", dbName, colName),
 			Max:        int64(fileSize),
-			CounterPtr: &bytesRead,
+			CounterPtr: progressPtr,
 			Writer:     log.Writer(0),
 			BarLength:  ProgressBarLength,
 		}
 		restore.progressManager.Attach(bar)
 		defer restore.progressManager.Detach(bar)
+		restore.manager.TrackProgress(dbName+"."+colName, progressPtr)
 	}
 
 	MaxInsertThreads := restore.ToolOptions.BulkWriters
@@ -256,7 +283,7 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 				if !alive {
 					return
 				}
-				bytesRead += size
+				atomic.AddInt64(&bytesRead, size)
 			case <-killChan:
 				return
 			}
@@ -293,15 +320,33 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 						return
 					}
 					if restore.objCheck {
-						//TODO encapsulate to reuse bson obj??
-						err := bson.Unmarshal(rawDoc.Data, &bson.D{})
+						err := bsonutil.ValidateBSON(rawDoc.Data, bsonutil.DefaultValidationOptions)
 						if err != nil {
 							resultChan <- fmt.Errorf("invalid object: %v", err)
 							return
 						}
 					}
 
-					err := bulk.Insert(rawDoc)
+					if restore.throttle != nil && !restore.throttle.Wait(killChan) {
+						return
+					}
+
+					var doc interface{} = rawDoc
+					if len(transforms) > 0 {
+						transformed, err := TransformDocument(transforms, rawDoc)
+						if err != nil {
+							if restore.OutputOptions.StopOnError {
+								resultChan <- err
+								return
+							}
+							log.Logf(log.Always, "error: %v", err)
+							bytesReadChan <- int64(len(rawDoc.Data))
+							continue
+						}
+						doc = transformed
+					}
+
+					err := bulk.Insert(doc)
 					if err != nil {
 
 						if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
@@ -0,0 +1,314 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"strings"
+)
+
+// ShardingMetadata describes how a collection was sharded when it was dumped
+// through mongos: its shard key and the ranges of its chunks.
+type ShardingMetadata struct {
+	Key    bson.D
+	Unique bool
+	Chunks []ChunkRange
+}
+
+// ChunkRange is the range of shard key values in one chunk and the shard it lived on
+type ChunkRange struct {
+	Min   bson.D
+	Max   bson.D
+	Shard string
+}
+
+// validateShardedRestore checks that a restore through mongos can be done
+// there. A full restore is only possible as a point-in-time restore, which
+// replays <dump>/oplog.bson with individual writes since applyOps can't be
+// run through mongos, as with "mongorestore --oplogReplay dump/" against
+// mongos. The config database of the dump is left out of such a restore.
+func (restore *MongoRestore) validateShardedRestore() error {
+	if restore.ToolOptions.DB != "" {
+		return nil
+	}
+	if !restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot do a full restore on a sharded system without --oplogReplay")
+	}
+	if !restore.useCRUDOplogReplay {
+		return fmt.Errorf("cannot do a full restore on a sharded system with --oplogApplyMode=applyOps")
+	}
+	return nil
+}
+
+// shardKeyOverride is a --shardKey argument
+type shardKeyOverride struct {
+	pattern string
+	key     bson.D
+}
+
+// this struct is used to read the sharding section of a metadata file
+type metadataSharding struct {
+	Sharding *struct {
+		Key    bson.D `json:"key"`
+		Unique bool   `json:"unique"`
+		Chunks []struct {
+			Min   bson.D `json:"min"`
+			Max   bson.D `json:"max"`
+			Shard string `json:"shard"`
+		} `json:"chunks"`
+	} `json:"sharding"`
+}
+
+// ShardingFromJSON reads the sharding section of a metadata file.
+// It returns nil if the collection was not sharded when it was dumped.
+func ShardingFromJSON(jsonBytes []byte) (*ShardingMetadata, error) {
+	meta := metadataSharding{}
+	err := json.Unmarshal(jsonBytes, &meta)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Sharding == nil {
+		return nil, nil
+	}
+	if len(meta.Sharding.Key) == 0 {
+		return nil, fmt.Errorf("sharding metadata has no shard key")
+	}
+
+	sharding := &ShardingMetadata{Unique: meta.Sharding.Unique}
+	sharding.Key, err = bsonutil.GetExtendedBsonD(meta.Sharding.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard key: %v", err)
+	}
+	for i, chunk := range meta.Sharding.Chunks {
+		chunkRange := ChunkRange{Shard: chunk.Shard}
+		if chunkRange.Min, err = bsonutil.GetExtendedBsonD(chunk.Min); err != nil {
+			return nil, fmt.Errorf("error reading min of chunk %v: %v", i, err)
+		}
+		if chunkRange.Max, err = bsonutil.GetExtendedBsonD(chunk.Max); err != nil {
+			return nil, fmt.Errorf("error reading max of chunk %v: %v", i, err)
+		}
+		sharding.Chunks = append(sharding.Chunks, chunkRange)
+	}
+	return sharding, nil
+}
+
+// parseShardKeyOverride parses a --shardKey argument of the
+// form <namespace pattern>=<JSON shard key>, e.g. 'test.*={"_id":"hashed"}'
+func parseShardKeyOverride(arg string) (shardKeyOverride, error) {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		return shardKeyOverride{}, fmt.Errorf("'%v' must be of the form <namespace>=<shard key>", arg)
+	}
+	override := shardKeyOverride{pattern: arg[:i]}
+	if err := util.ValidateNamespacePattern(override.pattern); err != nil {
+		return shardKeyOverride{}, err
+	}
+	key := bson.D{}
+	if err := json.Unmarshal([]byte(arg[i+1:]), &key); err != nil {
+		return shardKeyOverride{}, fmt.Errorf("error parsing shard key '%v': %v", arg[i+1:], err)
+	}
+	if len(key) == 0 {
+		return shardKeyOverride{}, fmt.Errorf("shard key for '%v' is empty", override.pattern)
+	}
+	override.key = key
+	return override, nil
+}
+
+// IsHashed returns true if the shard key is a hashed key
+func (sharding *ShardingMetadata) IsHashed() bool {
+	for _, elem := range sharding.Key {
+		if elem.Value == "hashed" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadIntentSharding returns how the intent's collection should be sharded, or
+// nil if it shouldn't be. The dumped sharding metadata is used with
+// --shardCollections, and the first matching --shardKey replaces its key. Chunk
+// ranges are only kept if the key they were split on is unchanged.
+func (restore *MongoRestore) ReadIntentSharding(intent *intents.Intent) (*ShardingMetadata, error) {
+	var sharding *ShardingMetadata
+	if restore.OutputOptions.ShardCollections && intent.MetadataPath != "" {
+		jsonBytes, err := ioutil.ReadFile(intent.MetadataPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
+		}
+		sharding, err = ShardingFromJSON(jsonBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing sharding metadata in %v: %v", intent.MetadataPath, err)
+		}
+	}
+
+	for _, override := range restore.shardKeyOverrides {
+		matches, err := util.MatchNamespace(override.pattern, intent.Key())
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			continue
+		}
+		if sharding == nil {
+			sharding = &ShardingMetadata{}
+		}
+		if !keysEqual(sharding.Key, override.key) {
+			if len(sharding.Chunks) > 0 {
+				log.Logf(log.Info, "shard key of %v overridden; not pre-splitting dumped chunks", intent.Key())
+			}
+			sharding.Key = override.key
+			sharding.Chunks = nil
+		}
+		break
+	}
+	return sharding, nil
+}
+
+// keysEqual compares two shard keys, which are equal if they
+// have the same fields in the same order with the same values
+func keysEqual(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || fmt.Sprintf("%v", a[i].Value) != fmt.Sprintf("%v", b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssignChunkShards decides which shard each chunk should be moved to. Chunks
+// go back to the shard they were dumped from if it exists in the target
+// cluster; the others are spread across the available shards in turn.
+func AssignChunkShards(chunks []ChunkRange, shards []string) []string {
+	if len(shards) == 0 {
+		return nil
+	}
+	available := map[string]bool{}
+	for _, shard := range shards {
+		available[shard] = true
+	}
+	assigned := make([]string, len(chunks))
+	next := 0
+	for i, chunk := range chunks {
+		if available[chunk.Shard] {
+			assigned[i] = chunk.Shard
+			continue
+		}
+		assigned[i] = shards[next%len(shards)]
+		next++
+	}
+	return assigned
+}
+
+// ShardCollection shards the intent's collection before any documents are
+// inserted. Collections with a range shard key are pre-split at the dumped chunk
+// boundaries and the chunks are moved to their shards, so that the restore
+// does not have to wait for the balancer. Hashed collections are created with
+// as many initial chunks as were dumped.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent, sharding *ShardingMetadata) error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+
+	err = runShardingCommand(session, bson.D{{"enableSharding", intent.DB}})
+	if err != nil && !strings.Contains(err.Error(), "already enabled") {
+		return fmt.Errorf("error enabling sharding on database %v: %v", intent.DB, err)
+	}
+
+	alreadySharded, err := session.DB("config").C("collections").Find(
+		bson.M{"_id": intent.Key(), "dropped": bson.M{"$ne": true}}).Count()
+	if err != nil {
+		return fmt.Errorf("error reading sharding information for %v: %v", intent.Key(), err)
+	}
+	if alreadySharded > 0 {
+		log.Logf(log.Always, "collection %v is already sharded; not resharding or pre-splitting", intent.Key())
+		return nil
+	}
+
+	log.Logf(log.Always, "sharding collection %v with key %v", intent.Key(), describeKey(sharding.Key))
+	command := bson.D{{"shardCollection", intent.Key()}, {"key", sharding.Key}}
+	if sharding.Unique {
+		command = append(command, bson.DocElem{"unique", true})
+	}
+	if sharding.IsHashed() && len(sharding.Chunks) > 1 {
+		command = append(command, bson.DocElem{"numInitialChunks", len(sharding.Chunks)})
+	}
+	if err = runShardingCommand(session, command); err != nil {
+		return fmt.Errorf("error sharding collection %v: %v", intent.Key(), err)
+	}
+
+	if sharding.IsHashed() || len(sharding.Chunks) <= 1 {
+		return nil
+	}
+	return restore.distributeChunks(session, intent, sharding.Chunks)
+}
+
+// distributeChunks splits a newly sharded collection at the given chunk
+// boundaries and moves each chunk to its assigned shard
+func (restore *MongoRestore) distributeChunks(session *mgo.Session, intent *intents.Intent, chunks []ChunkRange) error {
+	log.Logf(log.Info, "pre-splitting %v into %v chunks", intent.Key(), len(chunks))
+	for _, chunk := range chunks[1:] {
+		err := runShardingCommand(session, bson.D{{"split", intent.Key()}, {"middle", chunk.Min}})
+		if err != nil {
+			// splitting at an existing boundary fails, but leaves the chunks we want
+			log.Logf(log.DebugLow, "error splitting %v at %v: %v", intent.Key(), chunk.Min, err)
+		}
+	}
+
+	shardList := struct {
+		Shards []struct {
+			ID string `bson:"_id"`
+		} `bson:"shards"`
+	}{}
+	if err := session.DB("admin").Run(bson.D{{"listShards", 1}}, &shardList); err != nil {
+		return fmt.Errorf("error listing shards: %v", err)
+	}
+	shards := []string{}
+	for _, shard := range shardList.Shards {
+		shards = append(shards, shard.ID)
+	}
+
+	for i, shard := range AssignChunkShards(chunks, shards) {
+		log.Logf(log.DebugHigh, "moving chunk %v of %v to shard %v", i, intent.Key(), shard)
+		err := runShardingCommand(session, bson.D{
+			{"moveChunk", intent.Key()},
+			{"bounds", []bson.D{chunks[i].Min, chunks[i].Max}},
+			{"to", shard},
+		})
+		if err != nil && !strings.Contains(err.Error(), "already on that shard") {
+			return fmt.Errorf("error moving chunk %v of %v to shard %v: %v", i, intent.Key(), shard, err)
+		}
+	}
+	return nil
+}
+
+func runShardingCommand(session *mgo.Session, command bson.D) error {
+	res := bson.M{}
+	err := session.DB("admin").Run(command, &res)
+	if err != nil {
+		return err
+	}
+	if util.IsFalsy(res["ok"]) {
+		return fmt.Errorf("%v", res["errmsg"])
+	}
+	return nil
+}
+
+func describeKey(key bson.D) string {
+	fields := []string{}
+	for _, elem := range key {
+		fields = append(fields, fmt.Sprintf("%v: %v", elem.Name, elem.Value))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
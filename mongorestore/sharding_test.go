@@ -0,0 +1,202 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShardingFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With sharding metadata", t, func() {
+
+		Convey("a collection that wasn't sharded should have none", func() {
+			sharding, err := ShardingFromJSON([]byte(`{"options":{},"indexes":[]}`))
+			So(err, ShouldBeNil)
+			So(sharding, ShouldBeNil)
+		})
+
+		Convey("the key, unique flag and chunks should be read in order", func() {
+			sharding, err := ShardingFromJSON([]byte(`{"indexes":[],"sharding":{
+				"key":{"a":1,"b":1},"unique":true,"chunks":[
+				{"min":{"a":{"$minKey":1},"b":{"$minKey":1}},"max":{"a":10,"b":{"$minKey":1}},"shard":"rs0"},
+				{"min":{"a":10,"b":{"$minKey":1}},"max":{"a":{"$maxKey":1},"b":{"$maxKey":1}},"shard":"rs1"}]}}`))
+			So(err, ShouldBeNil)
+			So(sharding, ShouldNotBeNil)
+			So(sharding.Unique, ShouldBeTrue)
+			So(sharding.IsHashed(), ShouldBeFalse)
+			So(len(sharding.Key), ShouldEqual, 2)
+			So(sharding.Key[0].Name, ShouldEqual, "a")
+			So(sharding.Key[1].Name, ShouldEqual, "b")
+			So(len(sharding.Chunks), ShouldEqual, 2)
+			So(sharding.Chunks[0].Min[0].Value, ShouldEqual, bson.MinKey)
+			So(sharding.Chunks[0].Shard, ShouldEqual, "rs0")
+			So(sharding.Chunks[1].Min[0].Value, ShouldEqual, 10)
+			So(sharding.Chunks[1].Max[1].Value, ShouldEqual, bson.MaxKey)
+		})
+
+		Convey("a hashed key should be detected", func() {
+			sharding, err := ShardingFromJSON([]byte(`{"sharding":{"key":{"_id":"hashed"},"chunks":[]}}`))
+			So(err, ShouldBeNil)
+			So(sharding.IsHashed(), ShouldBeTrue)
+		})
+
+		Convey("a missing shard key should be an error", func() {
+			_, err := ShardingFromJSON([]byte(`{"sharding":{"chunks":[]}}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseShardKeyOverride(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With --shardKey arguments", t, func() {
+
+		Convey("a pattern and key should be parsed", func() {
+			override, err := parseShardKeyOverride(`test.*={"user":1,"ts":1}`)
+			So(err, ShouldBeNil)
+			So(override.pattern, ShouldEqual, "test.*")
+			So(len(override.key), ShouldEqual, 2)
+			So(override.key[0].Name, ShouldEqual, "user")
+			So(override.key[1].Name, ShouldEqual, "ts")
+		})
+
+		Convey("malformed arguments should be errors", func() {
+			_, err := parseShardKeyOverride(`test.foo`)
+			So(err, ShouldNotBeNil)
+			_, err = parseShardKeyOverride(`={"a":1}`)
+			So(err, ShouldNotBeNil)
+			_, err = parseShardKeyOverride(`test.foo={}`)
+			So(err, ShouldNotBeNil)
+			_, err = parseShardKeyOverride(`test.foo={"a":`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestReadIntentSharding(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a mongorestore using --shardKey", t, func() {
+		override, err := parseShardKeyOverride(`test.users={"_id":"hashed"}`)
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{
+			OutputOptions:     &OutputOptions{},
+			shardKeyOverrides: []shardKeyOverride{override},
+		}
+
+		Convey("matching collections should be sharded on the given key", func() {
+			sharding, err := restore.ReadIntentSharding(&intents.Intent{DB: "test", C: "users"})
+			So(err, ShouldBeNil)
+			So(sharding, ShouldNotBeNil)
+			So(sharding.Key[0].Name, ShouldEqual, "_id")
+			So(sharding.IsHashed(), ShouldBeTrue)
+			So(sharding.Chunks, ShouldBeNil)
+		})
+
+		Convey("other collections should not be sharded", func() {
+			sharding, err := restore.ReadIntentSharding(&intents.Intent{DB: "test", C: "orders"})
+			So(err, ShouldBeNil)
+			So(sharding, ShouldBeNil)
+		})
+	})
+}
+
+func TestAssignChunkShards(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With dumped chunks", t, func() {
+		chunks := []ChunkRange{
+			{Shard: "rs0"}, {Shard: "rs1"}, {Shard: "rs2"}, {Shard: "rs3"},
+		}
+
+		Convey("chunks should return to shards that still exist", func() {
+			So(AssignChunkShards(chunks, []string{"rs0", "rs1", "rs2", "rs3"}),
+				ShouldResemble, []string{"rs0", "rs1", "rs2", "rs3"})
+		})
+
+		Convey("chunks from missing shards should be spread round-robin", func() {
+			So(AssignChunkShards(chunks, []string{"a", "rs1"}),
+				ShouldResemble, []string{"a", "rs1", "rs1", "a"})
+		})
+
+		Convey("no shards should assign nothing", func() {
+			So(AssignChunkShards(chunks, nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestShardedFullRestore(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	dumpDir, err := ioutil.TempDir("", "mongorestore_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dumpDir)
+	oplog, err := ioutil.ReadFile("testdata/testdirs/oplog.bson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"oplog.bson":         oplog,
+		"db1/c1.bson":        nil,
+		"config/chunks.bson": nil,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dumpDir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("With a MongoRestore connected to mongos", t, func() {
+		restore := &MongoRestore{
+			ToolOptions:  &options.ToolOptions{Namespace: &options.Namespace{}},
+			InputOptions: &InputOptions{OplogReplay: true},
+			manager:      intents.NewCategorizingIntentManager(),
+			isMongos:     true,
+		}
+
+		Convey("a full restore should only be allowed with a CRUD oplog replay", func() {
+			restore.useCRUDOplogReplay = true
+			So(restore.validateShardedRestore(), ShouldBeNil)
+			restore.useCRUDOplogReplay = false
+			So(restore.validateShardedRestore(), ShouldNotBeNil)
+			restore.useCRUDOplogReplay = true
+			restore.InputOptions.OplogReplay = false
+			So(restore.validateShardedRestore(), ShouldNotBeNil)
+		})
+		Convey("a restore of a single database should be allowed", func() {
+			restore.ToolOptions.Namespace.DB = "db1"
+			restore.InputOptions.OplogReplay = false
+			So(restore.validateShardedRestore(), ShouldBeNil)
+		})
+		Convey("a full restore should replay the dump's oplog, and leave out its config database", func() {
+			So(restore.CreateAllIntents(dumpDir), ShouldBeNil)
+			So(restore.manager.Oplog(), ShouldNotBeNil)
+			restore.manager.Finalize(intents.Legacy)
+			namespaces := []string{}
+			for intent := restore.manager.Pop(); intent != nil; intent = restore.manager.Pop() {
+				namespaces = append(namespaces, intent.Key())
+			}
+			So(namespaces, ShouldResemble, []string{"db1.c1"})
+		})
+	})
+}
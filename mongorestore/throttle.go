@@ -0,0 +1,222 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+	"time"
+)
+
+// ReplicationLagCheckInterval is how often replSetGetStatus
+// is run when restoring with --maxReplicationLag
+const ReplicationLagCheckInterval = time.Second * 2
+
+// InsertThrottle slows down the insertion workers of every collection being
+// restored. It limits the total rate of inserts for --maxInsertsPerSecond,
+// and can pause all inserts while secondaries catch up for --maxReplicationLag.
+type InsertThrottle struct {
+	mutex sync.Mutex
+
+	// the time between inserts, and the earliest time the next one can happen
+	interval   time.Duration
+	nextInsert time.Time
+
+	// closed when a pause ends; nil when not paused
+	resumed     chan struct{}
+	pausedSince time.Time
+
+	// time spent throttled, for logging at the end of the restore
+	rateLimited time.Duration
+	paused      time.Duration
+}
+
+// NewInsertThrottle returns a throttle allowing the given number of inserts
+// per second, or any number of inserts if maxInsertsPerSecond is zero
+func NewInsertThrottle(maxInsertsPerSecond int) *InsertThrottle {
+	throttle := &InsertThrottle{}
+	if maxInsertsPerSecond > 0 {
+		throttle.interval = time.Second / time.Duration(maxInsertsPerSecond)
+	}
+	return throttle
+}
+
+// Wait blocks until an insert is allowed. It returns false if
+// done was closed before then, meaning the insert should not happen.
+func (throttle *InsertThrottle) Wait(done <-chan struct{}) bool {
+	throttle.mutex.Lock()
+	resumed := throttle.resumed
+	throttle.mutex.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-done:
+			return false
+		}
+	}
+
+	if throttle.interval == 0 {
+		return true
+	}
+	throttle.mutex.Lock()
+	now := time.Now()
+	if throttle.nextInsert.Before(now) {
+		throttle.nextInsert = now
+	}
+	wait := throttle.nextInsert.Sub(now)
+	throttle.nextInsert = throttle.nextInsert.Add(throttle.interval)
+	throttle.rateLimited += wait
+	throttle.mutex.Unlock()
+
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return false
+		}
+	}
+	return true
+}
+
+// Pause stops all inserts until Resume is called
+func (throttle *InsertThrottle) Pause() {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	if throttle.resumed == nil {
+		throttle.resumed = make(chan struct{})
+		throttle.pausedSince = time.Now()
+	}
+}
+
+// Resume lets paused inserts continue, and returns how long they were paused
+func (throttle *InsertThrottle) Resume() time.Duration {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	if throttle.resumed == nil {
+		return 0
+	}
+	close(throttle.resumed)
+	throttle.resumed = nil
+	pause := time.Since(throttle.pausedSince)
+	throttle.paused += pause
+	return pause
+}
+
+// IsPaused returns true if inserts are paused
+func (throttle *InsertThrottle) IsPaused() bool {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	return throttle.resumed != nil
+}
+
+// LogSummary logs the time spent throttled
+func (throttle *InsertThrottle) LogSummary() {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	if throttle.interval > 0 {
+		log.Logf(log.Always, "--maxInsertsPerSecond delayed inserts by a total of %v",
+			roundToMillisecond(throttle.rateLimited))
+	}
+	if throttle.paused > 0 {
+		log.Logf(log.Always, "inserts were paused for %v waiting for secondaries to catch up",
+			roundToMillisecond(throttle.paused))
+	}
+}
+
+// replSetStatus is the part of the replSetGetStatus output used to measure lag
+type replSetStatus struct {
+	Members []replSetMember `bson:"members"`
+}
+
+type replSetMember struct {
+	Name       string    `bson:"name"`
+	State      int       `bson:"state"`
+	OptimeDate time.Time `bson:"optimeDate"`
+}
+
+const (
+	replSetStatePrimary   = 1
+	replSetStateSecondary = 2
+)
+
+// ReplicationLag returns how far the furthest behind secondary
+// is behind the primary, and the name of that secondary
+func ReplicationLag(status replSetStatus) (time.Duration, string, error) {
+	var primary *replSetMember
+	for i := range status.Members {
+		if status.Members[i].State == replSetStatePrimary {
+			primary = &status.Members[i]
+		}
+	}
+	if primary == nil {
+		return 0, "", fmt.Errorf("replica set has no primary")
+	}
+
+	var lag time.Duration
+	var furthestBehind string
+	for _, member := range status.Members {
+		if member.State != replSetStateSecondary {
+			continue
+		}
+		if memberLag := primary.OptimeDate.Sub(member.OptimeDate); memberLag > lag {
+			lag = memberLag
+			furthestBehind = member.Name
+		}
+	}
+	return lag, furthestBehind, nil
+}
+
+// MonitorReplicationLag checks the replication lag of the replica set at
+// every interval, pausing the throttle while it is over maxLag. It runs
+// until done is closed, and resumes any paused inserts before returning.
+func (restore *MongoRestore) MonitorReplicationLag(throttle *InsertThrottle, maxLag, interval time.Duration, done <-chan struct{}) {
+	defer throttle.Resume()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		lag, member, err := restore.getReplicationLag()
+		if err != nil {
+			// don't hold up the restore because lag can't be measured
+			log.Logf(log.Always, "error checking replication lag: %v", err)
+			if throttle.IsPaused() {
+				throttle.Resume()
+			}
+			continue
+		}
+		log.Logf(log.DebugHigh, "replication lag is %v (%v)", lag, member)
+
+		switch {
+		case lag > maxLag && !throttle.IsPaused():
+			log.Logf(log.Always, "secondary %v is %v behind the primary; pausing inserts", member, lag)
+			throttle.Pause()
+		case lag <= maxLag && throttle.IsPaused():
+			pause := throttle.Resume()
+			log.Logf(log.Always, "replication lag is %v; resuming inserts after pausing for %v",
+				lag, roundToMillisecond(pause))
+		}
+	}
+}
+
+func (restore *MongoRestore) getReplicationLag() (time.Duration, string, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return 0, "", err
+	}
+	defer session.Close()
+	status := replSetStatus{}
+	err = session.DB("admin").Run(bson.D{{"replSetGetStatus", 1}}, &status)
+	if err != nil {
+		return 0, "", fmt.Errorf("error running replSetGetStatus: %v", err)
+	}
+	return ReplicationLag(status)
+}
+
+func roundToMillisecond(d time.Duration) time.Duration {
+	return d - d%time.Millisecond
+}
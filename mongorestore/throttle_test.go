@@ -0,0 +1,103 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestInsertThrottle(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With an insert throttle", t, func() {
+		done := make(chan struct{})
+
+		Convey("inserts should be limited to the given rate", func() {
+			throttle := NewInsertThrottle(100)
+			start := time.Now()
+			for i := 0; i < 11; i++ {
+				So(throttle.Wait(done), ShouldBeTrue)
+			}
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+		})
+
+		Convey("an unlimited throttle should not delay inserts", func() {
+			throttle := NewInsertThrottle(0)
+			start := time.Now()
+			allowed := 0
+			for i := 0; i < 1000; i++ {
+				if throttle.Wait(done) {
+					allowed++
+				}
+			}
+			So(allowed, ShouldEqual, 1000)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		Convey("paused inserts should wait until they are resumed", func() {
+			throttle := NewInsertThrottle(0)
+			throttle.Pause()
+			So(throttle.IsPaused(), ShouldBeTrue)
+
+			allowed := make(chan bool)
+			go func() {
+				allowed <- throttle.Wait(done)
+			}()
+			select {
+			case <-allowed:
+				t.Fatal("insert was not paused")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			So(throttle.Resume(), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(<-allowed, ShouldBeTrue)
+			So(throttle.IsPaused(), ShouldBeFalse)
+			So(throttle.Resume(), ShouldEqual, 0)
+		})
+
+		Convey("paused inserts should be abandoned when done is closed", func() {
+			throttle := NewInsertThrottle(0)
+			throttle.Pause()
+			close(done)
+			So(throttle.Wait(done), ShouldBeFalse)
+		})
+	})
+}
+
+func TestReplicationLag(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With replica set statuses", t, func() {
+		now := time.Now()
+
+		Convey("the furthest behind secondary should be found", func() {
+			lag, member, err := ReplicationLag(replSetStatus{Members: []replSetMember{
+				{Name: "a:27017", State: replSetStateSecondary, OptimeDate: now.Add(-5 * time.Second)},
+				{Name: "b:27017", State: replSetStatePrimary, OptimeDate: now},
+				{Name: "c:27017", State: replSetStateSecondary, OptimeDate: now.Add(-30 * time.Second)},
+				{Name: "d:27017", State: 7, OptimeDate: now.Add(-time.Hour)},
+			}})
+			So(err, ShouldBeNil)
+			So(lag, ShouldEqual, 30*time.Second)
+			So(member, ShouldEqual, "c:27017")
+		})
+
+		Convey("a set without secondaries should have no lag", func() {
+			lag, _, err := ReplicationLag(replSetStatus{Members: []replSetMember{
+				{Name: "a:27017", State: replSetStatePrimary, OptimeDate: now},
+			}})
+			So(err, ShouldBeNil)
+			So(lag, ShouldEqual, 0)
+		})
+
+		Convey("a set without a primary should be an error", func() {
+			_, _, err := ReplicationLag(replSetStatus{Members: []replSetMember{
+				{Name: "a:27017", State: replSetStateSecondary, OptimeDate: now},
+			}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,391 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentTransform is a set of edits made to every document restored into a
+// namespace matching a pattern. Fields are renamed, then unset, then set, then
+// converted; all field names may be dotted paths into embedded documents. A
+// transform file holds a list of them, which are applied in order, e.g.
+//
+//	{"transforms": [{
+//		"ns": "shop.users",
+//		"rename": {"fname": "name.first", "lname": "name.last"},
+//		"unset": ["legacyId"],
+//		"set": {"schemaVersion": 2},
+//		"convert": {"createdAt": "date", "age": "int"}
+//	}]}
+type DocumentTransform struct {
+	Namespace string            `json:"ns"`
+	Rename    map[string]string `json:"rename"`
+	Unset     []string          `json:"unset"`
+	Set       bson.D            `json:"set"`
+	Convert   map[string]string `json:"convert"`
+}
+
+type documentTransformsFile struct {
+	Transforms []DocumentTransform `json:"transforms"`
+}
+
+// the types that fields can be converted to
+var transformConversions = map[string]func(interface{}) (interface{}, error){
+	"string":   convertToString,
+	"int":      convertToInt,
+	"long":     convertToLong,
+	"double":   convertToDouble,
+	"bool":     convertToBool,
+	"date":     convertToDate,
+	"objectId": convertToObjectId,
+}
+
+// the formats accepted when converting strings to dates
+var transformDateFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// DocumentTransformsFromJSON parses and validates the contents of a transform file
+func DocumentTransformsFromJSON(jsonBytes []byte) ([]DocumentTransform, error) {
+	file := documentTransformsFile{}
+	err := json.Unmarshal(jsonBytes, &file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range file.Transforms {
+		transform := &file.Transforms[i]
+		if err = util.ValidateNamespacePattern(transform.Namespace); err != nil {
+			return nil, fmt.Errorf("transform %v: %v", i, err)
+		}
+		for from, to := range transform.Rename {
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("transform %v: cannot rename '%v' to '%v'", i, from, to)
+			}
+		}
+		for field, toType := range transform.Convert {
+			if _, ok := transformConversions[toType]; !ok {
+				return nil, fmt.Errorf("transform %v: cannot convert %v to unknown type '%v'", i, field, toType)
+			}
+		}
+		transform.Set, err = bsonutil.GetExtendedBsonD(transform.Set)
+		if err != nil {
+			return nil, fmt.Errorf("transform %v: error reading set values: %v", i, err)
+		}
+	}
+	return file.Transforms, nil
+}
+
+// ReadDocumentTransforms reads the transform file given to --transformFile
+func ReadDocumentTransforms(filename string) ([]DocumentTransform, error) {
+	jsonBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filename, err)
+	}
+	transforms, err := DocumentTransformsFromJSON(jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", filename, err)
+	}
+	return transforms, nil
+}
+
+// TransformsForNamespace returns the transforms that apply to the given namespace
+func (restore *MongoRestore) TransformsForNamespace(namespace string) ([]DocumentTransform, error) {
+	matching := []DocumentTransform{}
+	for _, transform := range restore.documentTransforms {
+		matches, err := util.MatchNamespace(transform.Namespace, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			matching = append(matching, transform)
+		}
+	}
+	return matching, nil
+}
+
+// TransformDocument applies each of the transforms to a raw BSON document
+func TransformDocument(transforms []DocumentTransform, raw bson.Raw) (bson.D, error) {
+	doc := bson.D{}
+	err := bson.Unmarshal(raw.Data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object: %v", err)
+	}
+	for _, transform := range transforms {
+		transformed, err := transform.Apply(doc)
+		if err != nil {
+			id, _ := bsonutil.FindValueByKey("_id", &doc)
+			return nil, fmt.Errorf("error transforming document with _id %v: %v", id, err)
+		}
+		doc = transformed
+	}
+	return doc, nil
+}
+
+// Apply makes the transform's edits to a document
+func (transform DocumentTransform) Apply(doc bson.D) (bson.D, error) {
+	var err error
+	for _, from := range sortedKeys(transform.Rename) {
+		to := transform.Rename[from]
+		value, found := getPath(doc, from)
+		if !found {
+			continue
+		}
+		doc = unsetPath(doc, from)
+		if doc, err = setPath(doc, to, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range transform.Unset {
+		doc = unsetPath(doc, field)
+	}
+	for _, elem := range transform.Set {
+		if doc, err = setPath(doc, elem.Name, copyValue(elem.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range sortedKeys(transform.Convert) {
+		toType := transform.Convert[field]
+		value, found := getPath(doc, field)
+		if !found || value == nil {
+			continue
+		}
+		converted, err := transformConversions[toType](value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %v to %v: %v", field, toType, err)
+		}
+		if doc, err = setPath(doc, field, converted); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// sortedKeys returns the keys of a map in order, so
+// that fields are always edited in the same order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyValue copies embedded documents and arrays, so that values set
+// in one document can't be changed by later edits to another
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		copied := make(bson.D, len(v))
+		for i, elem := range v {
+			copied[i] = bson.DocElem{elem.Name, copyValue(elem.Value)}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, elem := range v {
+			copied[i] = copyValue(elem)
+		}
+		return copied
+	}
+	return value
+}
+
+// getPath returns the value at a dotted path in a document
+func getPath(doc bson.D, path string) (interface{}, bool) {
+	name, rest := splitPath(path)
+	for _, elem := range doc {
+		if elem.Name != name {
+			continue
+		}
+		if rest == "" {
+			return elem.Value, true
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		return getPath(subdoc, rest)
+	}
+	return nil, false
+}
+
+// setPath sets the value at a dotted path in a document, keeping the position
+// of an existing field and creating any missing embedded documents
+func setPath(doc bson.D, path string, value interface{}) (bson.D, error) {
+	name, rest := splitPath(path)
+	for i, elem := range doc {
+		if elem.Name != name {
+			continue
+		}
+		if rest == "" {
+			doc[i].Value = value
+			return doc, nil
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("cannot set %v: %v is not a document", path, name)
+		}
+		subdoc, err := setPath(subdoc, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = subdoc
+		return doc, nil
+	}
+	if rest == "" {
+		return append(doc, bson.DocElem{name, value}), nil
+	}
+	subdoc, err := setPath(bson.D{}, rest, value)
+	if err != nil {
+		return nil, err
+	}
+	return append(doc, bson.DocElem{name, subdoc}), nil
+}
+
+// unsetPath removes the field at a dotted path from a document
+func unsetPath(doc bson.D, path string) bson.D {
+	name, rest := splitPath(path)
+	for i, elem := range doc {
+		if elem.Name != name {
+			continue
+		}
+		if rest == "" {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+		if subdoc, ok := elem.Value.(bson.D); ok {
+			doc[i].Value = unsetPath(subdoc, rest)
+		}
+		return doc
+	}
+	return doc
+}
+
+func splitPath(path string) (string, string) {
+	i := strings.Index(path, ".")
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+func convertToString(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bson.ObjectId:
+		return v.Hex(), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+func convertToInt(value interface{}) (interface{}, error) {
+	n, err := convertToLong(value)
+	if err != nil {
+		return nil, err
+	}
+	if n.(int64) > math.MaxInt32 || n.(int64) < math.MinInt32 {
+		return nil, fmt.Errorf("%v is out of range for an int", value)
+	}
+	return int32(n.(int64)), nil
+}
+
+func convertToLong(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+func convertToDouble(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+func convertToBool(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(v))
+	case bool:
+		return v, nil
+	case float64, int, int32, int64:
+		return util.IsTruthy(v), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+// convertToDate converts strings in one of the transformDateFormats, or
+// numbers of milliseconds since the epoch, to dates
+func convertToDate(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, format := range transformDateFormats {
+			if t, err := time.Parse(format, strings.TrimSpace(v)); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("'%v' is not a date in a supported format", v)
+	}
+	ms, err := convertToLong(value)
+	if err != nil {
+		return nil, err
+	}
+	return time.Unix(0, ms.(int64)*int64(time.Millisecond)).UTC(), nil
+}
+
+func convertToObjectId(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.ObjectId:
+		return v, nil
+	case string:
+		if !bson.IsObjectIdHex(v) {
+			return nil, fmt.Errorf("'%v' is not a valid ObjectId", v)
+		}
+		return bson.ObjectIdHex(v), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
@@ -0,0 +1,118 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestDocumentTransformsFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a transform file", t, func() {
+
+		Convey("set values should be read as extended JSON", func() {
+			transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[{"ns":"shop.*",
+				"set":{"migratedAt":{"$date":"2015-06-01T00:00:00Z"},"version":{"$numberLong":"2"}}}]}`))
+			So(err, ShouldBeNil)
+			So(len(transforms), ShouldEqual, 1)
+			So(transforms[0].Set[0].Value, ShouldHaveSameTypeAs, time.Time{})
+			So(transforms[0].Set[1].Value, ShouldEqual, int64(2))
+		})
+
+		Convey("invalid transforms should be errors", func() {
+			_, err := DocumentTransformsFromJSON([]byte(`{"transforms":[{"ns":""}]}`))
+			So(err, ShouldNotBeNil)
+			_, err = DocumentTransformsFromJSON([]byte(`{"transforms":[{"ns":"a.b","rename":{"x":""}}]}`))
+			So(err, ShouldNotBeNil)
+			_, err = DocumentTransformsFromJSON([]byte(`{"transforms":[{"ns":"a.b","convert":{"x":"uuid"}}]}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTransformDocument(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a document from a dump", t, func() {
+		data, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"fname", "Ada"},
+			{"lname", "Lovelace"},
+			{"legacy", bson.D{{"id", 7}, {"keep", true}}},
+			{"age", "36"},
+			{"joined", "1842-10-01"},
+		})
+		So(err, ShouldBeNil)
+		raw := bson.Raw{Data: data}
+
+		Convey("fields should be renamed, unset, set and converted", func() {
+			transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[{"ns":"test.users",
+				"rename":{"fname":"name.first","lname":"name.last"},
+				"unset":["legacy.id"],
+				"set":{"schemaVersion":2},
+				"convert":{"age":"int","joined":"date"}}]}`))
+			So(err, ShouldBeNil)
+			doc, err := TransformDocument(transforms, raw)
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"legacy", bson.D{{"keep", true}}},
+				{"age", int32(36)},
+				{"joined", time.Date(1842, 10, 1, 0, 0, 0, 0, time.UTC)},
+				{"name", bson.D{{"first", "Ada"}, {"last", "Lovelace"}}},
+				{"schemaVersion", 2.0},
+			})
+		})
+
+		Convey("transforms should apply in order", func() {
+			transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[
+				{"ns":"test.*","rename":{"age":"years"}},
+				{"ns":"test.users","convert":{"years":"double"}}]}`))
+			So(err, ShouldBeNil)
+			doc, err := TransformDocument(transforms, raw)
+			So(err, ShouldBeNil)
+			value, found := getPath(doc, "years")
+			So(found, ShouldBeTrue)
+			So(value, ShouldEqual, 36.0)
+		})
+
+		Convey("failed conversions should be errors naming the document", func() {
+			transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[
+				{"ns":"test.users","convert":{"fname":"long"}}]}`))
+			So(err, ShouldBeNil)
+			_, err = TransformDocument(transforms, raw)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "_id 1")
+		})
+
+		Convey("setting a field inside a non-document should be an error", func() {
+			transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[
+				{"ns":"test.users","set":{"fname.first":"x"}}]}`))
+			So(err, ShouldBeNil)
+			_, err = TransformDocument(transforms, raw)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a mongorestore using transforms", t, func() {
+		transforms, err := DocumentTransformsFromJSON([]byte(`{"transforms":[
+			{"ns":"test.*","unset":["a"]},{"ns":"other.users","unset":["b"]}]}`))
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{documentTransforms: transforms}
+
+		Convey("only transforms for matching namespaces should be used", func() {
+			matching, err := restore.TransformsForNamespace("test.users")
+			So(err, ShouldBeNil)
+			So(len(matching), ShouldEqual, 1)
+			So(matching[0].Unset, ShouldResemble, []string{"a"})
+			matching, err = restore.TransformsForNamespace("none.users")
+			So(err, ShouldBeNil)
+			So(matching, ShouldBeEmpty)
+		})
+	})
+}
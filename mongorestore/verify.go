@@ -0,0 +1,281 @@
+package mongorestore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// DocumentDigest is an order-independent summary of a set of documents.
+// Each document's raw BSON is hashed and the hashes are summed, so two sets
+// of identical documents have the same digest no matter how they are ordered.
+type DocumentDigest struct {
+	Count int64
+	Sum   uint64
+}
+
+// Add includes a document's raw BSON in the digest
+func (digest *DocumentDigest) Add(data []byte) {
+	hash := md5.Sum(data)
+	digest.Count++
+	digest.Sum += binary.LittleEndian.Uint64(hash[:8])
+}
+
+// VerifyReport is the result of comparing a restored collection with its dump
+type VerifyReport struct {
+	Namespace string
+
+	// DocumentsChecked is false if the dump's documents could not be re-read
+	DocumentsChecked bool
+	Dump             DocumentDigest
+	Server           DocumentDigest
+	ServerCount      int64
+	IndexesChecked   int
+
+	Failures []string
+}
+
+func (report *VerifyReport) addFailure(format string, a ...interface{}) {
+	report.Failures = append(report.Failures, fmt.Sprintf(format, a...))
+}
+
+// Passed returns true if the restored collection matches the dump
+func (report *VerifyReport) Passed() bool {
+	return len(report.Failures) == 0
+}
+
+// VerifyIntent compares the restored collection with the intent's dump: its
+// document count, a digest of its documents and the indexes from its metadata.
+func (restore *MongoRestore) VerifyIntent(intent *intents.Intent, indexes []IndexDocument) *VerifyReport {
+	report := &VerifyReport{Namespace: intent.Key()}
+	log.Logf(log.Info, "verifying %v", intent.Key())
+
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		report.addFailure("error establishing connection: %v", err)
+		return report
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	collection := session.DB(intent.DB).C(intent.C)
+
+	if intent.BSONPath != "" {
+		if restore.useStdin {
+			log.Logf(log.Always, "cannot verify documents of %v restored from stdin; only verifying indexes", intent.Key())
+		} else {
+			restore.verifyDocuments(report, intent, collection)
+		}
+	}
+
+	if !restore.OutputOptions.NoIndexRestore && len(indexes) > 0 {
+		serverIndexes, err := db.GetIndexes(collection)
+		if err != nil {
+			report.addFailure("%v", err)
+			return report
+		}
+		restore.verifyIndexes(report, indexes, serverIndexes)
+	}
+	return report
+}
+
+func (restore *MongoRestore) verifyDocuments(report *VerifyReport, intent *intents.Intent, collection *mgo.Collection) {
+	rawSource, err := restore.OpenDataFile(intent.BSONPath)
+	if err != nil {
+		report.addFailure("error reading file %v: %v", intent.BSONPath, err)
+		return
+	}
+	bsonSource := db.NewDecodedBSONSource(rawSource)
+	defer bsonSource.Close()
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		report.Dump.Add(doc.Data)
+	}
+	if err = bsonSource.Err(); err != nil {
+		report.addFailure("error reading BSON file %v: %v", intent.BSONPath, err)
+		return
+	}
+
+	count, err := collection.Count()
+	if err != nil {
+		report.addFailure("error counting documents: %v", err)
+		return
+	}
+	report.ServerCount = int64(count)
+	iter := collection.Find(nil).Iter()
+	for iter.Next(&doc) {
+		report.Server.Add(doc.Data)
+	}
+	if err = iter.Close(); err != nil {
+		report.addFailure("error reading documents: %v", err)
+		return
+	}
+	report.DocumentsChecked = true
+
+	if report.ServerCount != report.Dump.Count {
+		report.addFailure("collection has %v documents; dump has %v", report.ServerCount, report.Dump.Count)
+	}
+	transforms, err := restore.TransformsForNamespace(intent.Key())
+	if err != nil {
+		report.addFailure("%v", err)
+		return
+	}
+	if len(transforms) > 0 {
+		log.Logf(log.Info, "documents of %v were transformed; only verifying their count", intent.Key())
+		return
+	}
+	// documents converted from JSON don't keep the dump's field order or
+	// numeric types, and the server adds an _id if they have none
+	if restore.useJSONInput {
+		log.Logf(log.Info, "documents of %v were restored from JSON; only verifying their count", intent.Key())
+		return
+	}
+	if report.Server != report.Dump {
+		report.addFailure("documents on the server do not match the dump (digest %016x, dump digest %016x)",
+			report.Server.Sum, report.Dump.Sum)
+	}
+}
+
+// verifyIndexes checks that every index in the metadata exists
+// on the server with the same key and options
+func (restore *MongoRestore) verifyIndexes(report *VerifyReport, indexes []IndexDocument, serverIndexes []bson.D) {
+	byName := map[string]bson.M{}
+	for _, serverIndex := range serverIndexes {
+		index := serverIndex.Map()
+		if name, ok := index["name"].(string); ok {
+			byName[name] = index
+		}
+	}
+
+	for _, index := range indexes {
+		report.IndexesChecked++
+		name, _ := index.Options["name"].(string)
+		serverIndex, ok := byName[name]
+		if !ok {
+			report.addFailure("index %v is missing", name)
+			continue
+		}
+		serverKey, _ := serverIndex["key"].(bson.D)
+		if !keysEqual(index.Key, serverKey) {
+			report.addFailure("index %v has key %v; dump has %v",
+				name, describeKey(serverKey), describeKey(index.Key))
+		}
+		for option, value := range index.Options {
+			if option == "ns" || option == "key" ||
+				(option == "v" && !restore.OutputOptions.KeepIndexVersion) ||
+				(option == "background" && restore.OutputOptions.ForceBackgroundIndexBuilds) {
+				continue
+			}
+			value, err := bsonutil.ConvertJSONValueToBSON(value)
+			if err != nil {
+				report.addFailure("error reading option %v of index %v: %v", option, name, err)
+				continue
+			}
+			serverValue, ok := serverIndex[option]
+			if !ok {
+				report.addFailure("index %v is missing option %v", name, option)
+				continue
+			}
+			if !reflect.DeepEqual(comparableValue(serverValue), comparableValue(value)) {
+				report.addFailure("index %v has %v %v; dump has %v", name, option, serverValue, value)
+			}
+		}
+	}
+}
+
+// comparableValue converts documents to maps and numbers to float64, so that
+// equal options read from the server and from JSON metadata compare as equal
+func comparableValue(value interface{}) interface{} {
+	if number, ok := filterNumber(value); ok {
+		return number
+	}
+	switch v := value.(type) {
+	case bson.D:
+		m := bson.M{}
+		for _, elem := range v {
+			m[elem.Name] = comparableValue(elem.Value)
+		}
+		return m
+	case bson.M:
+		return comparableValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		m := bson.M{}
+		for key, elemValue := range v {
+			m[key] = comparableValue(elemValue)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, elemValue := range v {
+			a[i] = comparableValue(elemValue)
+		}
+		return a
+	}
+	return value
+}
+
+// addVerifyReport records a report from one of the restore goroutines
+func (restore *MongoRestore) addVerifyReport(report *VerifyReport) {
+	restore.verifyReportsMutex.Lock()
+	defer restore.verifyReportsMutex.Unlock()
+	restore.verifyReports = append(restore.verifyReports, report)
+}
+
+// WriteVerifyReports writes the verification results for every
+// restored namespace and returns an error if any of them failed
+func (restore *MongoRestore) WriteVerifyReports(w io.Writer) error {
+	reports := restore.verifyReports
+	sort.Sort(byVerifyNamespace(reports))
+
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("namespace", "dump docs", "server docs", "indexes", "result")
+	out.EndRow()
+	failed := 0
+	for _, report := range reports {
+		dumpDocs, serverDocs := "-", "-"
+		if report.DocumentsChecked {
+			dumpDocs = fmt.Sprintf("%v", report.Dump.Count)
+			serverDocs = fmt.Sprintf("%v", report.ServerCount)
+		}
+		result := "pass"
+		if !report.Passed() {
+			result = "FAIL"
+			failed++
+		}
+		out.WriteCells(report.Namespace, dumpDocs, serverDocs,
+			fmt.Sprintf("%v", report.IndexesChecked), result)
+		out.EndRow()
+	}
+	buf := &bytes.Buffer{}
+	out.Flush(buf)
+	for _, report := range reports {
+		for _, failure := range report.Failures {
+			fmt.Fprintf(buf, "%v: %v\n", report.Namespace, failure)
+		}
+	}
+	w.Write(buf.Bytes())
+
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %v of %v namespaces", failed, len(reports))
+	}
+	log.Logf(log.Always, "verified %v namespaces against the dump", len(reports))
+	return nil
+}
+
+type byVerifyNamespace []*VerifyReport
+
+func (reports byVerifyNamespace) Len() int      { return len(reports) }
+func (reports byVerifyNamespace) Swap(i, j int) { reports[i], reports[j] = reports[j], reports[i] }
+func (reports byVerifyNamespace) Less(i, j int) bool {
+	return reports[i].Namespace < reports[j].Namespace
+}
@@ -0,0 +1,126 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestDocumentDigest(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With some documents", t, func() {
+		docs := [][]byte{}
+		for _, doc := range []bson.D{{{"_id", 1}}, {{"_id", 2}}, {{"_id", 3}, {"a", "b"}}} {
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			docs = append(docs, data)
+		}
+
+		Convey("digests should not depend on document order", func() {
+			forward, backward := DocumentDigest{}, DocumentDigest{}
+			for i := range docs {
+				forward.Add(docs[i])
+				backward.Add(docs[len(docs)-1-i])
+			}
+			So(forward.Count, ShouldEqual, 3)
+			So(forward, ShouldResemble, backward)
+		})
+
+		Convey("digests of different documents should differ", func() {
+			all, missing := DocumentDigest{}, DocumentDigest{}
+			for i := range docs {
+				all.Add(docs[i])
+				if i != 1 {
+					missing.Add(docs[i])
+				}
+			}
+			missing.Add(docs[0])
+			So(all.Count, ShouldEqual, missing.Count)
+			So(all.Sum, ShouldNotEqual, missing.Sum)
+		})
+	})
+}
+
+func TestVerifyIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With a mongorestore and indexes from metadata", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		_, indexes, err := restore.MetadataFromJSON([]byte(`{"indexes":[
+			{"v":1,"key":{"_id":1},"name":"_id_","ns":"test.foo"},
+			{"v":1,"key":{"a":1,"b":-1},"name":"a_1_b_-1","ns":"test.foo","unique":true,
+				"partialFilterExpression":{"b":{"$gt":5}}}]}`))
+		So(err, ShouldBeNil)
+		serverIndexes := []bson.D{
+			{{"v", 2}, {"key", bson.D{{"_id", 1}}}, {"name", "_id_"}},
+			{{"v", 2}, {"key", bson.D{{"a", 1.0}, {"b", -1.0}}}, {"name", "a_1_b_-1"},
+				{"unique", true}, {"partialFilterExpression", bson.D{{"b", bson.D{{"$gt", 5}}}}}},
+		}
+
+		Convey("matching indexes should pass", func() {
+			report := &VerifyReport{}
+			restore.verifyIndexes(report, indexes, serverIndexes)
+			So(report.Failures, ShouldBeEmpty)
+			So(report.IndexesChecked, ShouldEqual, 2)
+		})
+
+		Convey("missing indexes should fail", func() {
+			report := &VerifyReport{}
+			restore.verifyIndexes(report, indexes, serverIndexes[:1])
+			So(report.Passed(), ShouldBeFalse)
+			So(report.Failures[0], ShouldContainSubstring, "a_1_b_-1 is missing")
+		})
+
+		Convey("indexes with different keys or options should fail", func() {
+			serverIndexes[1] = bson.D{{"key", bson.D{{"a", 1}}}, {"name", "a_1_b_-1"}, {"unique", false},
+				{"partialFilterExpression", bson.D{{"b", bson.D{{"$gt", 5}}}}}}
+			report := &VerifyReport{}
+			restore.verifyIndexes(report, indexes, serverIndexes)
+			So(len(report.Failures), ShouldEqual, 2)
+		})
+
+		Convey("options that only format the same way should fail", func() {
+			serverIndexes[1] = append(serverIndexes[1][:4],
+				bson.DocElem{"partialFilterExpression", bson.D{{"b", bson.D{{"$gt", "5"}}}}})
+			report := &VerifyReport{}
+			restore.verifyIndexes(report, indexes, serverIndexes)
+			So(len(report.Failures), ShouldEqual, 1)
+			So(report.Failures[0], ShouldContainSubstring, "partialFilterExpression")
+		})
+
+		Convey("index versions should only be compared with --keepIndexVersion", func() {
+			restore.OutputOptions.KeepIndexVersion = true
+			report := &VerifyReport{}
+			restore.verifyIndexes(report, indexes, serverIndexes)
+			So(len(report.Failures), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestWriteVerifyReports(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UNIT_TEST_TYPE)
+
+	Convey("With verification reports", t, func() {
+		restore := &MongoRestore{}
+		restore.addVerifyReport(&VerifyReport{Namespace: "test.b", DocumentsChecked: true,
+			Dump: DocumentDigest{2, 10}, Server: DocumentDigest{2, 10}, ServerCount: 2})
+		restore.addVerifyReport(&VerifyReport{Namespace: "test.a", Failures: []string{"index x is missing"}})
+
+		Convey("a failure should be reported and returned", func() {
+			buf := &bytes.Buffer{}
+			err := restore.WriteVerifyReports(buf)
+			So(err, ShouldNotBeNil)
+			out := buf.String()
+			So(out, ShouldContainSubstring, "FAIL")
+			So(out, ShouldContainSubstring, "pass")
+			So(out, ShouldContainSubstring, "test.a: index x is missing")
+			So(bytes.Index(buf.Bytes(), []byte("test.a")), ShouldBeLessThan, bytes.Index(buf.Bytes(), []byte("test.b")))
+		})
+	})
+}